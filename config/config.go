@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"net"
+	"strings"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 )
@@ -18,6 +22,85 @@ type Config struct {
 
 	// JWT
 	JWTKey string `envconfig:"JWT_KEY" default:"user"`
+	// JWTEmbedPermissions embeds roles and permissions in access tokens so
+	// permission checks do not have to load them from the database.
+	JWTEmbedPermissions bool `envconfig:"JWT_EMBED_PERMISSIONS" default:"false"`
+
+	// Authorization
+	// AuthzCacheTTL is how long user grants are cached for permission checks,
+	// zero disables the cache.
+	AuthzCacheTTL time.Duration `envconfig:"AUTHZ_CACHE_TTL" default:"30s"`
+	// ServiceKeys are the credentials other services use to call the
+	// authorization RPCs, sent in the x-service-key metadata.
+	ServiceKeys []string `envconfig:"SERVICE_KEYS"`
+	// RoleSweepInterval is how often expired role grants are removed.
+	RoleSweepInterval time.Duration `envconfig:"ROLE_SWEEP_INTERVAL" default:"1m"`
+	// MaxElevation is the longest time an elevation request may ask for.
+	MaxElevation time.Duration `envconfig:"MAX_ELEVATION" default:"8h"`
+	// MaxFailedLogins locks a user after that many failed logins in a row
+	// for LockDuration, zero never locks.
+	MaxFailedLogins int           `envconfig:"MAX_FAILED_LOGINS" default:"5"`
+	LockDuration    time.Duration `envconfig:"LOCK_DURATION" default:"15m"`
+
+	// Users
+	// DeletedUserRetentionDays is how long deleted users may be restored
+	// before they are purged, zero keeps them forever. Purging runs every
+	// PurgeInterval.
+	DeletedUserRetentionDays int           `envconfig:"DELETED_USER_RETENTION_DAYS" default:"30"`
+	PurgeInterval            time.Duration `envconfig:"PURGE_INTERVAL" default:"1h"`
+	// PageTokenKey is the secret the key signing the page tokens of
+	// listings is derived from, JWTKey when empty. The derived key differs
+	// from the secret, so it never signs access tokens.
+	PageTokenKey string `envconfig:"PAGE_TOKEN_KEY"`
+	// UserSearch is the full-text index keyword searches use, mysql or
+	// bleve, which keeps the index at UserSearchIndex and rebuilds it on
+	// start. Searches find at most MaxSearchHits users.
+	UserSearch      string `envconfig:"USER_SEARCH" default:"mysql"`
+	UserSearchIndex string `envconfig:"USER_SEARCH_INDEX" default:"users.bleve"`
+	MaxSearchHits   int    `envconfig:"MAX_SEARCH_HITS" default:"1000"`
+	// RelationNamespaces is the path of the JSON namespace config used by
+	// relation tuples.
+	RelationNamespaces string `envconfig:"RELATION_NAMESPACES" default:"namespaces.json"`
+
+	// Mail
+	// SMTPHost is the server mail is sent through, mail is only logged when
+	// it is empty.
+	SMTPHost     string `envconfig:"SMTP_HOST"`
+	SMTPPort     string `envconfig:"SMTP_PORT" default:"587"`
+	SMTPUsername string `envconfig:"SMTP_USERNAME"`
+	SMTPPassword string `envconfig:"SMTP_PASSWORD"`
+	MailFrom     string `envconfig:"MAIL_FROM" default:"no-reply@localhost"`
+
+	// Invitations
+	// InviteURL is the page accepting invitations, the token is added as
+	// the token query parameter.
+	InviteURL string        `envconfig:"INVITE_URL" default:"http://localhost:8080/invitation"`
+	InviteTTL time.Duration `envconfig:"INVITE_TTL" default:"72h"`
+
+	// Registration
+	// RegistrationMode is disabled, open or domains, which only lets the
+	// addresses of RegistrationDomains sign up.
+	RegistrationMode    string   `envconfig:"REGISTRATION_MODE" default:"disabled"`
+	RegistrationDomains []string `envconfig:"REGISTRATION_DOMAINS"`
+	// RegistrationRole is assigned to registered users, none when empty.
+	RegistrationRole string `envconfig:"REGISTRATION_ROLE" default:"user"`
+	// RegistrationVerifyEmail keeps registered users from signing in until
+	// they follow the link mailed to VerifyEmailURL.
+	RegistrationVerifyEmail bool          `envconfig:"REGISTRATION_VERIFY_EMAIL" default:"true"`
+	VerifyEmailURL          string        `envconfig:"VERIFY_EMAIL_URL" default:"http://localhost:8080/verify-email"`
+	VerifyEmailTTL          time.Duration `envconfig:"VERIFY_EMAIL_TTL" default:"24h"`
+	// RegistrationGuard protects registration against abuse: none,
+	// ratelimit, allowing RegistrationRateLimit sign ups per client IP and
+	// RegistrationRateWindow, or pow, requiring a proof of work of
+	// RegistrationPowBits leading zero bits.
+	RegistrationGuard      string        `envconfig:"REGISTRATION_GUARD" default:"ratelimit"`
+	RegistrationRateLimit  int           `envconfig:"REGISTRATION_RATE_LIMIT" default:"5"`
+	RegistrationRateWindow time.Duration `envconfig:"REGISTRATION_RATE_WINDOW" default:"1h"`
+	RegistrationPowBits    int           `envconfig:"REGISTRATION_POW_BITS" default:"20"`
+	// TrustedProxies are the addresses or CIDR ranges of the proxies in
+	// front of the service, the gateway included. Client addresses are only
+	// read from x-forwarded-for when set by them.
+	TrustedProxies []string `envconfig:"TRUSTED_PROXIES" default:"127.0.0.1/8,::1/128"`
 }
 
 func New() Config {
@@ -27,5 +110,32 @@ func New() Config {
 		log.Fatal(err.Error())
 	}
 
+	for _, v := range c.TrustedProxies {
+		if _, err := ParseProxy(v); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
 	return c
 }
+
+// ParseProxy parses an entry of TrustedProxies, a single address being a
+// range of one.
+func ParseProxy(value string) (*net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		return network, err
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid trusted proxy %q", value)
+	}
+
+	bits := 8 * len(ip.To16())
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 32
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var (
+	ErrInvalidAttributeDefinition = errors.New("invalid attribute definition")
+	ErrInvalidAttribute           = errors.New("invalid attribute")
+	ErrAttributeInUse             = errors.New("attribute value is used by another user")
+)
+
+// AttributeType is the JSON type of the values of an attribute.
+type AttributeType string
+
+const (
+	AttributeString  AttributeType = "string"
+	AttributeNumber  AttributeType = "number"
+	AttributeBoolean AttributeType = "boolean"
+)
+
+func (t AttributeType) Valid() bool {
+	switch t {
+	case AttributeString, AttributeNumber, AttributeBoolean:
+		return true
+	}
+
+	return false
+}
+
+// AttributeDefinition declares a custom attribute of users. Users may only
+// hold defined attributes. Unique values are unique across every user and
+// Pattern, only allowed for strings, must match whole values.
+type AttributeDefinition struct {
+	ID          int64
+	Name        string
+	Description string
+	Type        AttributeType
+	Required    bool
+	Unique      bool
+	Pattern     string
+}
+
+// Validate checks the type and pattern of the definition itself.
+func (d *AttributeDefinition) Validate() error {
+	if !d.Type.Valid() {
+		return fmt.Errorf("%w: unknown type %s", ErrInvalidAttributeDefinition, d.Type)
+	}
+
+	if d.Pattern == "" {
+		return nil
+	}
+
+	if d.Type != AttributeString {
+		return fmt.Errorf("%w: only strings may have a pattern", ErrInvalidAttributeDefinition)
+	}
+
+	if _, err := d.pattern(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAttributeDefinition, err)
+	}
+
+	return nil
+}
+
+// Check makes sure value, as decoded from JSON, suits the definition.
+func (d *AttributeDefinition) Check(value interface{}) error {
+	switch d.Type {
+	case AttributeString:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%w: %s must be a string", ErrInvalidAttribute, d.Name)
+		}
+
+		if d.Pattern == "" {
+			return nil
+		}
+
+		re, err := d.pattern()
+		if err != nil {
+			return err
+		}
+
+		if !re.MatchString(s) {
+			return fmt.Errorf("%w: %s does not match %s", ErrInvalidAttribute, d.Name, d.Pattern)
+		}
+	case AttributeNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%w: %s must be a number", ErrInvalidAttribute, d.Name)
+		}
+	case AttributeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%w: %s must be a boolean", ErrInvalidAttribute, d.Name)
+		}
+	}
+
+	return nil
+}
+
+// pattern anchors Pattern, so it must match the whole value.
+func (d *AttributeDefinition) pattern() (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + d.Pattern + `)$`)
+}
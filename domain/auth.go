@@ -2,17 +2,31 @@ package domain
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"time"
 )
 
 type AuthUsecase interface {
-	Login(ctx context.Context, email, password string) (*FullToken, error)
-	RefreshToken(ctx context.Context, id int64) (*AccessToken, error)
+	// Login signs the user in to the organization orgID, or to the
+	// platform tenant when orgID is zero. Unknown emails, wrong passwords
+	// and locked users all fail with ErrInvalidCredentials, the status of
+	// other users is only told once the password matched.
+	Login(ctx context.Context, email, password string, orgID int64) (*FullToken, error)
+	RefreshToken(ctx context.Context, id, orgID int64) (*AccessToken, error)
+	// AcceptInvitation sets the name and password of an invited user, who
+	// may sign in afterwards.
+	AcceptInvitation(ctx context.Context, token, name, password string) error
+	// Register signs up a user in the platform tenant according to the
+	// registration mode and returns its ID. Nothing is kept when the
+	// verification mail cannot be sent.
+	Register(ctx context.Context, r *Registration) (int64, error)
+	VerifyEmail(ctx context.Context, token string) error
 }
 
 var (
-	ErrPasswordIncorrect = errors.New("password incorrect")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrPermissionChanged  = errors.New("permissions changed, please refresh token")
 )
 
 type FullToken struct {
@@ -28,6 +42,18 @@ type AccessToken struct {
 }
 
 type JWTClaims struct {
-	ID  string `json:"jti"`
-	Exp int64  `json:"exp"`
+	ID                string   `json:"jti"`
+	Exp               int64    `json:"exp"`
+	Roles             []string `json:"roles"`
+	Permissions       []string `json:"permissions"`
+	PermissionVersion int64    `json:"pv"`
+	// OrgID is the organization the token acts in, zero for the platform.
+	OrgID int64 `json:"org"`
+}
+
+// GetClaims returns the token claims stored in ctx by the auth interceptor.
+func GetClaims(ctx context.Context) (res JWTClaims) {
+	c, _ := ctx.Value("claims").(string)
+	_ = json.Unmarshal([]byte(c), &res)
+	return
 }
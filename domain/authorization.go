@@ -0,0 +1,228 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type GrantMode int
+
+const (
+	// GrantAny is satisfied when any requested permission is granted.
+	GrantAny GrantMode = iota
+	// GrantAll is satisfied only when every requested permission is granted.
+	GrantAll
+)
+
+func (m GrantMode) String() string {
+	if m == GrantAll {
+		return "all"
+	}
+
+	return "any"
+}
+
+// Scope limits a grant to some target users, either "self",
+// "users:<id>,<id>" or the members of groups "groups:<id>,<id>" of the
+// tenant. The zero value is a global grant.
+type Scope string
+
+const (
+	ScopeGlobal Scope = ""
+	ScopeSelf   Scope = "self"
+
+	scopeUsersPrefix  = "users:"
+	scopeGroupsPrefix = "groups:"
+	grantScopeMark    = "@"
+	grantPolicyMark   = "#"
+)
+
+func ParseScope(v string) (Scope, error) {
+	if v == string(ScopeGlobal) || v == string(ScopeSelf) {
+		return Scope(v), nil
+	}
+
+	prefix := scopeUsersPrefix
+	if strings.HasPrefix(v, scopeGroupsPrefix) {
+		prefix = scopeGroupsPrefix
+	}
+
+	if _, err := parseScopeIDs(v, prefix); err != nil {
+		return "", err
+	}
+
+	return Scope(v), nil
+}
+
+// ByGroups reports whether the scope covers the members of groups, so
+// Covers needs the groups of the target.
+func (s Scope) ByGroups() bool {
+	return strings.HasPrefix(string(s), scopeGroupsPrefix)
+}
+
+// Covers reports whether the scope lets callerID exercise a grant on
+// targetID, a member of the groups targetGroups. A zero targetID means the
+// target is unknown, which only global grants cover.
+func (s Scope) Covers(callerID, targetID int64, targetGroups []int64) bool {
+	if s == ScopeGlobal {
+		return true
+	}
+
+	if targetID == 0 {
+		return false
+	}
+
+	if s == ScopeSelf {
+		return callerID == targetID
+	}
+
+	prefix, targets := scopeUsersPrefix, []int64{targetID}
+	if s.ByGroups() {
+		prefix, targets = scopeGroupsPrefix, targetGroups
+	}
+
+	ids, err := parseScopeIDs(string(s), prefix)
+	if err != nil {
+		return false
+	}
+
+	for _, v := range ids {
+		for _, t := range targets {
+			if v == t {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func parseScopeIDs(v, prefix string) ([]int64, error) {
+	if !strings.HasPrefix(v, prefix) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidScope, v)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(v, prefix), ",")
+	ids := make([]int64, len(parts))
+
+	for i := 0; i < len(parts); i++ {
+		id, err := strconv.ParseInt(parts[i], 10, 64)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, v)
+		}
+
+		ids[i] = id
+	}
+
+	return ids, nil
+}
+
+// Grant is a permission held through Role, limited to Scope and, when
+// Policy is set, to the calls the named policy allows. Role is empty when
+// the grant is taken from access token claims.
+type Grant struct {
+	Permission string
+	Scope      Scope
+	Policy     string
+	Role       string
+}
+
+// ParseGrant parses a grant written as permission[@scope][#policy].
+func ParseGrant(v string) (Grant, error) {
+	v, policy, _ := strings.Cut(v, grantPolicyMark)
+	name, scope, _ := strings.Cut(v, grantScopeMark)
+
+	s, err := ParseScope(scope)
+	if err != nil {
+		return Grant{}, err
+	}
+
+	return Grant{
+		Permission: name,
+		Scope:      s,
+		Policy:     policy,
+	}, nil
+}
+
+// String writes the grant as permission[@scope][#policy].
+func (g Grant) String() string {
+	res := g.Permission
+
+	if g.Scope != ScopeGlobal {
+		res += grantScopeMark + string(g.Scope)
+	}
+
+	if g.Policy != "" {
+		res += grantPolicyMark + g.Policy
+	}
+
+	return res
+}
+
+// Policy is a named CEL expression that must hold for a grant to apply.
+// The expression sees the caller, target and request variables.
+type Policy struct {
+	ID          int64
+	Name        string
+	Description string
+	Expression  string
+}
+
+// RequestInfo describes the call being authorized, for policies.
+type RequestInfo struct {
+	Method   string
+	Metadata map[string]string
+	Claims   map[string]interface{}
+	Time     time.Time
+}
+
+type AuthorizeParams struct {
+	UserID      int64
+	Permissions []string
+	Mode        GrantMode
+	// TargetUserID is the user the permissions are exercised on, used by
+	// scoped grants. Zero when there is no such user.
+	TargetUserID int64
+	Request      *RequestInfo
+}
+
+// PermissionMatch tells which grant decided a requested permission.
+type PermissionMatch struct {
+	Permission string
+	Grant      string
+	Role       string
+}
+
+func (m PermissionMatch) String() string {
+	if m.Role == "" {
+		return fmt.Sprintf("%s by %s", m.Permission, m.Grant)
+	}
+
+	return fmt.Sprintf("%s by %s via %s", m.Permission, m.Grant, m.Role)
+}
+
+// Decision explains the outcome of a permission check.
+type Decision struct {
+	Mode    GrantMode
+	Allowed bool
+	Matched []PermissionMatch
+	// Denied permissions are blocked by an explicit deny grant.
+	Denied []PermissionMatch
+	// Missing permissions are not granted, including the denied ones.
+	Missing []string
+}
+
+// NotGrantedError is returned when a Decision does not allow access.
+type NotGrantedError struct {
+	Decision *Decision
+}
+
+func (e *NotGrantedError) Error() string {
+	return fmt.Sprintf("%s, missing %s of: %s", ErrNotGranted, e.Decision.Mode, strings.Join(e.Decision.Missing, ", "))
+}
+
+func (e *NotGrantedError) Unwrap() error {
+	return ErrNotGranted
+}
@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{value: "", valid: true},
+		{value: "self", valid: true},
+		{value: "users:1", valid: true},
+		{value: "users:1,22", valid: true},
+		{value: "groups:3", valid: true},
+		{value: "groups:3,4", valid: true},
+		{value: "users:", valid: false},
+		{value: "users:0", valid: false},
+		{value: "users:1,", valid: false},
+		{value: "groups:", valid: false},
+		{value: "groups:-3", valid: false},
+		{value: "groups:admins", valid: false},
+		{value: "group:3", valid: false},
+		{value: "others", valid: false},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseScope(tt.value)
+		if tt.valid && err != nil {
+			t.Errorf("ParseScope(%q) failed: %v", tt.value, err)
+		}
+
+		if !tt.valid && !errors.Is(err, ErrInvalidScope) {
+			t.Errorf("ParseScope(%q) = %v, want %v", tt.value, err, ErrInvalidScope)
+		}
+	}
+}
+
+func TestScopeCovers(t *testing.T) {
+	tests := []struct {
+		scope        Scope
+		targetID     int64
+		targetGroups []int64
+		want         bool
+	}{
+		{scope: ScopeGlobal, targetID: 0, want: true},
+		{scope: ScopeGlobal, targetID: 2, want: true},
+		{scope: ScopeSelf, targetID: 1, want: true},
+		{scope: ScopeSelf, targetID: 2, want: false},
+		{scope: ScopeSelf, targetID: 0, want: false},
+		{scope: "users:2,3", targetID: 3, want: true},
+		{scope: "users:2,3", targetID: 4, want: false},
+		{scope: "users:2,3", targetID: 0, want: false},
+		// user IDs are never read as groups and the other way around
+		{scope: "users:2,3", targetID: 4, targetGroups: []int64{2}, want: false},
+		{scope: "groups:5,6", targetID: 4, targetGroups: []int64{6, 9}, want: true},
+		{scope: "groups:5,6", targetID: 4, targetGroups: []int64{7}, want: false},
+		{scope: "groups:5,6", targetID: 5, want: false},
+		{scope: "groups:5,6", targetID: 0, targetGroups: []int64{5}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.scope.Covers(1, tt.targetID, tt.targetGroups); got != tt.want {
+			t.Errorf("%q.Covers(1, %d, %v) = %v, want %v", tt.scope, tt.targetID, tt.targetGroups, got, tt.want)
+		}
+	}
+}
+
+func TestParseGrant(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Grant
+	}{
+		{value: "user:read", want: Grant{Permission: "user:read"}},
+		{value: "user:read@self", want: Grant{Permission: "user:read", Scope: ScopeSelf}},
+		{value: "user:update@groups:3,4", want: Grant{Permission: "user:update", Scope: "groups:3,4"}},
+		{value: "user:update@groups:3#office", want: Grant{Permission: "user:update", Scope: "groups:3", Policy: "office"}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseGrant(tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != tt.want {
+			t.Errorf("ParseGrant(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+
+		if got.String() != tt.value {
+			t.Errorf("%+v.String() = %q, want %q", got, got.String(), tt.value)
+		}
+	}
+}
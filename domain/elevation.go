@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidElevation    = errors.New("invalid elevation, duration must be positive and within the allowed maximum")
+	ErrElevationNotPending = errors.New("elevation request is not pending")
+	ErrSelfApproval        = errors.New("cannot approve your own elevation request")
+)
+
+// RoleGrant describes how roles are assigned. GrantedBy is zero when the
+// granting user is unknown and a nil ExpiresAt never expires. A zero OrgID
+// assigns in the tenant of the context.
+type RoleGrant struct {
+	OrgID     int64
+	GrantedBy int64
+	ExpiresAt *time.Time
+}
+
+type ElevationStatus string
+
+const (
+	ElevationPending  ElevationStatus = "pending"
+	ElevationApproved ElevationStatus = "approved"
+)
+
+// Elevation is a request of UserID to hold Role for Duration, granted once
+// another user approves it.
+type Elevation struct {
+	ID         int64
+	UserID     int64
+	OrgID      int64
+	Role       string
+	Reason     string
+	Duration   time.Duration
+	Status     ElevationStatus
+	ApprovedBy int64
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+}
+
+// AuditEntry records a change of access made by ActorID, zero for the
+// system, on TargetUserID.
+type AuditEntry struct {
+	OrgID        int64
+	ActorID      int64
+	Action       string
+	TargetUserID int64
+	Detail       string
+}
+
+const (
+	AuditElevationRequested = "elevation.requested"
+	AuditElevationApproved  = "elevation.approved"
+	AuditRoleExpired        = "role.expired"
+	AuditUserStatusChanged  = "user.status_changed"
+)
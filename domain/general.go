@@ -1,11 +1,25 @@
 package domain
 
+import "errors"
+
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// PaginationInfo describes a page of a listing, either numbered or
+// following a page token. NextCursor and NextPageToken continue the listing
+// after the page either way, and are empty on the last page.
 type PaginationInfo struct {
-	Page      int32
-	PageSize  int32
-	TotalData int64
+	Page          int32
+	PageSize      int32
+	TotalData     int64
+	NextCursor    Cursor
+	NextPageToken string
 }
 
+// Cursor holds the values a listing is ordered by for its last item, nil
+// for NULL, so the next page starts after that item however many items were
+// added or removed meanwhile.
+type Cursor []*string
+
 func MakePaginationInfo(page int32, pageSize int32) *PaginationInfo {
 	return &PaginationInfo{
 		Page:     page,
@@ -18,7 +32,11 @@ func (p *PaginationInfo) GetOffset() int32 {
 }
 
 func (p *PaginationInfo) GetTotalPage() int64 {
-	return int64((p.TotalData / int64(p.PageSize)) + 1)
+	if p.PageSize <= 0 {
+		return 0
+	}
+
+	return (p.TotalData + int64(p.PageSize) - 1) / int64(p.PageSize)
 }
 
 func (p *PaginationInfo) SetTotalData(v int64) {
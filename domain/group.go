@@ -0,0 +1,14 @@
+package domain
+
+import "errors"
+
+var ErrInvalidGroupName = errors.New("invalid group name")
+
+// Group is a set of users of one organization. Roles assigned to the group
+// are held by every member, in the group's organization.
+type Group struct {
+	ID    int64
+	OrgID int64
+	Name  string
+	Roles []string
+}
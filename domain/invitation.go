@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvitationInvalid    = errors.New("invitation is invalid, expired or already used")
+	ErrInvitationNotPending = errors.New("invitation is not pending")
+)
+
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "pending"
+	InvitationAccepted InvitationStatus = "accepted"
+	InvitationRevoked  InvitationStatus = "revoked"
+	InvitationExpired  InvitationStatus = "expired"
+)
+
+// Invitation lets the pending user UserID set its own name and password.
+// Only the hash of the single-use token is stored, TokenHash is set when
+// creating or renewing an invitation.
+type Invitation struct {
+	ID         int64
+	UserID     int64
+	OrgID      int64
+	Email      string
+	InvitedBy  int64
+	TokenHash  string
+	ExpiresAt  time.Time
+	AcceptedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// Status returns the state of the invitation at now.
+func (i *Invitation) Status(now time.Time) InvitationStatus {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	}
+
+	return InvitationPending
+}
+
+// Mailer delivers mail to a single recipient.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidOrganization = errors.New("invalid organization name")
+	ErrNotMember           = errors.New("user is not a member of the organization")
+	ErrOtherTenant         = errors.New("organization belongs to another tenant")
+)
+
+// Organization is a tenant. Users join organizations as members and hold
+// roles per organization, while role definitions are shared by all.
+type Organization struct {
+	ID        int64
+	Name      string
+	CreatedAt time.Time
+}
+
+type tenantKey struct{}
+
+// WithTenant scopes ctx to the organization tenantID. Zero is the platform
+// tenant, which holds the roles assigned outside any organization.
+func WithTenant(ctx context.Context, tenantID int64) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantID returns the organization ctx is scoped to, zero for the
+// platform tenant.
+func TenantID(ctx context.Context) int64 {
+	v, _ := ctx.Value(tenantKey{}).(int64)
+	return v
+}
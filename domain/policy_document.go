@@ -0,0 +1,286 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidPolicyDocument = errors.New("invalid policy document")
+
+// PolicyDocument declares permissions, policies and roles as a whole, so
+// the RBAC setup can be kept in a YAML or JSON file. Every permission,
+// policy and parent a role refers to must be declared in the document.
+type PolicyDocument struct {
+	Permissions []string         `yaml:"permissions" json:"permissions"`
+	Policies    []DocumentPolicy `yaml:"policies,omitempty" json:"policies,omitempty"`
+	Roles       []DocumentRole   `yaml:"roles" json:"roles"`
+}
+
+type DocumentPolicy struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Expression  string `yaml:"expression" json:"expression"`
+}
+
+type DocumentRole struct {
+	Name    string   `yaml:"name" json:"name"`
+	Parents []string `yaml:"parents,omitempty" json:"parents,omitempty"`
+	// Permissions are grants written as [!]permission[@scope][#policy].
+	Permissions []string `yaml:"permissions" json:"permissions"`
+}
+
+// ParsePolicyDocument reads a document written in YAML, or in JSON which
+// YAML accepts as well, and checks its references.
+func ParsePolicyDocument(data []byte) (*PolicyDocument, error) {
+	doc := &PolicyDocument{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicyDocument, err)
+	}
+
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// Validate checks names are unique and every reference is declared.
+func (d *PolicyDocument) Validate() error {
+	permissions := map[string]bool{}
+	for _, v := range d.Permissions {
+		if permissions[v] {
+			return fmt.Errorf("%w: duplicate permission %s", ErrInvalidPolicyDocument, v)
+		}
+
+		permissions[v] = true
+	}
+
+	policies := map[string]bool{}
+	for _, v := range d.Policies {
+		if policies[v.Name] {
+			return fmt.Errorf("%w: duplicate policy %s", ErrInvalidPolicyDocument, v.Name)
+		}
+
+		policies[v.Name] = true
+	}
+
+	roles := map[string]bool{}
+	for _, v := range d.Roles {
+		if roles[v.Name] {
+			return fmt.Errorf("%w: duplicate role %s", ErrInvalidPolicyDocument, v.Name)
+		}
+
+		roles[v.Name] = true
+	}
+
+	for _, role := range d.Roles {
+		for _, v := range role.Parents {
+			if !roles[v] {
+				return fmt.Errorf("%w: role %s inherits undeclared role %s", ErrInvalidPolicyDocument, role.Name, v)
+			}
+		}
+
+		for _, v := range role.Permissions {
+			grant, err := ParseGrant(v)
+			if err != nil {
+				return fmt.Errorf("%w: role %s: %v", ErrInvalidPolicyDocument, role.Name, err)
+			}
+
+			if !permissions[grant.Permission] {
+				return fmt.Errorf("%w: role %s grants undeclared permission %s", ErrInvalidPolicyDocument, role.Name, grant.Permission)
+			}
+
+			if grant.Policy != "" && !policies[grant.Policy] {
+				return fmt.Errorf("%w: role %s uses undeclared policy %s", ErrInvalidPolicyDocument, role.Name, grant.Policy)
+			}
+		}
+	}
+
+	return nil
+}
+
+type PolicyChangeAction string
+
+const (
+	PolicyChangeCreate PolicyChangeAction = "create"
+	PolicyChangeUpdate PolicyChangeAction = "update"
+	PolicyChangeDelete PolicyChangeAction = "delete"
+)
+
+const (
+	PolicyChangePermission = "permission"
+	PolicyChangePolicy     = "policy"
+	PolicyChangeRole       = "role"
+	PolicyChangeParents    = "parents"
+	PolicyChangeGrant      = "grant"
+)
+
+// PolicyChange is one step of applying a policy document. Name is the
+// permission, policy or role changed, and Value the grant for grant changes
+// or the new parents for parent changes.
+type PolicyChange struct {
+	Action PolicyChangeAction
+	Kind   string
+	Name   string
+	Value  string
+}
+
+func (c PolicyChange) String() string {
+	if c.Value == "" {
+		return fmt.Sprintf("%s %s %s", c.Action, c.Kind, c.Name)
+	}
+
+	return fmt.Sprintf("%s %s %s: %s", c.Action, c.Kind, c.Name, c.Value)
+}
+
+// DiffPolicyDocuments lists the changes turning current into desired, in
+// the order they can be applied. Permissions, policies and roles missing
+// from desired are only deleted when prune is set.
+func DiffPolicyDocuments(current, desired *PolicyDocument, prune bool) []PolicyChange {
+	changes := []PolicyChange{}
+
+	permissions := toSet(current.Permissions)
+	for _, v := range desired.Permissions {
+		if !permissions[v] {
+			changes = append(changes, PolicyChange{Action: PolicyChangeCreate, Kind: PolicyChangePermission, Name: v})
+		}
+	}
+
+	policies := map[string]DocumentPolicy{}
+	for _, v := range current.Policies {
+		policies[v.Name] = v
+	}
+
+	for _, v := range desired.Policies {
+		c, ok := policies[v.Name]
+		switch {
+		case !ok:
+			changes = append(changes, PolicyChange{Action: PolicyChangeCreate, Kind: PolicyChangePolicy, Name: v.Name})
+		case c.Description != v.Description || c.Expression != v.Expression:
+			changes = append(changes, PolicyChange{Action: PolicyChangeUpdate, Kind: PolicyChangePolicy, Name: v.Name})
+		}
+	}
+
+	roles := map[string]DocumentRole{}
+	for _, v := range current.Roles {
+		roles[v.Name] = v
+	}
+
+	for _, v := range desired.Roles {
+		if _, ok := roles[v.Name]; !ok {
+			changes = append(changes, PolicyChange{Action: PolicyChangeCreate, Kind: PolicyChangeRole, Name: v.Name})
+		}
+	}
+
+	for _, v := range desired.Roles {
+		c := roles[v.Name]
+
+		if !sameSet(c.Parents, v.Parents) {
+			changes = append(changes, PolicyChange{
+				Action: PolicyChangeUpdate,
+				Kind:   PolicyChangeParents,
+				Name:   v.Name,
+				Value:  strings.Join(sortedCopy(v.Parents), ","),
+			})
+		}
+
+		have := toSet(normalizeGrants(c.Permissions))
+		want := toSet(normalizeGrants(v.Permissions))
+
+		for _, g := range sortedCopy(normalizeGrants(v.Permissions)) {
+			if !have[g] {
+				changes = append(changes, PolicyChange{Action: PolicyChangeCreate, Kind: PolicyChangeGrant, Name: v.Name, Value: g})
+			}
+		}
+
+		for _, g := range sortedCopy(normalizeGrants(c.Permissions)) {
+			if !want[g] {
+				changes = append(changes, PolicyChange{Action: PolicyChangeDelete, Kind: PolicyChangeGrant, Name: v.Name, Value: g})
+			}
+		}
+	}
+
+	if !prune {
+		return changes
+	}
+
+	desiredRoles := map[string]bool{}
+	for _, v := range desired.Roles {
+		desiredRoles[v.Name] = true
+	}
+
+	for _, v := range current.Roles {
+		if !desiredRoles[v.Name] {
+			changes = append(changes, PolicyChange{Action: PolicyChangeDelete, Kind: PolicyChangeRole, Name: v.Name})
+		}
+	}
+
+	desiredPolicies := map[string]bool{}
+	for _, v := range desired.Policies {
+		desiredPolicies[v.Name] = true
+	}
+
+	for _, v := range current.Policies {
+		if !desiredPolicies[v.Name] {
+			changes = append(changes, PolicyChange{Action: PolicyChangeDelete, Kind: PolicyChangePolicy, Name: v.Name})
+		}
+	}
+
+	desiredPermissions := toSet(desired.Permissions)
+	for _, v := range current.Permissions {
+		if !desiredPermissions[v] {
+			changes = append(changes, PolicyChange{Action: PolicyChangeDelete, Kind: PolicyChangePermission, Name: v})
+		}
+	}
+
+	return changes
+}
+
+// normalizeGrants rewrites grants in their canonical form so equal grants
+// compare equal. Invalid grants are kept as they are.
+func normalizeGrants(grants []string) []string {
+	res := make([]string, len(grants))
+	for i := 0; i < len(grants); i++ {
+		res[i] = grants[i]
+		if grant, err := ParseGrant(grants[i]); err == nil {
+			res[i] = grant.String()
+		}
+	}
+
+	return res
+}
+
+func toSet(values []string) map[string]bool {
+	res := make(map[string]bool, len(values))
+	for _, v := range values {
+		res[v] = true
+	}
+
+	return res
+}
+
+func sameSet(a, b []string) bool {
+	x, y := toSet(a), toSet(b)
+	if len(x) != len(y) {
+		return false
+	}
+
+	for v := range x {
+		if !y[v] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortedCopy(values []string) []string {
+	res := append([]string{}, values...)
+	sort.Strings(res)
+
+	return res
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrRegistrationDisabled  = errors.New("registration is disabled")
+	ErrInvalidEmail          = errors.New("invalid email address")
+	ErrEmailDomainNotAllowed = errors.New("email domain is not allowed to register")
+	ErrTooManyRegistrations  = errors.New("too many registrations, try again later")
+	ErrInvalidProofOfWork    = errors.New("invalid or missing proof of work")
+	ErrVerificationInvalid   = errors.New("verification link is invalid, expired or already used")
+	ErrEmailNotVerified      = errors.New("email address is not verified")
+)
+
+// RegistrationMode tells who may sign up through Register.
+type RegistrationMode string
+
+const (
+	RegistrationDisabled RegistrationMode = "disabled"
+	RegistrationOpen     RegistrationMode = "open"
+	// RegistrationDomains only lets addresses of the allowed domains sign
+	// up.
+	RegistrationDomains RegistrationMode = "domains"
+)
+
+// Registration is a sign up attempt. ClientIP and Proof are only used by
+// the registration guard.
+type Registration struct {
+	Name     string
+	Email    string
+	Password string
+	ClientIP string
+	Proof    string
+}
+
+// RegistrationGuard rejects abusive sign up attempts before any account is
+// created, e.g. by rate limit or proof of work.
+type RegistrationGuard interface {
+	Check(ctx context.Context, r *Registration) error
+}
+
+// EmailVerification confirms the address of a registered user. Like
+// invitations, only the hash of the token is stored.
+type EmailVerification struct {
+	UserID    int64
+	TokenHash string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,253 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidTuple      = errors.New("invalid relation tuple, expected namespace:id#relation@subject")
+	ErrUnknownNamespace  = errors.New("unknown namespace")
+	ErrUnknownRelation   = errors.New("unknown relation")
+	ErrInvalidNamespaces = errors.New("invalid namespace config")
+	ErrRelationDepth     = errors.New("relation check exceeds the maximum depth")
+)
+
+type RelationUsecase interface {
+	Check(ctx context.Context, tuple RelationTuple) (bool, error)
+	Expand(ctx context.Context, object Object, relation string) (*SubjectTree, error)
+	ListObjects(ctx context.Context, namespace, relation string, subject Subject) ([]Object, error)
+	WriteTuples(ctx context.Context, writes, deletes []RelationTuple) error
+}
+
+type RelationRepository interface {
+	// WriteTuples deletes then writes tuples in one transaction. Writing an
+	// existing tuple or deleting a missing one is not an error.
+	WriteTuples(ctx context.Context, writes, deletes []RelationTuple) error
+	ReadTuples(ctx context.Context, filter *TupleFilter) ([]RelationTuple, error)
+}
+
+// TupleFilter selects tuples, empty fields match anything. SubjectObject
+// matches the subjects of an object whatever their relation.
+type TupleFilter struct {
+	Namespace     string
+	ObjectID      string
+	Relation      string
+	Subject       *Subject
+	SubjectObject *Object
+}
+
+const (
+	objectMark   = ":"
+	relationMark = "#"
+	subjectMark  = "@"
+)
+
+var relationNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Object is anything relations are defined on, written as namespace:id.
+type Object struct {
+	Namespace string
+	ID        string
+}
+
+func ParseObject(v string) (Object, error) {
+	namespace, id, ok := strings.Cut(v, objectMark)
+	if !ok || !relationNamePattern.MatchString(namespace) || id == "" ||
+		strings.ContainsAny(id, relationMark+subjectMark) {
+		return Object{}, fmt.Errorf("%w: %s", ErrInvalidTuple, v)
+	}
+
+	return Object{
+		Namespace: namespace,
+		ID:        id,
+	}, nil
+}
+
+func (o Object) String() string {
+	return o.Namespace + objectMark + o.ID
+}
+
+// Subject is either an object, e.g. user:1, or the userset of everyone
+// holding Relation on the object, e.g. group:eng#member.
+type Subject struct {
+	Object   Object
+	Relation string
+}
+
+func ParseSubject(v string) (Subject, error) {
+	object, relation, ok := strings.Cut(v, relationMark)
+	if ok && !relationNamePattern.MatchString(relation) {
+		return Subject{}, fmt.Errorf("%w: %s", ErrInvalidTuple, v)
+	}
+
+	o, err := ParseObject(object)
+	if err != nil {
+		return Subject{}, err
+	}
+
+	return Subject{
+		Object:   o,
+		Relation: relation,
+	}, nil
+}
+
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return s.Object.String()
+	}
+
+	return s.Object.String() + relationMark + s.Relation
+}
+
+// RelationTuple states that Subject holds Relation on Object, written as
+// object#relation@subject.
+type RelationTuple struct {
+	Object   Object
+	Relation string
+	Subject  Subject
+}
+
+func ParseRelationTuple(v string) (RelationTuple, error) {
+	left, subject, ok := strings.Cut(v, subjectMark)
+	if !ok {
+		return RelationTuple{}, fmt.Errorf("%w: %s", ErrInvalidTuple, v)
+	}
+
+	object, relation, ok := strings.Cut(left, relationMark)
+	if !ok || !relationNamePattern.MatchString(relation) {
+		return RelationTuple{}, fmt.Errorf("%w: %s", ErrInvalidTuple, v)
+	}
+
+	o, err := ParseObject(object)
+	if err != nil {
+		return RelationTuple{}, err
+	}
+
+	s, err := ParseSubject(subject)
+	if err != nil {
+		return RelationTuple{}, err
+	}
+
+	return RelationTuple{
+		Object:   o,
+		Relation: relation,
+		Subject:  s,
+	}, nil
+}
+
+func (t RelationTuple) String() string {
+	return t.Object.String() + relationMark + t.Relation + subjectMark + t.Subject.String()
+}
+
+// Namespace declares the relations objects of one kind can have.
+type Namespace struct {
+	Name      string     `json:"name"`
+	Relations []Relation `json:"relations"`
+}
+
+// Relation is a named relation. Its subjects are the union of the Rewrite
+// usersets, or only the direct tuples when Rewrite is empty.
+type Relation struct {
+	Name    string    `json:"name"`
+	Rewrite []Userset `json:"rewrite"`
+}
+
+// Userset is one source of subjects for a relation, exactly one field is
+// set:
+//   - This takes the subjects of tuples written for the relation itself.
+//   - ComputedUserset takes the subjects of another relation on the same
+//     object, e.g. every editor is a viewer.
+//   - TupleToUserset follows the objects of the Tupleset relation and takes
+//     their ComputedUserset subjects, e.g. viewers of a document's folder.
+type Userset struct {
+	This            bool            `json:"this,omitempty"`
+	ComputedUserset string          `json:"computed_userset,omitempty"`
+	TupleToUserset  *TupleToUserset `json:"tuple_to_userset,omitempty"`
+}
+
+type TupleToUserset struct {
+	Tupleset        string `json:"tupleset"`
+	ComputedUserset string `json:"computed_userset"`
+}
+
+// ParseNamespaces reads a JSON list of namespaces and checks every rewrite
+// refers to a relation of its namespace.
+func ParseNamespaces(data []byte) ([]Namespace, error) {
+	namespaces := []Namespace{}
+	if err := json.Unmarshal(data, &namespaces); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNamespaces, err)
+	}
+
+	seen := map[string]bool{}
+	for _, ns := range namespaces {
+		if !relationNamePattern.MatchString(ns.Name) || seen[ns.Name] {
+			return nil, fmt.Errorf("%w: namespace %q", ErrInvalidNamespaces, ns.Name)
+		}
+
+		seen[ns.Name] = true
+
+		relations := map[string]bool{}
+		for _, r := range ns.Relations {
+			if !relationNamePattern.MatchString(r.Name) || relations[r.Name] {
+				return nil, fmt.Errorf("%w: relation %s#%q", ErrInvalidNamespaces, ns.Name, r.Name)
+			}
+
+			relations[r.Name] = true
+		}
+
+		for _, r := range ns.Relations {
+			for _, u := range r.Rewrite {
+				if err := validateUserset(u, relations); err != nil {
+					return nil, fmt.Errorf("%w: relation %s#%s %v", ErrInvalidNamespaces, ns.Name, r.Name, err)
+				}
+			}
+		}
+	}
+
+	return namespaces, nil
+}
+
+func validateUserset(u Userset, relations map[string]bool) error {
+	set := 0
+
+	if u.This {
+		set++
+	}
+
+	if u.ComputedUserset != "" {
+		set++
+
+		if !relations[u.ComputedUserset] {
+			return fmt.Errorf("computes unknown relation %s", u.ComputedUserset)
+		}
+	}
+
+	if u.TupleToUserset != nil {
+		set++
+
+		// the computed relation lives on the tupleset objects, which may be
+		// of any namespace, so only the tupleset itself is checked here
+		if !relations[u.TupleToUserset.Tupleset] || u.TupleToUserset.ComputedUserset == "" {
+			return fmt.Errorf("has an invalid tuple_to_userset")
+		}
+	}
+
+	if set != 1 {
+		return fmt.Errorf("userset must set exactly one of this, computed_userset and tuple_to_userset")
+	}
+
+	return nil
+}
+
+// SubjectTree is the expansion of the userset Userset. Subjects are the
+// direct subjects and Children the expansions of the usersets it includes.
+type SubjectTree struct {
+	Userset  Subject
+	Subjects []Subject
+	Children []*SubjectTree
+}
@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidSearchQuery = errors.New("invalid search query")
+
+// MaxSearchTerms and MaxFuzziness keep search queries cheap.
+const (
+	MaxSearchTerms = 10
+	MaxFuzziness   = 2
+)
+
+// SearchField is a field of users searched by text.
+type SearchField string
+
+const (
+	SearchName       SearchField = "name"
+	SearchEmail      SearchField = "email"
+	SearchAttributes SearchField = "attributes"
+)
+
+var SearchFields = []SearchField{SearchName, SearchEmail, SearchAttributes}
+
+// SearchTerm matches the users having Text in one of Fields, or a word
+// starting with it when Prefix is set, or a word at most Fuzziness edits
+// away from it.
+type SearchTerm struct {
+	Text      string
+	Fields    []SearchField
+	Prefix    bool
+	Fuzziness int
+}
+
+// UserSearcher keeps a full-text index of users. Searches only find the
+// users of the tenant of their context, see WithTenant.
+type UserSearcher interface {
+	// Index adds users to the index or updates them, OrgIDs included.
+	Index(ctx context.Context, users []*User) error
+	Remove(ctx context.Context, ids []int64) error
+	// Search returns the IDs of at most limit users matching every term,
+	// best match first.
+	Search(ctx context.Context, terms []SearchTerm, limit int) ([]int64, error)
+}
+
+// ParseSearchQuery parses space separated terms, each optionally limited to
+// a field and ending with * for a prefix or ~ for a fuzzy match, e.g.
+// `ali* email:example.com department:sales~1` where unknown fields are
+// read as text.
+func ParseSearchQuery(query string) ([]SearchTerm, error) {
+	words := strings.Fields(query)
+	if len(words) > MaxSearchTerms {
+		return nil, fmt.Errorf("%w: more than %d terms", ErrInvalidSearchQuery, MaxSearchTerms)
+	}
+
+	res := []SearchTerm{}
+
+	for _, v := range words {
+		term := SearchTerm{Text: v, Fields: SearchFields}
+
+		if field, text, ok := strings.Cut(v, ":"); ok && isSearchField(field) {
+			term.Text = text
+			term.Fields = []SearchField{SearchField(field)}
+		}
+
+		if text, fuzziness, ok := strings.Cut(term.Text, "~"); ok {
+			term.Text = text
+			term.Fuzziness = 1
+
+			if fuzziness != "" {
+				n, err := strconv.Atoi(fuzziness)
+				if err != nil || n < 0 || n > MaxFuzziness {
+					return nil, fmt.Errorf("%w: fuzziness must be 0 to %d", ErrInvalidSearchQuery, MaxFuzziness)
+				}
+
+				term.Fuzziness = n
+			}
+		}
+
+		if strings.HasSuffix(term.Text, "*") {
+			term.Text = strings.TrimSuffix(term.Text, "*")
+			term.Prefix = true
+		}
+
+		if term.Text == "" {
+			return nil, fmt.Errorf("%w: empty term %s", ErrInvalidSearchQuery, v)
+		}
+
+		if term.Prefix && term.Fuzziness > 0 {
+			return nil, fmt.Errorf("%w: %s is both a prefix and fuzzy", ErrInvalidSearchQuery, v)
+		}
+
+		res = append(res, term)
+	}
+
+	return res, nil
+}
+
+func isSearchField(field string) bool {
+	for _, v := range SearchFields {
+		if string(v) == field {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,15 +1,108 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidRoleName       = errors.New("invalid role name")
+	ErrInvalidPermissionName = errors.New("invalid permission name, expected [!]resource:action")
+	ErrPermissionNotFound    = errors.New("permission not found")
+	ErrInvalidPolicy         = errors.New("invalid policy")
+	ErrPolicyNotFound        = errors.New("policy not found")
+	ErrPolicyInUse           = errors.New("policy is still used by role permissions")
+	ErrInvalidScope          = errors.New("invalid scope, expected self, users:<id>,<id> or groups:<id>,<id>")
+	ErrRoleInUse             = errors.New("role is still assigned to users")
+	ErrRoleNotFound          = errors.New("role not found")
+	ErrRoleCycle             = errors.New("role inheritance cycle")
+	ErrRoleEscalation        = errors.New("cannot assign, revoke or inherit a role you do not hold")
+	ErrPermissionEscalation  = errors.New("cannot grant a permission you do not hold")
+	ErrNotGranted            = errors.New("not granted")
+	ErrInvalidConstraint     = errors.New("invalid role constraint, expected a name and at least two roles")
+	ErrRoleConflict          = errors.New("roles are mutually exclusive")
+	ErrUserNotActive         = errors.New("user is not active")
+	ErrInvalidTransition     = errors.New("invalid user status transition")
+	ErrSelfStatusChange      = errors.New("cannot change your own status")
+	ErrEmailInUse            = errors.New("email is used by another user")
+	ErrInvalidFilter         = errors.New("invalid filter")
+	ErrInvalidOrderBy        = errors.New("invalid order_by")
+	ErrInvalidReadMask       = errors.New("invalid read mask")
+)
 
 type UserUsecase interface {
 	GetUsers(ctx context.Context, params *GetUsersParams) ([]*User, *PaginationInfo, error)
 	GetUserByIdentifier(ctx context.Context, identifier string, value interface{}) (*User, error)
 	CreateUser(ctx context.Context, data *User) (int64, error)
 	UpdateUser(ctx context.Context, data *User) error
+	// DeleteUser soft deletes the user, which may be restored until it is
+	// purged.
 	DeleteUser(ctx context.Context, id int64) error
+	RestoreUser(ctx context.Context, id int64) error
+	// PurgeDeletedUsers permanently removes the users deleted for longer
+	// than the retention.
+	PurgeDeletedUsers(ctx context.Context) error
+	// ReindexUsers adds every user to the search index, see UserSearcher.
+	ReindexUsers(ctx context.Context) error
+	AssignRoles(ctx context.Context, userID int64, roles []string) error
+	RevokeRoles(ctx context.Context, userID int64, roles []string) error
 	GetRoles(ctx context.Context) ([]*Role, error)
+	CreateRole(ctx context.Context, data *Role) (int64, error)
+	UpdateRole(ctx context.Context, data *Role) error
+	DeleteRole(ctx context.Context, id int64) error
+	ListPermissions(ctx context.Context) ([]*Permission, error)
+	CreatePermission(ctx context.Context, name string) (int64, error)
+	SetRoleParents(ctx context.Context, roleID int64, parents []string) error
+	AttachPermissions(ctx context.Context, roleID int64, permissions []string) error
+	DetachPermissions(ctx context.Context, roleID int64, permissions []string) error
+	ListPolicies(ctx context.Context) ([]*Policy, error)
+	CreatePolicy(ctx context.Context, data *Policy) (int64, error)
+	UpdatePolicy(ctx context.Context, data *Policy) error
+	DeletePolicy(ctx context.Context, id int64) error
+	ListRoleConstraints(ctx context.Context) ([]*RoleConstraint, error)
+	CreateRoleConstraint(ctx context.Context, data *RoleConstraint) (int64, error)
+	DeleteRoleConstraint(ctx context.Context, id int64) error
+	GetConstraintViolations(ctx context.Context) ([]*ConstraintViolation, error)
+	ExportPolicy(ctx context.Context) (*PolicyDocument, error)
+	// ApplyPolicy brings the database in line with doc and returns the
+	// changes made, or only plans them when dryRun is set.
+	ApplyPolicy(ctx context.Context, doc *PolicyDocument, prune, dryRun bool) ([]PolicyChange, error)
+	RequestElevation(ctx context.Context, data *Elevation) (int64, error)
+	ListElevations(ctx context.Context) ([]*Elevation, error)
+	ApproveElevation(ctx context.Context, id int64) error
+	SweepExpiredRoles(ctx context.Context) error
+	ListOrganizations(ctx context.Context) ([]*Organization, error)
+	CreateOrganization(ctx context.Context, data *Organization) (int64, error)
+	AddMember(ctx context.Context, orgID, userID int64, roles []string) error
+	RemoveMember(ctx context.Context, orgID, userID int64) error
+	ListGroups(ctx context.Context) ([]*Group, error)
+	CreateGroup(ctx context.Context, data *Group) (int64, error)
+	DeleteGroup(ctx context.Context, id int64) error
+	GetGroupMembers(ctx context.Context, groupID int64) ([]*User, error)
+	AddGroupMembers(ctx context.Context, groupID int64, userIDs []int64) error
+	RemoveGroupMembers(ctx context.Context, groupID int64, userIDs []int64) error
+	AssignGroupRoles(ctx context.Context, groupID int64, roles []string) error
+	RevokeGroupRoles(ctx context.Context, groupID int64, roles []string) error
+	SuspendUser(ctx context.Context, id int64, reason string, until *time.Time) error
+	ReactivateUser(ctx context.Context, id int64, reason string) error
+	DeactivateUser(ctx context.Context, id int64, reason string) error
+	// CheckActive makes sure userID may still act, returning
+	// ErrUserNotActive otherwise.
+	CheckActive(ctx context.Context, userID int64) error
+	// InviteUser creates a pending user holding roles and mails it a link
+	// to accept the invitation. The invitation is revoked when the mail
+	// cannot be sent.
+	InviteUser(ctx context.Context, email string, roles []string) (int64, error)
+	ListInvitations(ctx context.Context) ([]*Invitation, error)
+	ResendInvitation(ctx context.Context, id int64) error
+	RevokeInvitation(ctx context.Context, id int64) error
+	ListAttributeDefinitions(ctx context.Context) ([]*AttributeDefinition, error)
+	CreateAttributeDefinition(ctx context.Context, data *AttributeDefinition) (int64, error)
+	// DeleteAttributeDefinition also removes the attribute from every user.
+	DeleteAttributeDefinition(ctx context.Context, id int64) error
 	Granted(ctx context.Context, userID int64, permissions []string) error
+	Authorize(ctx context.Context, params *AuthorizeParams) (*Decision, error)
 }
 
 type UserRepository interface {
@@ -18,8 +111,104 @@ type UserRepository interface {
 	CreateUser(ctx context.Context, data *User) (int64, error)
 	UpdateUser(ctx context.Context, data *User) error
 	DeleteUser(ctx context.Context, id int64) error
+	// RestoreUser undeletes the user, returning ErrEmailInUse when another
+	// user took its email meanwhile.
+	RestoreUser(ctx context.Context, id int64) error
+	// PurgeDeletedUsers permanently removes the users deleted earlier than
+	// before, along with their roles and memberships, and returns their IDs.
+	PurgeDeletedUsers(ctx context.Context, before time.Time) ([]int64, error)
+	AssignRoles(ctx context.Context, userID int64, roles []string, grant RoleGrant) error
+	RevokeRoles(ctx context.Context, userID int64, roles []string) error
 	GetRoles(ctx context.Context) ([]*Role, error)
+	CreateRole(ctx context.Context, data *Role) (int64, error)
+	UpdateRole(ctx context.Context, data *Role) error
+	DeleteRole(ctx context.Context, id int64) error
+	ListPermissions(ctx context.Context) ([]*Permission, error)
+	CreatePermission(ctx context.Context, name string) (int64, error)
+	SetRoleParents(ctx context.Context, roleID int64, parents []string) error
+	AttachPermissions(ctx context.Context, roleID int64, permissions []string) error
+	DetachPermissions(ctx context.Context, roleID int64, permissions []string) error
+	ListPolicies(ctx context.Context) ([]*Policy, error)
+	GetPoliciesByName(ctx context.Context, names []string) ([]*Policy, error)
+	CreatePolicy(ctx context.Context, data *Policy) (int64, error)
+	UpdatePolicy(ctx context.Context, data *Policy) error
+	DeletePolicy(ctx context.Context, id int64) error
+	ListRoleConstraints(ctx context.Context) ([]*RoleConstraint, error)
+	CreateRoleConstraint(ctx context.Context, data *RoleConstraint) (int64, error)
+	DeleteRoleConstraint(ctx context.Context, id int64) error
+	// GetConstraintViolations lists the users holding roles a constraint
+	// keeps apart, which role assignment prevents but inheritance changes
+	// and constraints created later do not.
+	GetConstraintViolations(ctx context.Context) ([]*ConstraintViolation, error)
+	ExportPolicy(ctx context.Context) (*PolicyDocument, error)
+	ApplyPolicy(ctx context.Context, doc *PolicyDocument, prune, dryRun bool) ([]PolicyChange, error)
+	CreateElevation(ctx context.Context, data *Elevation) (int64, error)
+	GetElevation(ctx context.Context, id int64) (*Elevation, error)
+	ListElevations(ctx context.Context, status ElevationStatus) ([]*Elevation, error)
+	ApproveElevation(ctx context.Context, id, approverID int64) error
+	// DeleteExpiredRoles removes role grants expired at now and returns the
+	// users who lost roles.
+	DeleteExpiredRoles(ctx context.Context, now time.Time) ([]int64, error)
+	ListOrganizations(ctx context.Context) ([]*Organization, error)
+	CreateOrganization(ctx context.Context, data *Organization) (int64, error)
+	AddMember(ctx context.Context, orgID, userID int64, roles []string, grant RoleGrant) error
+	RemoveMember(ctx context.Context, orgID, userID int64) error
+	IsMember(ctx context.Context, orgID, userID int64) (bool, error)
+	// GetUserOrganizations returns the organizations each of userIDs is a
+	// member of.
+	GetUserOrganizations(ctx context.Context, userIDs []int64) (map[int64][]int64, error)
+	ListGroups(ctx context.Context) ([]*Group, error)
+	GetGroup(ctx context.Context, id int64) (*Group, error)
+	CreateGroup(ctx context.Context, data *Group) (int64, error)
+	DeleteGroup(ctx context.Context, id int64) error
+	GetGroupMembers(ctx context.Context, groupID int64) ([]*User, error)
+	AddGroupMembers(ctx context.Context, groupID int64, userIDs []int64) error
+	RemoveGroupMembers(ctx context.Context, groupID int64, userIDs []int64) error
+	AssignGroupRoles(ctx context.Context, groupID int64, roles []string) error
+	RevokeGroupRoles(ctx context.Context, groupID int64, roles []string) error
+	// GetUserGroupIDs returns the groups of the tenant of ctx userID is a
+	// member of.
+	GetUserGroupIDs(ctx context.Context, userID int64) ([]int64, error)
+	// SetUserStatus applies change to user id, which must currently have
+	// the status from.
+	SetUserStatus(ctx context.Context, id int64, from UserStatus, change *StatusChange) error
+	// RecordLoginFailure counts a failed login of user id, locking it with
+	// lock once max failures in a row are reached. Zero max never locks.
+	RecordLoginFailure(ctx context.Context, id int64, max int, lock *StatusChange) error
+	// RecordLogin stores the time of a successful login of user id and
+	// resets its failed logins.
+	RecordLogin(ctx context.Context, id int64, at time.Time) error
+	// CreateInvitation creates the pending user, assigns it roles and
+	// stores the invitation, returning the invitation ID.
+	CreateInvitation(ctx context.Context, user *User, roles []string, data *Invitation) (int64, error)
+	GetInvitation(ctx context.Context, id int64) (*Invitation, error)
+	ListInvitations(ctx context.Context) ([]*Invitation, error)
+	// RenewInvitation replaces the token of a pending invitation.
+	RenewInvitation(ctx context.Context, id int64, tokenHash string, expiresAt time.Time) error
+	// RevokeInvitation cancels a pending invitation and deletes its user.
+	RevokeInvitation(ctx context.Context, id int64) error
+	// AcceptInvitation activates the user of the invitation with the token
+	// hash tokenHash, setting the name and password of user, and returns
+	// its ID.
+	AcceptInvitation(ctx context.Context, tokenHash string, user *User, now time.Time) (int64, error)
+	// RegisterUser creates user holding roles, along with its email
+	// verification unless verification is nil.
+	RegisterUser(ctx context.Context, user *User, roles []string, verification *EmailVerification) (int64, error)
+	// CancelRegistration removes the user id while still unverified, along
+	// with its roles and email verifications.
+	CancelRegistration(ctx context.Context, id int64) error
+	// VerifyEmail activates the unverified user of the verification with
+	// the token hash tokenHash.
+	VerifyEmail(ctx context.Context, tokenHash string, now time.Time) error
+	ListAttributeDefinitions(ctx context.Context) ([]*AttributeDefinition, error)
+	CreateAttributeDefinition(ctx context.Context, data *AttributeDefinition) (int64, error)
+	DeleteAttributeDefinition(ctx context.Context, id int64) error
+	// AttributeValueTaken tells whether a user other than userID holds
+	// value for the attribute name, in any tenant.
+	AttributeValueTaken(ctx context.Context, name string, value interface{}, userID int64) (bool, error)
 	GetPermissionsByRole(ctx context.Context, roleNames []string) ([]string, error)
+	GetGrantsByRole(ctx context.Context, roleNames []string) ([]Grant, error)
+	GetPermissionVersion(ctx context.Context, userID int64) (int64, error)
 	Seeding(ctx context.Context) error
 }
 
@@ -28,16 +217,213 @@ type User struct {
 	Name     string
 	Email    string
 	Password string
-	Roles    []string
+	Status   UserStatus
+	// StatusReason tells why the status was last changed and StatusUntil
+	// when a suspension or lock ends, nil for indefinitely.
+	StatusReason string
+	StatusUntil  *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	// LastLoginAt and PasswordChangedAt are nil when the user never signed
+	// in or never set a password.
+	LastLoginAt       *time.Time
+	PasswordChangedAt *time.Time
+	// DeletedAt is set for deleted users, which may be restored until
+	// they are purged.
+	DeletedAt *time.Time
+	// Attributes are the custom attributes of the user, see
+	// AttributeDefinition.
+	Attributes map[string]interface{}
+	// Roles are the roles assigned to the user directly.
+	Roles []string
+	// Groups are the groups the user is a member of and GroupRoles the
+	// roles it holds through them.
+	Groups            []string
+	GroupRoles        []string
+	PermissionVersion int64
+	// OrgIDs are the organizations the user is a member of, only loaded
+	// for the search index.
+	OrgIDs []int64
+}
+
+// EffectiveStatus returns the status of the user at now, which is active
+// again once a suspension or lock has ended.
+func (u *User) EffectiveStatus(now time.Time) UserStatus {
+	if (u.Status == UserSuspended || u.Status == UserLocked) && u.StatusUntil != nil && !now.Before(*u.StatusUntil) {
+		return UserActive
+	}
+
+	return u.Status
+}
+
+// AllRoles returns every role the user holds, directly or through groups.
+func (u *User) AllRoles() []string {
+	res := []string{}
+	seen := map[string]bool{}
+
+	for _, v := range append(append([]string{}, u.Roles...), u.GroupRoles...) {
+		if !seen[v] {
+			seen[v] = true
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// UserStatus tells whether a user may sign in. Invited users stay pending
+// until they accept their invitation and registered users unverified until
+// they confirm their address, when required.
+type UserStatus string
+
+const (
+	UserActive     UserStatus = "active"
+	UserPending    UserStatus = "pending"
+	UserUnverified UserStatus = "unverified"
+	// UserSuspended is set by an administrator, UserLocked after too many
+	// failed logins. Both may end at a given time.
+	UserSuspended   UserStatus = "suspended"
+	UserLocked      UserStatus = "locked"
+	UserDeactivated UserStatus = "deactivated"
+)
+
+// userStatusTransitions lists the statuses each status may change to.
+// Pending and unverified users only become active through their invitation
+// or verification.
+var userStatusTransitions = map[UserStatus][]UserStatus{
+	UserPending:     {UserActive},
+	UserUnverified:  {UserActive},
+	UserActive:      {UserSuspended, UserLocked, UserDeactivated},
+	UserSuspended:   {UserActive, UserDeactivated},
+	UserLocked:      {UserActive, UserSuspended, UserDeactivated},
+	UserDeactivated: {UserActive},
+}
+
+// CanTransitionTo tells whether a user may change from s to status.
+func (s UserStatus) CanTransitionTo(status UserStatus) bool {
+	for _, v := range userStatusTransitions[s] {
+		if v == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Valid tells whether s is a known status.
+func (s UserStatus) Valid() bool {
+	_, ok := userStatusTransitions[s]
+	return ok
+}
+
+// StatusChange moves a user to Status for Reason, until Until when set.
+// ChangedBy is zero for the system.
+type StatusChange struct {
+	Status    UserStatus
+	Reason    string
+	Until     *time.Time
+	ChangedBy int64
 }
 
 type Role struct {
+	ID          int64
 	Name        string
 	Permissions []string
+	// Parents are the roles this role inherits permissions from.
+	Parents []string
+	// EffectivePermissions include the permissions inherited from parents.
+	EffectivePermissions []string
+}
+
+// RoleConstraint keeps Roles mutually exclusive: nobody may hold more than
+// one of them, directly or through inheritance.
+type RoleConstraint struct {
+	ID    int64
+	Name  string
+	Roles []string
+}
+
+// ConstraintViolation tells that UserID holds Roles kept apart by
+// Constraint in the organization OrgID.
+type ConstraintViolation struct {
+	UserID     int64
+	OrgID      int64
+	Constraint string
+	Roles      []string
+}
+
+type Permission struct {
+	ID   int64
+	Name string
 }
 
 type GetUsersParams struct {
+	// Page numbers the page of PageSize users to list. Zero follows
+	// PageToken instead, starting with the first page when it is empty.
 	Page     int32
 	PageSize int32
-	Keyword  string
+	// PageToken is the NextPageToken of the previous page, only valid for
+	// the same parameters apart from PageSize, Fields and CountTotal.
+	PageToken string
+	// Cursor is read from PageToken by the usecase.
+	Cursor Cursor
+	// CountTotal counts the users when following page tokens, numbered
+	// pages are always counted.
+	CountTotal bool
+	// Keyword is a full-text search, see ParseSearchQuery. Users are
+	// ordered by relevance unless OrderBy is set.
+	Keyword string
+	// SearchIDs are the users matching Keyword, best match first, found by
+	// the usecase. Nil lists every user.
+	SearchIDs []int64
+	// OrgID lists the members of an organization, zero lists the users of
+	// the caller's tenant.
+	OrgID int64
+	// Status only lists users having that effective status when set.
+	Status UserStatus
+	// IncludeDeleted lists deleted users too.
+	IncludeDeleted bool
+	// Attributes only lists users whose custom attributes have the given
+	// values, compared as text.
+	Attributes map[string]string
+	// TimeRanges only lists users whose time fields are within the ranges.
+	TimeRanges map[UserTimeField]TimeRange
+	// Filter is an AIP-160 filter on the fields id, name, email, status,
+	// role, the timestamps and attributes.<name>, e.g.
+	// `status = active AND created_at >= "2024-01-01T00:00:00Z"`.
+	Filter string
+	// OrderBy sorts by a comma separated list of the fields id, name,
+	// email, status and the timestamps, each optionally followed by asc or
+	// desc. Users are ordered by descending ID last.
+	OrderBy string
+	// Fields are the fields of the users needed, named as in Filter along
+	// with roles, groups, group_roles, status_reason, status_until and
+	// deleted_at. Every field is loaded when empty.
+	Fields []string
+}
+
+// UserTimeField names a timestamp of users.
+type UserTimeField string
+
+const (
+	UserCreatedAt         UserTimeField = "created_at"
+	UserUpdatedAt         UserTimeField = "updated_at"
+	UserLastLoginAt       UserTimeField = "last_login_at"
+	UserPasswordChangedAt UserTimeField = "password_changed_at"
+)
+
+func (f UserTimeField) Valid() bool {
+	switch f {
+	case UserCreatedAt, UserUpdatedAt, UserLastLoginAt, UserPasswordChangedAt:
+		return true
+	}
+
+	return false
+}
+
+// TimeRange matches times from After, inclusive, to Before, exclusive.
+// Either bound may be nil.
+type TimeRange struct {
+	After  *time.Time
+	Before *time.Time
 }
@@ -1,16 +1,23 @@
 package grpc
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/adetxt/user/domain"
 	pbAccount "github.com/adetxt/user/gen/proto/go/account/v1"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gopkg.in/yaml.v3"
 	"gorm.io/gorm"
 )
 
@@ -26,20 +33,18 @@ func NewAccountHandler(userUsecase domain.UserUsecase) pbAccount.AccountServiceS
 }
 
 func (h *accountHandler) GetUsers(ctx context.Context, req *pbAccount.GetUsersRequest) (*pbAccount.GetUsersResponse, error) {
-	c := getTokenInfo(ctx)
-
-	id, err := strconv.ParseInt(c.ID, 10, 64)
-	if err != nil {
-		return nil, err
+	// pages are numbered unless following a page token, which zero does
+	page := 1
+	if req.Page > 0 {
+		page = int(req.Page)
 	}
 
-	if err := h.userUsecase.Granted(ctx, id, []string{"user:list"}); err != nil {
-		return nil, status.Error(codes.PermissionDenied, err.Error())
-	}
+	if req.PageToken != "" {
+		if req.Page > 0 {
+			return nil, status.Error(codes.InvalidArgument, "page and page_token cannot be used together")
+		}
 
-	page := 1
-	if req.Page > 1 {
-		page = int(req.Page)
+		page = 0
 	}
 
 	pageSize := 10
@@ -47,45 +52,61 @@ func (h *accountHandler) GetUsers(ctx context.Context, req *pbAccount.GetUsersRe
 		pageSize = int(req.PageSize)
 	}
 
+	if req.Status != "" && !domain.UserStatus(req.Status).Valid() {
+		return nil, status.Error(codes.InvalidArgument, "invalid status")
+	}
+
+	timeRanges, err := userTimeRanges(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// the deprecated fields overlap the filter, so only one of them may be
+	// used
+	if req.Filter != "" && (req.Status != "" || len(timeRanges) > 0 || len(req.Attributes) > 0) {
+		return nil, status.Error(codes.InvalidArgument, "filter cannot be used with status, the time ranges or attributes")
+	}
+
+	fields, err := userReadMask(req.ReadMask)
+	if err != nil {
+		return nil, err
+	}
+
 	users, pagination, err := h.userUsecase.GetUsers(ctx, &domain.GetUsersParams{
-		Page:     int32(page),
-		PageSize: int32(pageSize),
-		Keyword:  req.Keyword,
+		Page:           int32(page),
+		PageSize:       int32(pageSize),
+		Keyword:        req.Keyword,
+		OrgID:          int64(req.OrganizationId),
+		Status:         domain.UserStatus(req.Status),
+		IncludeDeleted: req.IncludeDeleted,
+		TimeRanges:     timeRanges,
+		Attributes:     req.Attributes,
+		Filter:         req.Filter,
+		OrderBy:        req.OrderBy,
+		Fields:         fields,
+		PageToken:      req.PageToken,
+		CountTotal:     req.IncludeTotal,
 	})
 	if err != nil {
-		return nil, err
+		return nil, rbacError(err)
 	}
 
 	resUsers := make([]*pbAccount.User, len(users))
 	for i := 0; i < len(users); i++ {
-		resUsers[i] = &pbAccount.User{
-			Id:    int32(users[i].ID),
-			Name:  users[i].Name,
-			Email: users[i].Email,
-			Roles: users[i].Roles,
-		}
+		resUsers[i] = toPbUser(users[i])
+		maskUser(resUsers[i], fields)
 	}
 
 	return &pbAccount.GetUsersResponse{
-		Items:    resUsers,
-		Page:     int32(page),
-		PageSize: int32(pageSize),
-		Total:    int32(pagination.TotalData),
+		Items:         resUsers,
+		Page:          int32(page),
+		PageSize:      int32(pageSize),
+		Total:         int32(pagination.TotalData),
+		NextPageToken: pagination.NextPageToken,
 	}, nil
 }
 
 func (h *accountHandler) GetUser(ctx context.Context, req *pbAccount.GetUserRequest) (*pbAccount.GetUserResponse, error) {
-	c := getTokenInfo(ctx)
-
-	id, err := strconv.ParseInt(c.ID, 10, 64)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := h.userUsecase.Granted(ctx, id, []string{"user:detail"}); err != nil {
-		return nil, status.Error(codes.PermissionDenied, err.Error())
-	}
-
 	identifier := ""
 	var value interface{}
 
@@ -109,12 +130,7 @@ func (h *accountHandler) GetUser(ctx context.Context, req *pbAccount.GetUserRequ
 	}
 
 	return &pbAccount.GetUserResponse{
-		User: &pbAccount.User{
-			Id:    int32(user.ID),
-			Name:  user.Name,
-			Email: user.Email,
-			Roles: user.Roles,
-		},
+		User: toPbUser(user),
 	}, nil
 }
 
@@ -136,27 +152,11 @@ func (h *accountHandler) GetCurrentUser(ctx context.Context, req *emptypb.Empty)
 	}
 
 	return &pbAccount.GetUserResponse{
-		User: &pbAccount.User{
-			Id:    int32(user.ID),
-			Name:  user.Name,
-			Email: user.Email,
-			Roles: user.Roles,
-		},
+		User: toPbUser(user),
 	}, nil
 }
 
 func (h *accountHandler) CreateUser(ctx context.Context, req *pbAccount.CreateUserRequest) (*pbAccount.CreateUserResponse, error) {
-	c := getTokenInfo(ctx)
-
-	id, err := strconv.ParseInt(c.ID, 10, 64)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := h.userUsecase.Granted(ctx, id, []string{"user:create"}); err != nil {
-		return nil, status.Error(codes.PermissionDenied, err.Error())
-	}
-
 	if req.Name == "" {
 		return nil, status.Error(codes.InvalidArgument, "name is required")
 	}
@@ -173,13 +173,14 @@ func (h *accountHandler) CreateUser(ctx context.Context, req *pbAccount.CreateUs
 		return nil, status.Error(codes.InvalidArgument, "password is not the same")
 	}
 
-	id, err = h.userUsecase.CreateUser(ctx, &domain.User{
-		Name:     req.Name,
-		Email:    req.Email,
-		Password: req.Password,
+	id, err := h.userUsecase.CreateUser(ctx, &domain.User{
+		Name:       req.Name,
+		Email:      req.Email,
+		Password:   req.Password,
+		Attributes: attributesMap(req.Attributes),
 	})
 	if err != nil {
-		return nil, err
+		return nil, rbacError(err)
 	}
 
 	return &pbAccount.CreateUserResponse{
@@ -188,17 +189,6 @@ func (h *accountHandler) CreateUser(ctx context.Context, req *pbAccount.CreateUs
 }
 
 func (h *accountHandler) UpdateUser(ctx context.Context, req *pbAccount.UpdateUserRequest) (*emptypb.Empty, error) {
-	c := getTokenInfo(ctx)
-
-	id, err := strconv.ParseInt(c.ID, 10, 64)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := h.userUsecase.Granted(ctx, id, []string{"user:update"}); err != nil {
-		return nil, status.Error(codes.PermissionDenied, err.Error())
-	}
-
 	if req.Id < 1 {
 		return nil, status.Error(codes.InvalidArgument, "id is required")
 	}
@@ -208,11 +198,25 @@ func (h *accountHandler) UpdateUser(ctx context.Context, req *pbAccount.UpdateUs
 	}
 
 	if err := h.userUsecase.UpdateUser(ctx, &domain.User{
-		ID:       int64(req.Id),
-		Name:     req.Name,
-		Email:    req.Email,
-		Password: req.Password,
+		ID:         int64(req.Id),
+		Name:       req.Name,
+		Email:      req.Email,
+		Password:   req.Password,
+		Roles:      req.Roles,
+		Attributes: attributesMap(req.Attributes),
 	}); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) DeleteUser(ctx context.Context, req *pbAccount.DeleteUserRequest) (*emptypb.Empty, error) {
+	if req.Id < 1 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := h.userUsecase.DeleteUser(ctx, int64(req.Id)); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, status.Error(codes.NotFound, "record not found")
 		}
@@ -223,28 +227,95 @@ func (h *accountHandler) UpdateUser(ctx context.Context, req *pbAccount.UpdateUs
 	return &emptypb.Empty{}, nil
 }
 
-func (h *accountHandler) DeleteUser(ctx context.Context, req *pbAccount.DeleteUserRequest) (*emptypb.Empty, error) {
-	c := getTokenInfo(ctx)
-
-	id, err := strconv.ParseInt(c.ID, 10, 64)
-	if err != nil {
-		return nil, err
+func (h *accountHandler) RestoreUser(ctx context.Context, req *pbAccount.RestoreUserRequest) (*emptypb.Empty, error) {
+	if req.Id < 1 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
 	}
 
-	if err := h.userUsecase.Granted(ctx, id, []string{"user:delete"}); err != nil {
-		return nil, status.Error(codes.PermissionDenied, err.Error())
+	if err := h.userUsecase.RestoreUser(ctx, int64(req.Id)); err != nil {
+		if errors.Is(err, domain.ErrEmailInUse) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+
+		return nil, rbacError(err)
 	}
 
-	if req.Id < 1 {
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) SuspendUser(ctx context.Context, req *pbAccount.SuspendUserRequest) (*emptypb.Empty, error) {
+	if req.Id == 0 {
 		return nil, status.Error(codes.InvalidArgument, "id is required")
 	}
 
-	if err := h.userUsecase.DeleteUser(ctx, int64(req.Id)); err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, status.Error(codes.NotFound, "record not found")
+	var until *time.Time
+	if req.Until != "" {
+		t, err := time.Parse(time.RFC3339, req.Until)
+		if err != nil || !t.After(time.Now()) {
+			return nil, status.Error(codes.InvalidArgument, "until must be a future RFC 3339 time")
 		}
 
-		return nil, err
+		until = &t
+	}
+
+	if err := h.userUsecase.SuspendUser(ctx, int64(req.Id), req.Reason, until); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) ReactivateUser(ctx context.Context, req *pbAccount.UserStatusRequest) (*emptypb.Empty, error) {
+	if req.Id == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := h.userUsecase.ReactivateUser(ctx, int64(req.Id), req.Reason); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) DeactivateUser(ctx context.Context, req *pbAccount.UserStatusRequest) (*emptypb.Empty, error) {
+	if req.Id == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := h.userUsecase.DeactivateUser(ctx, int64(req.Id), req.Reason); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) AssignRoles(ctx context.Context, req *pbAccount.AssignRolesRequest) (*emptypb.Empty, error) {
+	if req.UserId < 1 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if len(req.Roles) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "roles is required")
+	}
+
+	if err := h.userUsecase.AssignRoles(ctx, int64(req.UserId), req.Roles); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) RevokeRoles(ctx context.Context, req *pbAccount.RevokeRolesRequest) (*emptypb.Empty, error) {
+	if req.UserId < 1 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if len(req.Roles) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "roles is required")
+	}
+
+	if err := h.userUsecase.RevokeRoles(ctx, int64(req.UserId), req.Roles); err != nil {
+		return nil, rbacError(err)
 	}
 
 	return &emptypb.Empty{}, nil
@@ -259,8 +330,11 @@ func (h *accountHandler) GetRoles(ctx context.Context, req *emptypb.Empty) (*pbA
 	res := make([]*pbAccount.Role, len(roles))
 	for i := 0; i < len(roles); i++ {
 		res[i] = &pbAccount.Role{
-			Name:        roles[i].Name,
-			Permissions: roles[i].Permissions,
+			Id:                   int32(roles[i].ID),
+			Name:                 roles[i].Name,
+			Permissions:          roles[i].Permissions,
+			Parents:              roles[i].Parents,
+			EffectivePermissions: roles[i].EffectivePermissions,
 		}
 	}
 
@@ -268,3 +342,928 @@ func (h *accountHandler) GetRoles(ctx context.Context, req *emptypb.Empty) (*pbA
 		Items: res,
 	}, nil
 }
+
+func (h *accountHandler) CreateRole(ctx context.Context, req *pbAccount.CreateRoleRequest) (*pbAccount.CreateRoleResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	id, err := h.userUsecase.CreateRole(ctx, &domain.Role{
+		Name:        req.Name,
+		Permissions: req.Permissions,
+		Parents:     req.Parents,
+	})
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &pbAccount.CreateRoleResponse{
+		Id: int32(id),
+	}, nil
+}
+
+func (h *accountHandler) UpdateRole(ctx context.Context, req *pbAccount.UpdateRoleRequest) (*emptypb.Empty, error) {
+	if req.Id < 1 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if err := h.userUsecase.UpdateRole(ctx, &domain.Role{
+		ID:   int64(req.Id),
+		Name: req.Name,
+	}); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) DeleteRole(ctx context.Context, req *pbAccount.DeleteRoleRequest) (*emptypb.Empty, error) {
+	if req.Id < 1 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := h.userUsecase.DeleteRole(ctx, int64(req.Id)); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) SetRoleParents(ctx context.Context, req *pbAccount.SetRoleParentsRequest) (*emptypb.Empty, error) {
+	if req.RoleId < 1 {
+		return nil, status.Error(codes.InvalidArgument, "role_id is required")
+	}
+
+	if err := h.userUsecase.SetRoleParents(ctx, int64(req.RoleId), req.Parents); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) ListPermissions(ctx context.Context, req *emptypb.Empty) (*pbAccount.ListPermissionsResponse, error) {
+	permissions, err := h.userUsecase.ListPermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pbAccount.Permission, len(permissions))
+	for i := 0; i < len(permissions); i++ {
+		res[i] = &pbAccount.Permission{
+			Id:   int32(permissions[i].ID),
+			Name: permissions[i].Name,
+		}
+	}
+
+	return &pbAccount.ListPermissionsResponse{
+		Items: res,
+	}, nil
+}
+
+func (h *accountHandler) CreatePermission(ctx context.Context, req *pbAccount.CreatePermissionRequest) (*pbAccount.CreatePermissionResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	id, err := h.userUsecase.CreatePermission(ctx, req.Name)
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &pbAccount.CreatePermissionResponse{
+		Id: int32(id),
+	}, nil
+}
+
+func (h *accountHandler) AttachPermissions(ctx context.Context, req *pbAccount.AttachPermissionsRequest) (*emptypb.Empty, error) {
+	if req.RoleId < 1 {
+		return nil, status.Error(codes.InvalidArgument, "role_id is required")
+	}
+
+	if len(req.Permissions) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "permissions is required")
+	}
+
+	if err := h.userUsecase.AttachPermissions(ctx, int64(req.RoleId), req.Permissions); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) DetachPermissions(ctx context.Context, req *pbAccount.DetachPermissionsRequest) (*emptypb.Empty, error) {
+	if req.RoleId < 1 {
+		return nil, status.Error(codes.InvalidArgument, "role_id is required")
+	}
+
+	if len(req.Permissions) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "permissions is required")
+	}
+
+	if err := h.userUsecase.DetachPermissions(ctx, int64(req.RoleId), req.Permissions); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) ListPolicies(ctx context.Context, req *emptypb.Empty) (*pbAccount.ListPoliciesResponse, error) {
+	policies, err := h.userUsecase.ListPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pbAccount.Policy, len(policies))
+	for i := 0; i < len(policies); i++ {
+		res[i] = &pbAccount.Policy{
+			Id:          int32(policies[i].ID),
+			Name:        policies[i].Name,
+			Description: policies[i].Description,
+			Expression:  policies[i].Expression,
+		}
+	}
+
+	return &pbAccount.ListPoliciesResponse{
+		Items: res,
+	}, nil
+}
+
+func (h *accountHandler) CreatePolicy(ctx context.Context, req *pbAccount.CreatePolicyRequest) (*pbAccount.CreatePolicyResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if req.Expression == "" {
+		return nil, status.Error(codes.InvalidArgument, "expression is required")
+	}
+
+	id, err := h.userUsecase.CreatePolicy(ctx, &domain.Policy{
+		Name:        req.Name,
+		Description: req.Description,
+		Expression:  req.Expression,
+	})
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &pbAccount.CreatePolicyResponse{
+		Id: int32(id),
+	}, nil
+}
+
+func (h *accountHandler) UpdatePolicy(ctx context.Context, req *pbAccount.UpdatePolicyRequest) (*emptypb.Empty, error) {
+	if req.Id < 1 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := h.userUsecase.UpdatePolicy(ctx, &domain.Policy{
+		ID:          int64(req.Id),
+		Description: req.Description,
+		Expression:  req.Expression,
+	}); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) DeletePolicy(ctx context.Context, req *pbAccount.DeletePolicyRequest) (*emptypb.Empty, error) {
+	if req.Id < 1 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := h.userUsecase.DeletePolicy(ctx, int64(req.Id)); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) ListRoleConstraints(ctx context.Context, req *emptypb.Empty) (*pbAccount.ListRoleConstraintsResponse, error) {
+	constraints, err := h.userUsecase.ListRoleConstraints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pbAccount.RoleConstraint, len(constraints))
+	for i := 0; i < len(constraints); i++ {
+		res[i] = &pbAccount.RoleConstraint{
+			Id:    int32(constraints[i].ID),
+			Name:  constraints[i].Name,
+			Roles: constraints[i].Roles,
+		}
+	}
+
+	return &pbAccount.ListRoleConstraintsResponse{
+		Items: res,
+	}, nil
+}
+
+func (h *accountHandler) CreateRoleConstraint(ctx context.Context, req *pbAccount.CreateRoleConstraintRequest) (*pbAccount.CreateRoleConstraintResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	id, err := h.userUsecase.CreateRoleConstraint(ctx, &domain.RoleConstraint{
+		Name:  req.Name,
+		Roles: req.Roles,
+	})
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &pbAccount.CreateRoleConstraintResponse{
+		Id: int32(id),
+	}, nil
+}
+
+func (h *accountHandler) DeleteRoleConstraint(ctx context.Context, req *pbAccount.DeleteRoleConstraintRequest) (*emptypb.Empty, error) {
+	if req.Id < 1 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := h.userUsecase.DeleteRoleConstraint(ctx, int64(req.Id)); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) ListConstraintViolations(ctx context.Context, req *emptypb.Empty) (*pbAccount.ListConstraintViolationsResponse, error) {
+	violations, err := h.userUsecase.GetConstraintViolations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pbAccount.ConstraintViolation, len(violations))
+	for i := 0; i < len(violations); i++ {
+		res[i] = &pbAccount.ConstraintViolation{
+			UserId:         int32(violations[i].UserID),
+			Constraint:     violations[i].Constraint,
+			Roles:          violations[i].Roles,
+			OrganizationId: int32(violations[i].OrgID),
+		}
+	}
+
+	return &pbAccount.ListConstraintViolationsResponse{
+		Items: res,
+	}, nil
+}
+
+func (h *accountHandler) ExportPolicy(ctx context.Context, req *pbAccount.ExportPolicyRequest) (*pbAccount.ExportPolicyResponse, error) {
+	doc, err := h.userUsecase.ExportPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var content bytes.Buffer
+
+	switch req.Format {
+	case "", "yaml":
+		req.Format = "yaml"
+		enc := yaml.NewEncoder(&content)
+		enc.SetIndent(2)
+		err = enc.Encode(doc)
+	case "json":
+		enc := json.NewEncoder(&content)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(doc)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "format must be yaml or json")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pbAccount.ExportPolicyResponse{
+		Format:  req.Format,
+		Content: content.String(),
+	}, nil
+}
+
+func (h *accountHandler) ApplyPolicy(ctx context.Context, req *pbAccount.ApplyPolicyRequest) (*pbAccount.ApplyPolicyResponse, error) {
+	if req.Content == "" {
+		return nil, status.Error(codes.InvalidArgument, "content is required")
+	}
+
+	doc, err := domain.ParsePolicyDocument([]byte(req.Content))
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	changes, err := h.userUsecase.ApplyPolicy(ctx, doc, req.Prune, req.DryRun)
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	res := make([]string, len(changes))
+	for i := 0; i < len(changes); i++ {
+		res[i] = changes[i].String()
+	}
+
+	return &pbAccount.ApplyPolicyResponse{
+		Changes: res,
+		Applied: !req.DryRun,
+	}, nil
+}
+
+func (h *accountHandler) RequestElevation(ctx context.Context, req *pbAccount.RequestElevationRequest) (*pbAccount.RequestElevationResponse, error) {
+	if req.Role == "" {
+		return nil, status.Error(codes.InvalidArgument, "role is required")
+	}
+
+	if req.Reason == "" {
+		return nil, status.Error(codes.InvalidArgument, "reason is required")
+	}
+
+	id, err := h.userUsecase.RequestElevation(ctx, &domain.Elevation{
+		Role:     req.Role,
+		Reason:   req.Reason,
+		Duration: time.Duration(req.DurationSeconds) * time.Second,
+	})
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &pbAccount.RequestElevationResponse{
+		Id: int32(id),
+	}, nil
+}
+
+func (h *accountHandler) ListElevations(ctx context.Context, req *emptypb.Empty) (*pbAccount.ListElevationsResponse, error) {
+	elevations, err := h.userUsecase.ListElevations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pbAccount.Elevation, len(elevations))
+	for i := 0; i < len(elevations); i++ {
+		res[i] = &pbAccount.Elevation{
+			Id:              int32(elevations[i].ID),
+			UserId:          int32(elevations[i].UserID),
+			Role:            elevations[i].Role,
+			Reason:          elevations[i].Reason,
+			DurationSeconds: int64(elevations[i].Duration / time.Second),
+			Status:          string(elevations[i].Status),
+			CreatedAt:       elevations[i].CreatedAt.Format(time.RFC3339),
+		}
+	}
+
+	return &pbAccount.ListElevationsResponse{
+		Items: res,
+	}, nil
+}
+
+func (h *accountHandler) ApproveElevation(ctx context.Context, req *pbAccount.ApproveElevationRequest) (*emptypb.Empty, error) {
+	if req.Id < 1 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := h.userUsecase.ApproveElevation(ctx, int64(req.Id)); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) ListOrganizations(ctx context.Context, req *emptypb.Empty) (*pbAccount.ListOrganizationsResponse, error) {
+	organizations, err := h.userUsecase.ListOrganizations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pbAccount.Organization, len(organizations))
+	for i := 0; i < len(organizations); i++ {
+		res[i] = &pbAccount.Organization{
+			Id:        int32(organizations[i].ID),
+			Name:      organizations[i].Name,
+			CreatedAt: organizations[i].CreatedAt.Format(time.RFC3339),
+		}
+	}
+
+	return &pbAccount.ListOrganizationsResponse{
+		Items: res,
+	}, nil
+}
+
+func (h *accountHandler) CreateOrganization(ctx context.Context, req *pbAccount.CreateOrganizationRequest) (*pbAccount.CreateOrganizationResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	id, err := h.userUsecase.CreateOrganization(ctx, &domain.Organization{
+		Name: req.Name,
+	})
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &pbAccount.CreateOrganizationResponse{
+		Id: int32(id),
+	}, nil
+}
+
+func (h *accountHandler) AddMember(ctx context.Context, req *pbAccount.AddMemberRequest) (*emptypb.Empty, error) {
+	if req.OrganizationId < 1 {
+		return nil, status.Error(codes.InvalidArgument, "organization_id is required")
+	}
+
+	if req.UserId < 1 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if err := h.userUsecase.AddMember(ctx, int64(req.OrganizationId), int64(req.UserId), req.Roles); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) RemoveMember(ctx context.Context, req *pbAccount.RemoveMemberRequest) (*emptypb.Empty, error) {
+	if req.OrganizationId < 1 {
+		return nil, status.Error(codes.InvalidArgument, "organization_id is required")
+	}
+
+	if req.UserId < 1 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if err := h.userUsecase.RemoveMember(ctx, int64(req.OrganizationId), int64(req.UserId)); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) ListGroups(ctx context.Context, req *emptypb.Empty) (*pbAccount.ListGroupsResponse, error) {
+	groups, err := h.userUsecase.ListGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pbAccount.Group, len(groups))
+	for i := 0; i < len(groups); i++ {
+		res[i] = &pbAccount.Group{
+			Id:    int32(groups[i].ID),
+			Name:  groups[i].Name,
+			Roles: groups[i].Roles,
+		}
+	}
+
+	return &pbAccount.ListGroupsResponse{
+		Items: res,
+	}, nil
+}
+
+func (h *accountHandler) CreateGroup(ctx context.Context, req *pbAccount.CreateGroupRequest) (*pbAccount.CreateGroupResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	id, err := h.userUsecase.CreateGroup(ctx, &domain.Group{
+		Name: req.Name,
+	})
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &pbAccount.CreateGroupResponse{
+		Id: int32(id),
+	}, nil
+}
+
+func (h *accountHandler) DeleteGroup(ctx context.Context, req *pbAccount.DeleteGroupRequest) (*emptypb.Empty, error) {
+	if req.Id < 1 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := h.userUsecase.DeleteGroup(ctx, int64(req.Id)); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) ListGroupMembers(ctx context.Context, req *pbAccount.ListGroupMembersRequest) (*pbAccount.ListGroupMembersResponse, error) {
+	if req.Id < 1 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	users, err := h.userUsecase.GetGroupMembers(ctx, int64(req.Id))
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	res := make([]*pbAccount.User, len(users))
+	for i := 0; i < len(users); i++ {
+		res[i] = toPbUser(users[i])
+	}
+
+	return &pbAccount.ListGroupMembersResponse{
+		Items: res,
+	}, nil
+}
+
+func (h *accountHandler) AddGroupMembers(ctx context.Context, req *pbAccount.GroupMembersRequest) (*emptypb.Empty, error) {
+	userIDs, err := validateGroupMembers(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.userUsecase.AddGroupMembers(ctx, int64(req.GroupId), userIDs); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) RemoveGroupMembers(ctx context.Context, req *pbAccount.GroupMembersRequest) (*emptypb.Empty, error) {
+	userIDs, err := validateGroupMembers(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.userUsecase.RemoveGroupMembers(ctx, int64(req.GroupId), userIDs); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) AssignGroupRoles(ctx context.Context, req *pbAccount.GroupRolesRequest) (*emptypb.Empty, error) {
+	if err := validateGroupRoles(req); err != nil {
+		return nil, err
+	}
+
+	if err := h.userUsecase.AssignGroupRoles(ctx, int64(req.GroupId), req.Roles); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) RevokeGroupRoles(ctx context.Context, req *pbAccount.GroupRolesRequest) (*emptypb.Empty, error) {
+	if err := validateGroupRoles(req); err != nil {
+		return nil, err
+	}
+
+	if err := h.userUsecase.RevokeGroupRoles(ctx, int64(req.GroupId), req.Roles); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) InviteUser(ctx context.Context, req *pbAccount.InviteUserRequest) (*pbAccount.InviteUserResponse, error) {
+	if req.Email == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	id, err := h.userUsecase.InviteUser(ctx, req.Email, req.Roles)
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &pbAccount.InviteUserResponse{
+		Id: int32(id),
+	}, nil
+}
+
+func (h *accountHandler) ListInvitations(ctx context.Context, req *emptypb.Empty) (*pbAccount.ListInvitationsResponse, error) {
+	invitations, err := h.userUsecase.ListInvitations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	res := make([]*pbAccount.Invitation, len(invitations))
+	for i := 0; i < len(invitations); i++ {
+		res[i] = &pbAccount.Invitation{
+			Id:        int32(invitations[i].ID),
+			UserId:    int32(invitations[i].UserID),
+			Email:     invitations[i].Email,
+			Status:    string(invitations[i].Status(now)),
+			InvitedBy: int32(invitations[i].InvitedBy),
+			ExpiresAt: invitations[i].ExpiresAt.Format(time.RFC3339),
+			CreatedAt: invitations[i].CreatedAt.Format(time.RFC3339),
+		}
+	}
+
+	return &pbAccount.ListInvitationsResponse{
+		Items: res,
+	}, nil
+}
+
+func (h *accountHandler) ResendInvitation(ctx context.Context, req *pbAccount.ResendInvitationRequest) (*emptypb.Empty, error) {
+	if req.Id == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := h.userUsecase.ResendInvitation(ctx, int64(req.Id)); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *accountHandler) RevokeInvitation(ctx context.Context, req *pbAccount.RevokeInvitationRequest) (*emptypb.Empty, error) {
+	if req.Id == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := h.userUsecase.RevokeInvitation(ctx, int64(req.Id)); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func validateGroupMembers(req *pbAccount.GroupMembersRequest) ([]int64, error) {
+	if req.GroupId < 1 {
+		return nil, status.Error(codes.InvalidArgument, "group_id is required")
+	}
+
+	if len(req.UserIds) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_ids is required")
+	}
+
+	res := make([]int64, len(req.UserIds))
+	for i := 0; i < len(req.UserIds); i++ {
+		res[i] = int64(req.UserIds[i])
+	}
+
+	return res, nil
+}
+
+func validateGroupRoles(req *pbAccount.GroupRolesRequest) error {
+	if req.GroupId < 1 {
+		return status.Error(codes.InvalidArgument, "group_id is required")
+	}
+
+	if len(req.Roles) == 0 {
+		return status.Error(codes.InvalidArgument, "roles is required")
+	}
+
+	return nil
+}
+
+// userTimeRanges reads the timestamp bounds of req.
+func userTimeRanges(req *pbAccount.GetUsersRequest) (map[domain.UserTimeField]domain.TimeRange, error) {
+	res := map[domain.UserTimeField]domain.TimeRange{}
+
+	bounds := []struct {
+		field         domain.UserTimeField
+		after, before string
+	}{
+		{domain.UserCreatedAt, req.CreatedAfter, req.CreatedBefore},
+		{domain.UserUpdatedAt, req.UpdatedAfter, req.UpdatedBefore},
+		{domain.UserLastLoginAt, req.LastLoginAfter, req.LastLoginBefore},
+		{domain.UserPasswordChangedAt, req.PasswordChangedAfter, req.PasswordChangedBefore},
+	}
+
+	for _, v := range bounds {
+		after, err := parseTimeBound(v.field, v.after)
+		if err != nil {
+			return nil, err
+		}
+
+		before, err := parseTimeBound(v.field, v.before)
+		if err != nil {
+			return nil, err
+		}
+
+		if after != nil || before != nil {
+			res[v.field] = domain.TimeRange{After: after, Before: before}
+		}
+	}
+
+	return res, nil
+}
+
+func parseTimeBound(field domain.UserTimeField, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid %s bound, expected an RFC 3339 time", field)
+	}
+
+	return &t, nil
+}
+
+// userReadMask returns the JSON names of the user fields in mask, which
+// may name fields either way.
+func userReadMask(mask *fieldmaskpb.FieldMask) ([]string, error) {
+	fields := (&pbAccount.User{}).ProtoReflect().Descriptor().Fields()
+	res := []string{}
+
+	for _, v := range mask.GetPaths() {
+		fd := fields.ByJSONName(v)
+		if fd == nil {
+			fd = fields.ByName(protoreflect.Name(v))
+		}
+
+		if fd == nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid read_mask, unknown field %s", v)
+		}
+
+		res = append(res, fd.JSONName())
+	}
+
+	return res, nil
+}
+
+// maskUser clears the fields of user not listed by their JSON names, unless
+// none are listed.
+func maskUser(user *pbAccount.User, fields []string) {
+	if len(fields) == 0 {
+		return
+	}
+
+	keep := map[string]bool{}
+	for _, v := range fields {
+		keep[v] = true
+	}
+
+	m := user.ProtoReflect()
+	fds := m.Descriptor().Fields()
+
+	for i := 0; i < fds.Len(); i++ {
+		if !keep[fds.Get(i).JSONName()] {
+			m.Clear(fds.Get(i))
+		}
+	}
+}
+
+func (h *accountHandler) ListAttributeDefinitions(ctx context.Context, req *emptypb.Empty) (*pbAccount.ListAttributeDefinitionsResponse, error) {
+	definitions, err := h.userUsecase.ListAttributeDefinitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pbAccount.AttributeDefinition, len(definitions))
+	for i := 0; i < len(definitions); i++ {
+		res[i] = &pbAccount.AttributeDefinition{
+			Id:          int32(definitions[i].ID),
+			Name:        definitions[i].Name,
+			Description: definitions[i].Description,
+			Type:        string(definitions[i].Type),
+			Required:    definitions[i].Required,
+			Unique:      definitions[i].Unique,
+			Pattern:     definitions[i].Pattern,
+		}
+	}
+
+	return &pbAccount.ListAttributeDefinitionsResponse{
+		Items: res,
+	}, nil
+}
+
+func (h *accountHandler) CreateAttributeDefinition(ctx context.Context, req *pbAccount.CreateAttributeDefinitionRequest) (*pbAccount.CreateAttributeDefinitionResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if req.Type == "" {
+		return nil, status.Error(codes.InvalidArgument, "type is required")
+	}
+
+	id, err := h.userUsecase.CreateAttributeDefinition(ctx, &domain.AttributeDefinition{
+		Name:        req.Name,
+		Description: req.Description,
+		Type:        domain.AttributeType(req.Type),
+		Required:    req.Required,
+		Unique:      req.Unique,
+		Pattern:     req.Pattern,
+	})
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &pbAccount.CreateAttributeDefinitionResponse{
+		Id: int32(id),
+	}, nil
+}
+
+func (h *accountHandler) DeleteAttributeDefinition(ctx context.Context, req *pbAccount.DeleteAttributeDefinitionRequest) (*emptypb.Empty, error) {
+	if req.Id < 1 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := h.userUsecase.DeleteAttributeDefinition(ctx, int64(req.Id)); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func toPbUser(user *domain.User) *pbAccount.User {
+	res := &pbAccount.User{
+		Id:         int32(user.ID),
+		Name:       user.Name,
+		Email:      user.Email,
+		Roles:      user.Roles,
+		Groups:     user.Groups,
+		GroupRoles: user.GroupRoles,
+		Status:     string(user.EffectiveStatus(time.Now())),
+	}
+
+	if len(user.Attributes) > 0 {
+		// attributes are decoded from JSON, which structpb always supports
+		res.Attributes, _ = structpb.NewStruct(user.Attributes)
+	}
+
+	if !user.CreatedAt.IsZero() {
+		res.CreatedAt = user.CreatedAt.Format(time.RFC3339)
+		res.UpdatedAt = user.UpdatedAt.Format(time.RFC3339)
+	}
+
+	if user.LastLoginAt != nil {
+		res.LastLoginAt = user.LastLoginAt.Format(time.RFC3339)
+	}
+
+	if user.PasswordChangedAt != nil {
+		res.PasswordChangedAt = user.PasswordChangedAt.Format(time.RFC3339)
+	}
+
+	if user.DeletedAt != nil {
+		res.DeletedAt = user.DeletedAt.Format(time.RFC3339)
+	}
+
+	// an ended suspension or lock is reported as active, without its
+	// reason
+	if res.Status == string(user.Status) {
+		res.StatusReason = user.StatusReason
+
+		if user.StatusUntil != nil {
+			res.StatusUntil = user.StatusUntil.Format(time.RFC3339)
+		}
+	}
+
+	return res
+}
+
+// attributesMap returns nil when attributes are not set, which leaves them
+// alone on update.
+func attributesMap(attributes *structpb.Struct) map[string]interface{} {
+	if attributes == nil {
+		return nil
+	}
+
+	return attributes.AsMap()
+}
+
+func rbacError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.NotFound, "record not found")
+	case errors.Is(err, domain.ErrInvalidRoleName),
+		errors.Is(err, domain.ErrInvalidPermissionName),
+		errors.Is(err, domain.ErrPermissionNotFound),
+		errors.Is(err, domain.ErrInvalidScope),
+		errors.Is(err, domain.ErrRoleNotFound),
+		errors.Is(err, domain.ErrInvalidPolicy),
+		errors.Is(err, domain.ErrPolicyNotFound),
+		errors.Is(err, domain.ErrInvalidElevation),
+		errors.Is(err, domain.ErrInvalidPolicyDocument),
+		errors.Is(err, domain.ErrInvalidConstraint),
+		errors.Is(err, domain.ErrInvalidOrganization),
+		errors.Is(err, domain.ErrInvalidGroupName),
+		errors.Is(err, domain.ErrInvalidAttributeDefinition),
+		errors.Is(err, domain.ErrInvalidAttribute),
+		errors.Is(err, domain.ErrInvalidFilter),
+		errors.Is(err, domain.ErrInvalidOrderBy),
+		errors.Is(err, domain.ErrInvalidReadMask),
+		errors.Is(err, domain.ErrInvalidPageToken),
+		errors.Is(err, domain.ErrInvalidSearchQuery):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, domain.ErrAttributeInUse):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, domain.ErrRoleInUse),
+		errors.Is(err, domain.ErrRoleCycle),
+		errors.Is(err, domain.ErrPolicyInUse),
+		errors.Is(err, domain.ErrElevationNotPending),
+		errors.Is(err, domain.ErrInvitationNotPending),
+		errors.Is(err, domain.ErrInvalidTransition),
+		errors.Is(err, domain.ErrRoleConflict):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, domain.ErrNotGranted),
+		errors.Is(err, domain.ErrRoleEscalation),
+		errors.Is(err, domain.ErrPermissionEscalation),
+		errors.Is(err, domain.ErrSelfApproval),
+		errors.Is(err, domain.ErrOtherTenant),
+		errors.Is(err, domain.ErrSelfStatusChange),
+		errors.Is(err, domain.ErrPermissionChanged):
+		return permissionError(err)
+	}
+
+	return err
+}
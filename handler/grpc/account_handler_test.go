@@ -0,0 +1,30 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	pbAccount "github.com/adetxt/user/gen/proto/go/account/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetUsersRejectsFilterWithDeprecatedFields(t *testing.T) {
+	h := &accountHandler{}
+
+	tests := []struct {
+		name string
+		req  *pbAccount.GetUsersRequest
+	}{
+		{"status", &pbAccount.GetUsersRequest{Filter: "role = admin", Status: "active"}},
+		{"time range", &pbAccount.GetUsersRequest{Filter: "role = admin", CreatedAfter: "2024-01-01T00:00:00Z"}},
+		{"attributes", &pbAccount.GetUsersRequest{Filter: "role = admin", Attributes: map[string]string{"department": "sales"}}},
+	}
+
+	for _, tt := range tests {
+		_, err := h.GetUsers(context.Background(), tt.req)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: got %v, want %v", tt.name, err, codes.InvalidArgument)
+		}
+	}
+}
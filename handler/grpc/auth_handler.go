@@ -2,9 +2,10 @@ package grpc
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"net"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/adetxt/user/config"
@@ -12,19 +13,32 @@ import (
 	pbAccount "github.com/adetxt/user/gen/proto/go/account/v1"
 	"github.com/adetxt/user/utils/auth"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
 	"gorm.io/gorm"
 )
 
 type authHandler struct {
-	cfg    config.Config
-	authUc domain.AuthUsecase
+	cfg     config.Config
+	authUc  domain.AuthUsecase
+	proxies []*net.IPNet
 }
 
 func NewAuthHandler(cfg config.Config, authUc domain.AuthUsecase) pbAccount.AuthServiceServer {
+	// the entries are checked by config.New
+	proxies := []*net.IPNet{}
+	for _, v := range cfg.TrustedProxies {
+		if network, err := config.ParseProxy(v); err == nil {
+			proxies = append(proxies, network)
+		}
+	}
+
 	return &authHandler{
-		cfg:    cfg,
-		authUc: authUc,
+		cfg:     cfg,
+		authUc:  authUc,
+		proxies: proxies,
 	}
 }
 
@@ -37,12 +51,20 @@ func (h *authHandler) Login(ctx context.Context, req *pbAccount.LoginRequest) (*
 		return nil, status.Error(codes.InvalidArgument, "password is required")
 	}
 
-	loginInfo, err := h.authUc.Login(ctx, req.Email, req.Password)
+	loginInfo, err := h.authUc.Login(ctx, req.Email, req.Password, int64(req.OrganizationId))
 	if err != nil {
+		if errors.Is(err, domain.ErrInvalidCredentials) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, status.Error(codes.NotFound, "record not found")
 		}
 
+		if errors.Is(err, domain.ErrNotMember) || errors.Is(err, domain.ErrUserNotActive) || errors.Is(err, domain.ErrEmailNotVerified) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+
 		return nil, err
 	}
 
@@ -65,8 +87,15 @@ func (h *authHandler) RefreshToken(ctx context.Context, req *pbAccount.RefreshTo
 		return nil, err
 	}
 
-	t, err := h.authUc.RefreshToken(ctx, id)
+	// tokens are refreshed for the organization they were issued in
+	orgID, _ := refreshClaims["org"].(float64)
+
+	t, err := h.authUc.RefreshToken(ctx, id, int64(orgID))
 	if err != nil {
+		if errors.Is(err, domain.ErrNotMember) || errors.Is(err, domain.ErrUserNotActive) || errors.Is(err, domain.ErrEmailNotVerified) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+
 		return nil, err
 	}
 
@@ -76,8 +105,155 @@ func (h *authHandler) RefreshToken(ctx context.Context, req *pbAccount.RefreshTo
 	}, nil
 }
 
-func getTokenInfo(ctx context.Context) (res domain.JWTClaims) {
-	c := ctx.Value("claims").(string)
-	_ = json.Unmarshal([]byte(c), &res)
-	return
+func (h *authHandler) AcceptInvitation(ctx context.Context, req *pbAccount.AcceptInvitationRequest) (*emptypb.Empty, error) {
+	if req.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if req.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+
+	if req.Password != req.PasswordValidation {
+		return nil, status.Error(codes.InvalidArgument, "password is not the same")
+	}
+
+	if err := h.authUc.AcceptInvitation(ctx, req.Token, req.Name, req.Password); err != nil {
+		if errors.Is(err, domain.ErrInvitationInvalid) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (h *authHandler) Register(ctx context.Context, req *pbAccount.RegisterRequest) (*pbAccount.RegisterResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if req.Email == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	if req.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+
+	if req.Password != req.PasswordValidation {
+		return nil, status.Error(codes.InvalidArgument, "password is not the same")
+	}
+
+	id, err := h.authUc.Register(ctx, &domain.Registration{
+		Name:     req.Name,
+		Email:    req.Email,
+		Password: req.Password,
+		ClientIP: clientIP(ctx, h.proxies),
+		Proof:    req.Proof,
+	})
+	if err != nil {
+		return nil, registrationError(err)
+	}
+
+	return &pbAccount.RegisterResponse{
+		Id:                   int32(id),
+		VerificationRequired: h.cfg.RegistrationVerifyEmail,
+	}, nil
+}
+
+func (h *authHandler) VerifyEmail(ctx context.Context, req *pbAccount.VerifyEmailRequest) (*emptypb.Empty, error) {
+	if req.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	if err := h.authUc.VerifyEmail(ctx, req.Token); err != nil {
+		if errors.Is(err, domain.ErrVerificationInvalid) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func registrationError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidEmail),
+		errors.Is(err, domain.ErrInvalidProofOfWork):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, domain.ErrRegistrationDisabled),
+		errors.Is(err, domain.ErrEmailDomainNotAllowed):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, domain.ErrTooManyRegistrations):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	return err
+}
+
+// clientIP returns the address of the client. Behind trusted proxies, such
+// as the gateway of REST calls, it is the right-most address of
+// x-forwarded-for not of a trusted proxy: clients may send the header too,
+// so the addresses left of it cannot be trusted.
+func clientIP(ctx context.Context, proxies []*net.IPNet) string {
+	addr := ""
+
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+	}
+
+	if !trustedProxy(addr, proxies) {
+		return addr
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	hops := []string{}
+
+	for _, v := range md.Get("x-forwarded-for") {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if hops[i] == "" {
+			continue
+		}
+
+		addr = hops[i]
+		if !trustedProxy(addr, proxies) {
+			break
+		}
+	}
+
+	return addr
+}
+
+func trustedProxy(addr string, proxies []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, v := range proxies {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getTokenInfo(ctx context.Context) domain.JWTClaims {
+	return domain.GetClaims(ctx)
 }
@@ -0,0 +1,47 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestClientIP(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.1/8")
+	_, lb, _ := net.ParseCIDR("10.0.0.0/8")
+	proxies := []*net.IPNet{loopback, lb}
+
+	tests := []struct {
+		name string
+		peer string
+		xff  []string
+		want string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"direct client forging the header", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"through the gateway", "127.0.0.1:5000", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"forged hops are left of the client", "127.0.0.1:5000", []string{"198.51.100.1, 198.51.100.2, 203.0.113.7"}, "203.0.113.7"},
+		{"behind a load balancer", "127.0.0.1:5000", []string{"198.51.100.1, 203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"several headers", "127.0.0.1:5000", []string{"198.51.100.1", "203.0.113.7"}, "203.0.113.7"},
+		{"only proxies", "127.0.0.1:5000", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"gateway without the header", "127.0.0.1:5000", nil, "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		addr, _ := net.ResolveTCPAddr("tcp", tt.peer)
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+
+		if tt.xff != nil {
+			md := metadata.MD{}
+			md.Append("x-forwarded-for", tt.xff...)
+			ctx = metadata.NewIncomingContext(ctx, md)
+		}
+
+		if got := clientIP(ctx, proxies); got != tt.want {
+			t.Errorf("%s: clientIP() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
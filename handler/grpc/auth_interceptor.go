@@ -0,0 +1,301 @@
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adetxt/user/config"
+	"github.com/adetxt/user/domain"
+	pbAccount "github.com/adetxt/user/gen/proto/go/account/v1"
+	"github.com/adetxt/user/utils/auth"
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	googleGrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"gorm.io/gorm"
+)
+
+// AuthInterceptor enforces the (account.v1.auth) rule declared on each RPC.
+type AuthInterceptor struct {
+	cfg         config.Config
+	userUsecase domain.UserUsecase
+	rules       sync.Map
+}
+
+func NewAuthInterceptor(cfg config.Config, userUsecase domain.UserUsecase) *AuthInterceptor {
+	return &AuthInterceptor{
+		cfg:         cfg,
+		userUsecase: userUsecase,
+	}
+}
+
+func (i *AuthInterceptor) Unary() googleGrpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *googleGrpc.UnaryServerInfo, handler googleGrpc.UnaryHandler) (interface{}, error) {
+		ctx, err := i.authorize(ctx, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// authorize checks the caller against the rule of fullMethod. req is the
+// request, used to find the target of scoped grants.
+func (i *AuthInterceptor) authorize(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
+	rule, err := i.getRule(fullMethod)
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	data := map[string]interface{}{}
+	service := rule.AllowService && i.isService(ctx)
+
+	if service {
+		data["service"] = true
+	} else if !rule.Public {
+		claims, err := parseClaims(ctx, i.cfg.JWTKey, rule.AllowExpired)
+		if err != nil {
+			return nil, err
+		}
+
+		data = claims
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// the organization of the token scopes everything done for the caller,
+	// its authorization included
+	orgID, _ := data["org"].(float64)
+	ctx = domain.WithTenant(context.WithValue(ctx, "claims", string(b)), int64(orgID))
+
+	if service || rule.Public {
+		return ctx, nil
+	}
+
+	jti, _ := data["jti"].(string)
+
+	id, err := strconv.ParseInt(jti, 10, 64)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token subject")
+	}
+
+	// suspended users lose access at once, not when their token expires
+	if err := i.userUsecase.CheckActive(ctx, id); err != nil {
+		if errors.Is(err, domain.ErrUserNotActive) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "user not found")
+		}
+
+		return nil, err
+	}
+
+	if len(rule.Permissions) == 0 {
+		return ctx, nil
+	}
+
+	mode := domain.GrantAny
+	if rule.RequireAll {
+		mode = domain.GrantAll
+	}
+
+	decision, err := i.userUsecase.Authorize(ctx, &domain.AuthorizeParams{
+		UserID:       id,
+		Permissions:  rule.Permissions,
+		Mode:         mode,
+		TargetUserID: targetID(req, rule.TargetField),
+		Request: &domain.RequestInfo{
+			Method:   fullMethod,
+			Metadata: requestMetadata(ctx),
+			Claims:   data,
+			Time:     time.Now(),
+		},
+	})
+	if err != nil {
+		return nil, permissionError(err)
+	}
+
+	if !decision.Allowed {
+		return nil, permissionError(&domain.NotGrantedError{Decision: decision})
+	}
+
+	return ctx, nil
+}
+
+// getRule reads the auth rule of fullMethod from the registered proto
+// descriptors. Methods without a rule are not allowed.
+func (i *AuthInterceptor) getRule(fullMethod string) (*pbAccount.AuthRule, error) {
+	if v, ok := i.rules.Load(fullMethod); ok {
+		return v.(*pbAccount.AuthRule), nil
+	}
+
+	name := strings.ReplaceAll(strings.TrimPrefix(fullMethod, "/"), "/", ".")
+
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("unknown method %s", fullMethod)
+	}
+
+	method, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok || !proto.HasExtension(method.Options(), pbAccount.E_Auth) {
+		return nil, fmt.Errorf("method %s has no auth rule", fullMethod)
+	}
+
+	rule := proto.GetExtension(method.Options(), pbAccount.E_Auth).(*pbAccount.AuthRule)
+	i.rules.Store(fullMethod, rule)
+
+	return rule, nil
+}
+
+// targetID reads the integer field of req named field, zero when there is
+// no such field.
+func targetID(req interface{}, field string) int64 {
+	msg, ok := req.(proto.Message)
+	if !ok || field == "" {
+		return 0
+	}
+
+	m := msg.ProtoReflect()
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(field))
+	if fd == nil {
+		return 0
+	}
+
+	switch fd.Kind() {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return m.Get(fd).Int()
+	}
+
+	return 0
+}
+
+// requestMetadata returns the first value of each incoming metadata key,
+// leaving out credentials so policies never see them.
+func requestMetadata(ctx context.Context) map[string]string {
+	res := map[string]string{}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return res
+	}
+
+	for k, v := range md {
+		if k == "authorization" || k == "x-service-key" || len(v) == 0 {
+			continue
+		}
+
+		res[k] = v[0]
+	}
+
+	return res
+}
+
+// isService reports whether ctx carries one of the configured service keys.
+func (i *AuthInterceptor) isService(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+
+	for _, key := range md.Get("x-service-key") {
+		for _, v := range i.cfg.ServiceKeys {
+			if v != "" && subtle.ConstantTimeCompare([]byte(key), []byte(v)) == 1 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func parseClaims(ctx context.Context, JWTKey string, allowExpired bool) (map[string]interface{}, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "Retrieving metadata is failed")
+	}
+
+	authHeader, ok := md["authorization"]
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "Authorization token is not supplied")
+	}
+
+	token := authHeader[0]
+
+	if strings.Contains(token, " ") {
+		tokenParts := strings.Split(token, " ")
+		token = tokenParts[1]
+	}
+
+	claims, err := auth.ParseToken(token, JWTKey)
+	if err != nil && !errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, status.Errorf(codes.Unauthenticated, err.Error())
+	}
+
+	if !allowExpired && errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, status.Errorf(codes.Unavailable, "token is expired")
+	}
+
+	return claims, nil
+}
+
+func permissionError(err error) error {
+	if errors.Is(err, domain.ErrPermissionChanged) {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	var notGranted *domain.NotGrantedError
+	if errors.As(err, &notGranted) {
+		st, detailErr := status.New(codes.PermissionDenied, err.Error()).
+			WithDetails(decisionInfo(notGranted.Decision))
+		if detailErr != nil {
+			return status.Error(codes.PermissionDenied, err.Error())
+		}
+
+		return st.Err()
+	}
+
+	return status.Error(codes.PermissionDenied, err.Error())
+}
+
+// decisionInfo describes an authorization decision as error details, so
+// callers can see which permissions matched and which were missing.
+func decisionInfo(d *domain.Decision) *errdetails.ErrorInfo {
+	return &errdetails.ErrorInfo{
+		Reason: "PERMISSION_NOT_GRANTED",
+		Domain: "account.v1",
+		Metadata: map[string]string{
+			"mode":    d.Mode.String(),
+			"matched": joinMatches(d.Matched),
+			"denied":  joinMatches(d.Denied),
+			"missing": strings.Join(d.Missing, ", "),
+		},
+	}
+}
+
+func joinMatches(matches []domain.PermissionMatch) string {
+	res := make([]string, len(matches))
+	for i := 0; i < len(matches); i++ {
+		res[i] = matches[i].String()
+	}
+
+	return strings.Join(res, ", ")
+}
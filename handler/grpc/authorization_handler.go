@@ -0,0 +1,107 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/adetxt/user/domain"
+	pbAccount "github.com/adetxt/user/gen/proto/go/account/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const maxBatchCheckItems = 100
+
+type authorizationHandler struct {
+	userUsecase domain.UserUsecase
+}
+
+func NewAuthorizationHandler(userUsecase domain.UserUsecase) pbAccount.AuthorizationServiceServer {
+	return &authorizationHandler{
+		userUsecase: userUsecase,
+	}
+}
+
+func (h *authorizationHandler) CheckPermission(ctx context.Context, req *pbAccount.CheckPermissionRequest) (*pbAccount.CheckPermissionResponse, error) {
+	if err := validateCheck(req); err != nil {
+		return nil, err
+	}
+
+	return h.check(ctx, req)
+}
+
+func (h *authorizationHandler) BatchCheck(ctx context.Context, req *pbAccount.BatchCheckRequest) (*pbAccount.BatchCheckResponse, error) {
+	if len(req.Items) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "items is required")
+	}
+
+	if len(req.Items) > maxBatchCheckItems {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("items must not exceed %d", maxBatchCheckItems))
+	}
+
+	for _, v := range req.Items {
+		if err := validateCheck(v); err != nil {
+			return nil, err
+		}
+	}
+
+	res := make([]*pbAccount.CheckPermissionResponse, len(req.Items))
+	for i := 0; i < len(req.Items); i++ {
+		item, err := h.check(ctx, req.Items[i])
+		if err != nil {
+			return nil, err
+		}
+
+		res[i] = item
+	}
+
+	return &pbAccount.BatchCheckResponse{
+		Items: res,
+	}, nil
+}
+
+func (h *authorizationHandler) check(ctx context.Context, req *pbAccount.CheckPermissionRequest) (*pbAccount.CheckPermissionResponse, error) {
+	res := &pbAccount.CheckPermissionResponse{
+		UserId:     req.UserId,
+		Permission: req.Permission,
+	}
+
+	if req.OrganizationId != 0 {
+		if tenantID := domain.TenantID(ctx); tenantID != 0 && tenantID != int64(req.OrganizationId) {
+			return nil, permissionError(domain.ErrOtherTenant)
+		}
+
+		ctx = domain.WithTenant(ctx, int64(req.OrganizationId))
+	}
+
+	// users who may not sign in are allowed nothing, whatever their roles
+	err := h.userUsecase.CheckActive(ctx, int64(req.UserId))
+	if err == nil {
+		err = h.userUsecase.Granted(ctx, int64(req.UserId), []string{req.Permission})
+	}
+
+	switch {
+	case err == nil:
+		res.Allowed = true
+	case errors.Is(err, domain.ErrNotGranted), errors.Is(err, domain.ErrUserNotActive), errors.Is(err, gorm.ErrRecordNotFound):
+		res.Allowed = false
+	default:
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func validateCheck(req *pbAccount.CheckPermissionRequest) error {
+	if req.UserId < 1 {
+		return status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if req.Permission == "" {
+		return status.Error(codes.InvalidArgument, "permission is required")
+	}
+
+	return nil
+}
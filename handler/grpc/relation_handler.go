@@ -0,0 +1,172 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/adetxt/user/domain"
+	pbAccount "github.com/adetxt/user/gen/proto/go/account/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const maxWriteTuples = 100
+
+type relationHandler struct {
+	relationUsecase domain.RelationUsecase
+}
+
+func NewRelationHandler(relationUsecase domain.RelationUsecase) pbAccount.RelationServiceServer {
+	return &relationHandler{
+		relationUsecase: relationUsecase,
+	}
+}
+
+func (h *relationHandler) Check(ctx context.Context, req *pbAccount.CheckRelationRequest) (*pbAccount.CheckRelationResponse, error) {
+	tuple, err := parseTuple(req.Object, req.Relation, req.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := h.relationUsecase.Check(ctx, tuple)
+	if err != nil {
+		return nil, relationError(err)
+	}
+
+	return &pbAccount.CheckRelationResponse{
+		Allowed: allowed,
+	}, nil
+}
+
+func (h *relationHandler) Expand(ctx context.Context, req *pbAccount.ExpandRelationRequest) (*pbAccount.ExpandRelationResponse, error) {
+	object, err := domain.ParseObject(req.Object)
+	if err != nil {
+		return nil, relationError(err)
+	}
+
+	if req.Relation == "" {
+		return nil, status.Error(codes.InvalidArgument, "relation is required")
+	}
+
+	tree, err := h.relationUsecase.Expand(ctx, object, req.Relation)
+	if err != nil {
+		return nil, relationError(err)
+	}
+
+	return &pbAccount.ExpandRelationResponse{
+		Tree: subjectTreeResponse(tree),
+	}, nil
+}
+
+func (h *relationHandler) ListObjects(ctx context.Context, req *pbAccount.ListObjectsRequest) (*pbAccount.ListObjectsResponse, error) {
+	if req.Namespace == "" {
+		return nil, status.Error(codes.InvalidArgument, "namespace is required")
+	}
+
+	if req.Relation == "" {
+		return nil, status.Error(codes.InvalidArgument, "relation is required")
+	}
+
+	subject, err := domain.ParseSubject(req.Subject)
+	if err != nil {
+		return nil, relationError(err)
+	}
+
+	objects, err := h.relationUsecase.ListObjects(ctx, req.Namespace, req.Relation, subject)
+	if err != nil {
+		return nil, relationError(err)
+	}
+
+	res := make([]string, len(objects))
+	for i := 0; i < len(objects); i++ {
+		res[i] = objects[i].String()
+	}
+
+	return &pbAccount.ListObjectsResponse{
+		Objects: res,
+	}, nil
+}
+
+func (h *relationHandler) WriteTuples(ctx context.Context, req *pbAccount.WriteTuplesRequest) (*emptypb.Empty, error) {
+	if len(req.Writes) == 0 && len(req.Deletes) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "writes or deletes is required")
+	}
+
+	if len(req.Writes)+len(req.Deletes) > maxWriteTuples {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("tuples must not exceed %d", maxWriteTuples))
+	}
+
+	writes, err := parseTuples(req.Writes)
+	if err != nil {
+		return nil, err
+	}
+
+	deletes, err := parseTuples(req.Deletes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.relationUsecase.WriteTuples(ctx, writes, deletes); err != nil {
+		return nil, relationError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func parseTuples(req []*pbAccount.RelationTuple) ([]domain.RelationTuple, error) {
+	res := make([]domain.RelationTuple, len(req))
+	for i := 0; i < len(req); i++ {
+		tuple, err := parseTuple(req[i].Object, req[i].Relation, req[i].Subject)
+		if err != nil {
+			return nil, err
+		}
+
+		res[i] = tuple
+	}
+
+	return res, nil
+}
+
+func parseTuple(object, relation, subject string) (domain.RelationTuple, error) {
+	tuple, err := domain.ParseRelationTuple(object + "#" + relation + "@" + subject)
+	if err != nil {
+		return domain.RelationTuple{}, relationError(err)
+	}
+
+	return tuple, nil
+}
+
+func subjectTreeResponse(tree *domain.SubjectTree) *pbAccount.SubjectTree {
+	res := &pbAccount.SubjectTree{
+		Userset:  tree.Userset.String(),
+		Subjects: make([]string, len(tree.Subjects)),
+		Children: make([]*pbAccount.SubjectTree, len(tree.Children)),
+	}
+
+	for i := 0; i < len(tree.Subjects); i++ {
+		res.Subjects[i] = tree.Subjects[i].String()
+	}
+
+	for i := 0; i < len(tree.Children); i++ {
+		res.Children[i] = subjectTreeResponse(tree.Children[i])
+	}
+
+	return res
+}
+
+func relationError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidTuple),
+		errors.Is(err, domain.ErrUnknownNamespace),
+		errors.Is(err, domain.ErrUnknownRelation):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, domain.ErrRelationDepth):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, domain.ErrOtherTenant):
+		return permissionError(err)
+	}
+
+	return err
+}
@@ -2,23 +2,21 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
-	"strings"
+	"log"
+	"os"
+	"time"
 
 	"github.com/adetxt/edison"
 	"github.com/adetxt/user/config"
+	"github.com/adetxt/user/domain"
 	pbAccount "github.com/adetxt/user/gen/proto/go/account/v1"
 	grpcHdl "github.com/adetxt/user/handler/grpc"
+	relationmysql "github.com/adetxt/user/repository/relation_mysql"
+	userbleve "github.com/adetxt/user/repository/user_bleve"
 	usermysql "github.com/adetxt/user/repository/user_mysql"
 	"github.com/adetxt/user/usecase"
-	"github.com/adetxt/user/utils/auth"
+	"github.com/adetxt/user/utils/mail"
 	"github.com/adetxt/user/utils/mysql"
-	"github.com/golang-jwt/jwt/v4"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 	"gorm.io/gorm"
 )
 
@@ -27,25 +25,46 @@ func main() {
 	db := initMySQL(cfg)
 
 	// DEVELOPMENT OPNLY
-	db.AutoMigrate(usermysql.User{}, usermysql.Role{}, usermysql.Permission{}, usermysql.RolePermission{}, usermysql.UserRole{})
+	db.AutoMigrate(usermysql.User{}, usermysql.Role{}, usermysql.Permission{}, usermysql.RolePermission{}, usermysql.UserRole{}, usermysql.RoleParent{}, usermysql.Policy{}, usermysql.Elevation{}, usermysql.AuditLog{}, usermysql.RoleConstraint{}, usermysql.RoleConstraintRole{}, usermysql.Organization{}, usermysql.OrgMember{}, usermysql.Group{}, usermysql.GroupRole{}, usermysql.GroupMember{}, usermysql.Invitation{}, usermysql.EmailVerification{}, usermysql.AttributeDefinition{}, relationmysql.RelationTuple{})
+
+	// emails used to be unique among all users, they are now among users
+	// not deleted, see usermysql.User
+	if db.Migrator().HasIndex(&usermysql.User{}, "email") {
+		db.Migrator().DropIndex(&usermysql.User{}, "email")
+	}
 
 	// repository
 	userRepo := usermysql.New(db)
+	userSearcher := initUserSearcher(cfg, db)
+	relationRepo := relationmysql.New(db)
 
 	// usecase
-	userUc := usecase.NewUserUsecase(userRepo)
-	authUc := usecase.NewAuthUsecase(cfg, userRepo)
+	mailer := initMailer(cfg)
+	userUc := usecase.NewUserUsecase(cfg, userRepo, mailer, userSearcher)
+	authUc := usecase.NewAuthUsecase(cfg, userRepo, mailer, userSearcher, initRegistrationGuard(cfg))
+	relationUc := usecase.NewRelationUsecase(loadNamespaces(cfg), relationRepo)
+
+	go sweepExpiredRoles(cfg, userUc)
+	go purgeDeletedUsers(cfg, userUc)
+
+	// the bleve index misses the changes made while the service was down
+	if cfg.UserSearch == "bleve" {
+		go reindexUsers(userUc)
+	}
 
 	// handler
 	accountHdl := grpcHdl.NewAccountHandler(userUc)
 	authHdl := grpcHdl.NewAuthHandler(cfg, authUc)
+	authorizationHdl := grpcHdl.NewAuthorizationHandler(userUc)
+	relationHdl := grpcHdl.NewRelationHandler(relationUc)
 
 	// init edison
 	ed := edison.New()
 
-	// register interceptor
+	// register interceptor, edison only supports unary interceptors
+	authInterceptor := grpcHdl.NewAuthInterceptor(cfg, userUc)
 	ed.UnaryServerInterceptor(
-		localAuthInterceptor(cfg.JWTKey),
+		authInterceptor.Unary(),
 	)
 
 	ed.Prepare(
@@ -65,6 +84,8 @@ func main() {
 
 	pbAccount.RegisterAccountService(ed, accountHdl)
 	pbAccount.RegisterAuthService(ed, authHdl)
+	pbAccount.RegisterAuthorizationService(ed, authorizationHdl)
+	pbAccount.RegisterRelationService(ed, relationHdl)
 
 	ed.Start()
 }
@@ -79,61 +100,89 @@ func initMySQL(cfg config.Config) *gorm.DB {
 	})
 }
 
-func localAuthInterceptor(JWTKey string) grpc.UnaryServerInterceptor {
-	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		data := map[string]interface{}{}
-
-		// Skip authorize when GetJWT is requested
-		if info.FullMethod != "/account.v1.AuthService/Login" {
-			claims, err := authorize(ctx, JWTKey, info.FullMethod)
-			if err != nil {
-				return nil, err
-			}
-
-			data = claims
-		}
+func initMailer(cfg config.Config) mail.Sender {
+	return mail.New(&mail.Config{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.MailFrom,
+	})
+}
 
-		b, err := json.Marshal(data)
+func initUserSearcher(cfg config.Config, db *gorm.DB) domain.UserSearcher {
+	switch cfg.UserSearch {
+	case "mysql":
+		return usermysql.NewSearcher(db)
+	case "bleve":
+		searcher, err := userbleve.New(cfg.UserSearchIndex)
 		if err != nil {
-			return nil, err
+			log.Fatal(err.Error())
 		}
 
-		ctx = context.WithValue(ctx, "claims", string(b))
+		return searcher
+	}
 
-		// Calls the handler
-		h, err := handler(ctx, req)
+	log.Fatalf("invalid user search %q", cfg.UserSearch)
+	return nil
+}
 
-		return h, err
+func initRegistrationGuard(cfg config.Config) domain.RegistrationGuard {
+	switch cfg.RegistrationGuard {
+	case "ratelimit":
+		return usecase.NewRateLimitGuard(cfg.RegistrationRateLimit, cfg.RegistrationRateWindow)
+	case "pow":
+		return usecase.NewProofOfWorkGuard(cfg.RegistrationPowBits)
+	case "none":
+		return nil
 	}
+
+	log.Fatalf("invalid registration guard %q", cfg.RegistrationGuard)
+	return nil
 }
 
-func authorize(ctx context.Context, JWTKey, fullMth string) (map[string]interface{}, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return nil, status.Errorf(codes.InvalidArgument, "Retrieving metadata is failed")
+func loadNamespaces(cfg config.Config) []domain.Namespace {
+	data, err := os.ReadFile(cfg.RelationNamespaces)
+	if err != nil {
+		log.Fatal(err.Error())
 	}
 
-	authHeader, ok := md["authorization"]
-	if !ok {
-		return nil, status.Errorf(codes.Unauthenticated, "Authorization token is not supplied")
+	namespaces, err := domain.ParseNamespaces(data)
+	if err != nil {
+		log.Fatal(err.Error())
 	}
 
-	token := authHeader[0]
+	return namespaces
+}
 
-	if strings.Contains(token, " ") {
-		tokenParts := strings.Split(token, " ")
-		token = tokenParts[1]
-	}
+// sweepExpiredRoles removes expired role grants every cfg.RoleSweepInterval.
+func sweepExpiredRoles(cfg config.Config, userUc domain.UserUsecase) {
+	ticker := time.NewTicker(cfg.RoleSweepInterval)
+	defer ticker.Stop()
 
-	// validateToken function validates the token
-	claims, err := auth.ParseToken(token, JWTKey)
-	if err != nil && !errors.Is(err, jwt.ErrTokenExpired) {
-		return nil, status.Errorf(codes.Unauthenticated, err.Error())
+	for range ticker.C {
+		if err := userUc.SweepExpiredRoles(context.Background()); err != nil {
+			log.Println(err.Error())
+		}
 	}
+}
+
+// purgeDeletedUsers removes users deleted longer than the retention every
+// cfg.PurgeInterval.
+func purgeDeletedUsers(cfg config.Config, userUc domain.UserUsecase) {
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
 
-	if fullMth != "/account.v1.AuthService/RefreshToken" && errors.Is(err, jwt.ErrTokenExpired) {
-		return nil, status.Errorf(codes.Unavailable, "token is expired")
+	for range ticker.C {
+		if err := userUc.PurgeDeletedUsers(context.Background()); err != nil {
+			log.Println(err.Error())
+		}
 	}
+}
 
-	return claims, nil
+// reindexUsers adds every user to the search index.
+func reindexUsers(userUc domain.UserUsecase) {
+	if err := userUc.ReindexUsers(context.Background()); err != nil {
+		log.Println(err.Error())
+	}
 }
@@ -0,0 +1,93 @@
+package relationmemory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/adetxt/user/domain"
+)
+
+// repository keeps relation tuples in memory, in write order. It is meant
+// for tests and local runs, nothing is persisted.
+type repository struct {
+	mu     sync.RWMutex
+	tuples []domain.RelationTuple
+}
+
+func New() domain.RelationRepository {
+	return &repository{}
+}
+
+func (r *repository) WriteTuples(ctx context.Context, writes, deletes []domain.RelationTuple) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range deletes {
+		r.remove(v)
+	}
+
+	for _, v := range writes {
+		if !r.contains(v) {
+			r.tuples = append(r.tuples, v)
+		}
+	}
+
+	return nil
+}
+
+func (r *repository) ReadTuples(ctx context.Context, filter *domain.TupleFilter) ([]domain.RelationTuple, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := []domain.RelationTuple{}
+	for _, v := range r.tuples {
+		if matchFilter(v, filter) {
+			res = append(res, v)
+		}
+	}
+
+	return res, nil
+}
+
+func (r *repository) contains(tuple domain.RelationTuple) bool {
+	for _, v := range r.tuples {
+		if v == tuple {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *repository) remove(tuple domain.RelationTuple) {
+	for i := 0; i < len(r.tuples); i++ {
+		if r.tuples[i] == tuple {
+			r.tuples = append(r.tuples[:i], r.tuples[i+1:]...)
+			return
+		}
+	}
+}
+
+func matchFilter(tuple domain.RelationTuple, filter *domain.TupleFilter) bool {
+	if filter.Namespace != "" && tuple.Object.Namespace != filter.Namespace {
+		return false
+	}
+
+	if filter.ObjectID != "" && tuple.Object.ID != filter.ObjectID {
+		return false
+	}
+
+	if filter.Relation != "" && tuple.Relation != filter.Relation {
+		return false
+	}
+
+	if filter.Subject != nil && tuple.Subject != *filter.Subject {
+		return false
+	}
+
+	if filter.SubjectObject != nil && tuple.Subject.Object != *filter.SubjectObject {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,47 @@
+package relationmysql
+
+import (
+	"github.com/adetxt/user/domain"
+)
+
+type RelationTuple struct {
+	ID               int64  `gorm:"column:id;primaryKey"`
+	Namespace        string `gorm:"column:namespace;size:64;uniqueIndex:idx_tuple;index:idx_subject,priority:4"`
+	ObjectID         string `gorm:"column:object_id;size:128;uniqueIndex:idx_tuple"`
+	Relation         string `gorm:"column:relation;size:64;uniqueIndex:idx_tuple"`
+	SubjectNamespace string `gorm:"column:subject_namespace;size:64;uniqueIndex:idx_tuple;index:idx_subject,priority:1"`
+	SubjectID        string `gorm:"column:subject_id;size:128;uniqueIndex:idx_tuple;index:idx_subject,priority:2"`
+	SubjectRelation  string `gorm:"column:subject_relation;size:64;uniqueIndex:idx_tuple;index:idx_subject,priority:3;default:''"`
+}
+
+func (RelationTuple) TableName() string {
+	return "relation_tuples"
+}
+
+func (i *RelationTuple) ToEntity() domain.RelationTuple {
+	return domain.RelationTuple{
+		Object: domain.Object{
+			Namespace: i.Namespace,
+			ID:        i.ObjectID,
+		},
+		Relation: i.Relation,
+		Subject: domain.Subject{
+			Object: domain.Object{
+				Namespace: i.SubjectNamespace,
+				ID:        i.SubjectID,
+			},
+			Relation: i.SubjectRelation,
+		},
+	}
+}
+
+func MakeRelationTuple(i domain.RelationTuple) *RelationTuple {
+	return &RelationTuple{
+		Namespace:        i.Object.Namespace,
+		ObjectID:         i.Object.ID,
+		Relation:         i.Relation,
+		SubjectNamespace: i.Subject.Object.Namespace,
+		SubjectID:        i.Subject.Object.ID,
+		SubjectRelation:  i.Subject.Relation,
+	}
+}
@@ -0,0 +1,85 @@
+package relationmysql
+
+import (
+	"context"
+
+	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type repository struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) domain.RelationRepository {
+	return &repository{
+		db: db,
+	}
+}
+
+func (r *repository) WriteTuples(ctx context.Context, writes, deletes []domain.RelationTuple) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, v := range deletes {
+			// a struct condition would skip the empty subject relation
+			if err := tx.Where(map[string]interface{}{
+				"namespace":         v.Object.Namespace,
+				"object_id":         v.Object.ID,
+				"relation":          v.Relation,
+				"subject_namespace": v.Subject.Object.Namespace,
+				"subject_id":        v.Subject.Object.ID,
+				"subject_relation":  v.Subject.Relation,
+			}).Delete(&RelationTuple{}).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(writes) == 0 {
+			return nil
+		}
+
+		tuples := make([]*RelationTuple, len(writes))
+		for i := 0; i < len(writes); i++ {
+			tuples[i] = MakeRelationTuple(writes[i])
+		}
+
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tuples).Error
+	})
+}
+
+func (r *repository) ReadTuples(ctx context.Context, filter *domain.TupleFilter) ([]domain.RelationTuple, error) {
+	tuples := []RelationTuple{}
+	db := r.db.Model(&RelationTuple{})
+
+	if filter.Namespace != "" {
+		db = db.Where("namespace = ?", filter.Namespace)
+	}
+
+	if filter.ObjectID != "" {
+		db = db.Where("object_id = ?", filter.ObjectID)
+	}
+
+	if filter.Relation != "" {
+		db = db.Where("relation = ?", filter.Relation)
+	}
+
+	if filter.Subject != nil {
+		db = db.Where("subject_namespace = ? AND subject_id = ? AND subject_relation = ?",
+			filter.Subject.Object.Namespace, filter.Subject.Object.ID, filter.Subject.Relation)
+	}
+
+	if filter.SubjectObject != nil {
+		db = db.Where("subject_namespace = ? AND subject_id = ?", filter.SubjectObject.Namespace, filter.SubjectObject.ID)
+	}
+
+	if err := db.Order("id asc").Find(&tuples).Error; err != nil {
+		return nil, err
+	}
+
+	res := make([]domain.RelationTuple, len(tuples))
+	for i := 0; i < len(tuples); i++ {
+		res[i] = tuples[i].ToEntity()
+	}
+
+	return res, nil
+}
@@ -0,0 +1,175 @@
+package userbleve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adetxt/user/domain"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+type searcher struct {
+	index bleve.Index
+}
+
+// document is what is indexed of a user, every field analyzed by the
+// standard analyzer but Orgs, the IDs of its organizations, which are kept
+// as they are.
+type document struct {
+	Name       string   `json:"name"`
+	Email      string   `json:"email"`
+	Attributes string   `json:"attributes"`
+	Orgs       []string `json:"orgs"`
+}
+
+// New opens the Bleve index at path, creating it when missing. The index
+// only follows the changes made through the usecases and holds users of
+// every organization, searches being limited to those of their tenant.
+func New(path string) (domain.UserSearcher, error) {
+	index, err := bleve.Open(path)
+	if errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		index, err = bleve.New(path, indexMapping())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &searcher{
+		index: index,
+	}, nil
+}
+
+func (s *searcher) Index(ctx context.Context, users []*domain.User) error {
+	batch := s.index.NewBatch()
+
+	for _, v := range users {
+		if err := batch.Index(strconv.FormatInt(v.ID, 10), makeDocument(v)); err != nil {
+			return err
+		}
+	}
+
+	return s.index.Batch(batch)
+}
+
+func (s *searcher) Remove(ctx context.Context, ids []int64) error {
+	batch := s.index.NewBatch()
+
+	for _, v := range ids {
+		batch.Delete(strconv.FormatInt(v, 10))
+	}
+
+	return s.index.Batch(batch)
+}
+
+func (s *searcher) Search(ctx context.Context, terms []domain.SearchTerm, limit int) ([]int64, error) {
+	ids := []int64{}
+	if len(terms) == 0 {
+		return ids, nil
+	}
+
+	conjuncts := make([]query.Query, len(terms))
+	for i, t := range terms {
+		disjuncts := make([]query.Query, len(t.Fields))
+		for j, f := range t.Fields {
+			disjuncts[j] = termQuery(t, string(f))
+		}
+
+		conjuncts[i] = bleve.NewDisjunctionQuery(disjuncts...)
+	}
+
+	// filtering in the query, not the hits, so that limit counts the users
+	// of the tenant only
+	if tenantID := domain.TenantID(ctx); tenantID != 0 {
+		q := bleve.NewTermQuery(strconv.FormatInt(tenantID, 10))
+		q.SetField("orgs")
+
+		conjuncts = append(conjuncts, q)
+	}
+
+	// hits are sorted by descending score
+	res, err := s.index.SearchInContext(ctx, bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(conjuncts...), limit, 0, false))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range res.Hits {
+		id, err := strconv.ParseInt(v.ID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user id %q in the search index", v.ID)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func indexMapping() mapping.IndexMapping {
+	orgs := bleve.NewTextFieldMapping()
+	orgs.Analyzer = keyword.Name
+
+	m := bleve.NewIndexMapping()
+	m.DefaultMapping.AddFieldMappingsAt("orgs", orgs)
+
+	return m
+}
+
+// termQuery matches t in field. Prefix and fuzzy queries are not analyzed,
+// so their text is lowercased as the standard analyzer does.
+func termQuery(t domain.SearchTerm, field string) query.Query {
+	switch {
+	case t.Prefix:
+		q := bleve.NewPrefixQuery(strings.ToLower(t.Text))
+		q.SetField(field)
+
+		return q
+	case t.Fuzziness > 0:
+		q := bleve.NewFuzzyQuery(strings.ToLower(t.Text))
+		q.SetFuzziness(t.Fuzziness)
+		q.SetField(field)
+
+		return q
+	default:
+		q := bleve.NewMatchQuery(t.Text)
+		q.SetOperator(query.MatchQueryOperatorAnd)
+		q.SetField(field)
+
+		return q
+	}
+}
+
+// makeDocument indexes the values of the attributes as text, sorted by
+// name.
+func makeDocument(user *domain.User) document {
+	names := make([]string, 0, len(user.Attributes))
+	for k := range user.Attributes {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	values := make([]string, len(names))
+	for i, v := range names {
+		values[i] = fmt.Sprint(user.Attributes[v])
+	}
+
+	orgs := make([]string, len(user.OrgIDs))
+	for i, v := range user.OrgIDs {
+		orgs[i] = strconv.FormatInt(v, 10)
+	}
+
+	return document{
+		Name:       user.Name,
+		Email:      user.Email,
+		Attributes: strings.Join(values, " "),
+		Orgs:       orgs,
+	}
+}
@@ -0,0 +1,58 @@
+package userbleve
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/adetxt/user/domain"
+)
+
+func TestSearchTenants(t *testing.T) {
+	s, err := New(filepath.Join(t.TempDir(), "users.bleve"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	// the users of tenant 2 match best, so a limit applied before the
+	// tenant would leave tenant 1 without any
+	if err := s.Index(ctx, []*domain.User{
+		{ID: 1, Name: "alice anne marie smith", OrgIDs: []int64{1}},
+		{ID: 2, Name: "alice", OrgIDs: []int64{2}},
+		{ID: 3, Name: "alice anne", OrgIDs: []int64{2, 12}},
+		{ID: 4, Name: "bob", OrgIDs: []int64{1}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	terms, err := domain.ParseSearchQuery("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tenant int64
+		limit  int
+		want   []int64
+	}{
+		{tenant: 1, limit: 1, want: []int64{1}},
+		{tenant: 2, limit: 10, want: []int64{2, 3}},
+		{tenant: 12, limit: 10, want: []int64{3}},
+		{tenant: 3, limit: 10, want: []int64{}},
+		{tenant: 0, limit: 10, want: []int64{2, 3, 1}},
+	}
+
+	for _, tt := range tests {
+		got, err := s.Search(domain.WithTenant(ctx, tt.tenant), terms, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tenant %d: got %v, want %v", tt.tenant, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package usermysql
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
+)
+
+func (r *repository) ListAttributeDefinitions(ctx context.Context) ([]*domain.AttributeDefinition, error) {
+	definitions := []AttributeDefinition{}
+
+	if err := r.db.WithContext(ctx).Order("name asc").Find(&definitions).Error; err != nil {
+		return nil, err
+	}
+
+	res := make([]*domain.AttributeDefinition, len(definitions))
+	for i := 0; i < len(definitions); i++ {
+		res[i] = definitions[i].ToEntity()
+	}
+
+	return res, nil
+}
+
+func (r *repository) CreateAttributeDefinition(ctx context.Context, data *domain.AttributeDefinition) (int64, error) {
+	definition := AttributeDefinition{
+		Name:        data.Name,
+		Description: data.Description,
+		Type:        string(data.Type),
+		Required:    data.Required,
+		Unique:      data.Unique,
+		Pattern:     data.Pattern,
+	}
+
+	if err := r.db.WithContext(ctx).Create(&definition).Error; err != nil {
+		return 0, err
+	}
+
+	return definition.ID, nil
+}
+
+func (r *repository) DeleteAttributeDefinition(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		definition := AttributeDefinition{}
+		if err := tx.Where("id = ?", id).First(&definition).Error; err != nil {
+			return err
+		}
+
+		// removing the attribute is no change made to the users, so their
+		// updated_at is left alone
+		path := attributePath(definition.Name)
+		if err := skipTenant(tx).Unscoped().Model(&User{}).
+			Where("JSON_CONTAINS_PATH(attributes, 'one', ?)", path).
+			UpdateColumn("attributes", gorm.Expr("JSON_REMOVE(attributes, ?)", path)).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&definition).Error
+	})
+}
+
+// AttributeValueTaken compares JSON values, so 1 and "1" differ. Deleted
+// users keep their values until purged, so restoring them never conflicts.
+func (r *repository) AttributeValueTaken(ctx context.Context, name string, value interface{}, userID int64) (bool, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+
+	var taken int64
+
+	if err := skipTenant(r.db.WithContext(ctx)).Unscoped().Model(&User{}).
+		Where("id <> ? AND JSON_EXTRACT(attributes, ?) = CAST(? AS JSON)", userID, attributePath(name), string(b)).
+		Count(&taken).Error; err != nil {
+		return false, err
+	}
+
+	return taken > 0, nil
+}
+
+// attributePath is the JSON path of the attribute name, which is always
+// bound as a parameter.
+func attributePath(name string) string {
+	return `$."` + name + `"`
+}
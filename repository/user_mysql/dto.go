@@ -1,21 +1,54 @@
 package usermysql
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
 )
 
 type User struct {
-	ID       int64  `gorm:"column:id;primaryKey"`
-	Name     string `gorm:"column:name"`
-	Email    string `gorm:"column:email;unique"`
-	Password string `gorm:"column:password"`
-	Roles    []Role `gorm:"many2many:user_roles"`
+	ID                int64      `gorm:"column:id;primaryKey"`
+	Name              string     `gorm:"column:name;index:idx_users_name_search,class:FULLTEXT"`
+	Email             string     `gorm:"column:email;index;index:idx_users_email_search,class:FULLTEXT"`
+	Password          string     `gorm:"column:password"`
+	Status            string     `gorm:"column:status;index;default:active"`
+	StatusReason      string     `gorm:"column:status_reason"`
+	StatusUntil       *time.Time `gorm:"column:status_until"`
+	FailedLogins      int        `gorm:"column:failed_logins;default:0"`
+	PermissionVersion int64      `gorm:"column:permission_version;default:1"`
+	// CreatedAt and UpdatedAt default to the time the columns were added
+	// for users created before.
+	CreatedAt         time.Time  `gorm:"column:created_at;autoCreateTime;default:CURRENT_TIMESTAMP(3);index"`
+	UpdatedAt         time.Time  `gorm:"column:updated_at;autoUpdateTime;default:CURRENT_TIMESTAMP(3);index"`
+	LastLoginAt       *time.Time `gorm:"column:last_login_at;index"`
+	PasswordChangedAt *time.Time `gorm:"column:password_changed_at;index"`
+	Attributes        Attributes `gorm:"column:attributes;type:json"`
+	// DeletedAt soft deletes users, who are purged after the retention.
+	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;index"`
+	// ActiveEmail is the email of users not deleted, so emails are unique
+	// among them only. MySQL has no partial indexes.
+	ActiveEmail *string `gorm:"column:active_email;->;type:varchar(191) GENERATED ALWAYS AS (IF(deleted_at IS NULL, email, NULL)) STORED;uniqueIndex"`
+	// SearchAttributes holds the values of Attributes for full-text search.
+	SearchAttributes *string `gorm:"column:search_attributes;->;type:text GENERATED ALWAYS AS (JSON_UNQUOTE(JSON_EXTRACT(attributes, '$.*'))) STORED;index:idx_users_attributes_search,class:FULLTEXT"`
+	// Roles are the active roles of the user, Groups its groups and
+	// GroupRoles the roles of those groups, all loaded by loadRoles.
+	Roles      []Role  `gorm:"-"`
+	Groups     []Group `gorm:"-"`
+	GroupRoles []Role  `gorm:"-"`
 }
 
 type Role struct {
 	ID          int64        `gorm:"column:id;primaryKey"`
 	Name        string       `gorm:"column:name;unique"`
 	Permissions []Permission `gorm:"many2many:role_permissions"`
+	// Parents are the roles whose permissions this role inherits.
+	Parents []Role `gorm:"many2many:role_parents;joinForeignKey:RoleID;joinReferences:ParentID"`
+	// Grants are the scoped permissions of the role, loaded by findRoles.
+	Grants []domain.Grant `gorm:"-"`
 }
 
 type Permission struct {
@@ -24,13 +57,166 @@ type Permission struct {
 }
 
 type UserRole struct {
-	UserID int64 `gorm:"column:user_id;uniqueIndex:idx_id"`
-	RoleID int64 `gorm:"column:role_id;uniqueIndex:idx_id"`
+	UserID int64 `gorm:"column:user_id;uniqueIndex:idx_org_user_role"`
+	RoleID int64 `gorm:"column:role_id;uniqueIndex:idx_org_user_role"`
+	// OrgID is the organization the role is held in, zero for platform
+	// roles.
+	OrgID     int64     `gorm:"column:org_id;uniqueIndex:idx_org_user_role;default:0"`
+	GrantedBy int64     `gorm:"column:granted_by;default:0"`
+	GrantedAt time.Time `gorm:"column:granted_at;autoCreateTime"`
+	// ExpiresAt is nil for grants that never expire.
+	ExpiresAt *time.Time `gorm:"column:expires_at;index"`
 }
 
 type RolePermission struct {
+	RoleID       int64  `gorm:"column:role_id;uniqueIndex:idx_id"`
+	PermissionID int64  `gorm:"column:permission_id;uniqueIndex:idx_id"`
+	Scope        string `gorm:"column:scope;uniqueIndex:idx_id;default:''"`
+	PolicyID     int64  `gorm:"column:policy_id;uniqueIndex:idx_id;default:0"`
+}
+
+type Policy struct {
+	ID          int64  `gorm:"column:id;primaryKey"`
+	Name        string `gorm:"column:name;unique"`
+	Description string `gorm:"column:description"`
+	Expression  string `gorm:"column:expression"`
+}
+
+type Elevation struct {
+	ID              int64      `gorm:"column:id;primaryKey"`
+	UserID          int64      `gorm:"column:user_id;index"`
+	OrgID           int64      `gorm:"column:org_id;index;default:0"`
+	RoleID          int64      `gorm:"column:role_id"`
+	Role            Role       `gorm:"foreignKey:RoleID"`
+	Reason          string     `gorm:"column:reason"`
+	DurationSeconds int64      `gorm:"column:duration_seconds"`
+	Status          string     `gorm:"column:status;index"`
+	ApprovedBy      int64      `gorm:"column:approved_by;default:0"`
+	ApprovedAt      *time.Time `gorm:"column:approved_at"`
+	ExpiresAt       *time.Time `gorm:"column:expires_at"`
+	CreatedAt       time.Time  `gorm:"column:created_at;autoCreateTime"`
+}
+
+type AuditLog struct {
+	ID           int64     `gorm:"column:id;primaryKey"`
+	OrgID        int64     `gorm:"column:org_id;index;default:0"`
+	ActorID      int64     `gorm:"column:actor_id;index"`
+	Action       string    `gorm:"column:action;index"`
+	TargetUserID int64     `gorm:"column:target_user_id;index"`
+	Detail       string    `gorm:"column:detail"`
+	CreatedAt    time.Time `gorm:"column:created_at;autoCreateTime"`
+}
+
+type Organization struct {
+	ID        int64     `gorm:"column:id;primaryKey"`
+	Name      string    `gorm:"column:name;unique"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
+}
+
+type OrgMember struct {
+	OrgID     int64     `gorm:"column:org_id;uniqueIndex:idx_id"`
+	UserID    int64     `gorm:"column:user_id;uniqueIndex:idx_id"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime"`
+}
+
+type Group struct {
+	ID    int64  `gorm:"column:id;primaryKey"`
+	OrgID int64  `gorm:"column:org_id;uniqueIndex:idx_org_name;default:0"`
+	Name  string `gorm:"column:name;uniqueIndex:idx_org_name"`
+	Roles []Role `gorm:"many2many:group_roles;joinForeignKey:GroupID;joinReferences:RoleID"`
+}
+
+type GroupRole struct {
+	GroupID int64 `gorm:"column:group_id;uniqueIndex:idx_id"`
+	RoleID  int64 `gorm:"column:role_id;uniqueIndex:idx_id"`
+}
+
+// GroupMember copies the organization of its group, so memberships can be
+// filtered by tenant like role grants.
+type GroupMember struct {
+	GroupID int64 `gorm:"column:group_id;uniqueIndex:idx_id"`
+	UserID  int64 `gorm:"column:user_id;uniqueIndex:idx_id"`
+	OrgID   int64 `gorm:"column:org_id;index;default:0"`
+}
+
+// Invitation stores the hash of the invitation token, never the token.
+type Invitation struct {
+	ID         int64      `gorm:"column:id;primaryKey"`
+	UserID     int64      `gorm:"column:user_id;index"`
+	User       User       `gorm:"foreignKey:UserID"`
+	OrgID      int64      `gorm:"column:org_id;index;default:0"`
+	InvitedBy  int64      `gorm:"column:invited_by;default:0"`
+	TokenHash  string     `gorm:"column:token_hash;unique"`
+	ExpiresAt  time.Time  `gorm:"column:expires_at"`
+	AcceptedAt *time.Time `gorm:"column:accepted_at"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at"`
+	CreatedAt  time.Time  `gorm:"column:created_at;autoCreateTime"`
+}
+
+type EmailVerification struct {
+	ID         int64      `gorm:"column:id;primaryKey"`
+	UserID     int64      `gorm:"column:user_id;index"`
+	TokenHash  string     `gorm:"column:token_hash;unique"`
+	ExpiresAt  time.Time  `gorm:"column:expires_at"`
+	VerifiedAt *time.Time `gorm:"column:verified_at"`
+	CreatedAt  time.Time  `gorm:"column:created_at;autoCreateTime"`
+}
+
+type RoleConstraint struct {
+	ID    int64  `gorm:"column:id;primaryKey"`
+	Name  string `gorm:"column:name;unique"`
+	Roles []Role `gorm:"many2many:role_constraint_roles;joinForeignKey:ConstraintID;joinReferences:RoleID"`
+}
+
+type RoleConstraintRole struct {
+	ConstraintID int64 `gorm:"column:constraint_id;uniqueIndex:idx_id"`
 	RoleID       int64 `gorm:"column:role_id;uniqueIndex:idx_id"`
-	PermissionID int64 `gorm:"column:permission_id;uniqueIndex:idx_id"`
+}
+
+type RoleParent struct {
+	RoleID   int64 `gorm:"column:role_id;uniqueIndex:idx_id"`
+	ParentID int64 `gorm:"column:parent_id;uniqueIndex:idx_id"`
+}
+
+// Attributes are the custom attributes of a user, stored as a JSON object.
+type Attributes map[string]interface{}
+
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+func (a *Attributes) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, a)
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	}
+
+	return fmt.Errorf("cannot scan %T into attributes", value)
+}
+
+type AttributeDefinition struct {
+	ID          int64  `gorm:"column:id;primaryKey"`
+	Name        string `gorm:"column:name;unique"`
+	Description string `gorm:"column:description"`
+	Type        string `gorm:"column:type"`
+	Required    bool   `gorm:"column:required"`
+	// Unique is stored as is_unique, unique being a reserved word.
+	Unique  bool   `gorm:"column:is_unique"`
+	Pattern string `gorm:"column:pattern"`
 }
 
 func (User) TableName() string {
@@ -53,13 +239,81 @@ func (RolePermission) TableName() string {
 	return "role_permissions"
 }
 
+func (Policy) TableName() string {
+	return "policies"
+}
+
+func (RoleParent) TableName() string {
+	return "role_parents"
+}
+
+func (RoleConstraint) TableName() string {
+	return "role_constraints"
+}
+
+func (RoleConstraintRole) TableName() string {
+	return "role_constraint_roles"
+}
+
+func (Elevation) TableName() string {
+	return "elevations"
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+func (Group) TableName() string {
+	return "user_groups"
+}
+
+func (GroupRole) TableName() string {
+	return "group_roles"
+}
+
+func (GroupMember) TableName() string {
+	return "group_members"
+}
+
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+func (OrgMember) TableName() string {
+	return "org_members"
+}
+
+func (Invitation) TableName() string {
+	return "invitations"
+}
+
+func (EmailVerification) TableName() string {
+	return "email_verifications"
+}
+
+func (AttributeDefinition) TableName() string {
+	return "attribute_definitions"
+}
+
 func (i *User) ToEntity() *domain.User {
 	return &domain.User{
-		ID:       i.ID,
-		Name:     i.Name,
-		Email:    i.Email,
-		Password: i.Password,
-		Roles:    i.RoleNames(),
+		ID:                i.ID,
+		Name:              i.Name,
+		Email:             i.Email,
+		Password:          i.Password,
+		Status:            domain.UserStatus(i.Status),
+		StatusReason:      i.StatusReason,
+		StatusUntil:       i.StatusUntil,
+		CreatedAt:         i.CreatedAt,
+		UpdatedAt:         i.UpdatedAt,
+		LastLoginAt:       i.LastLoginAt,
+		PasswordChangedAt: i.PasswordChangedAt,
+		DeletedAt:         deletedAt(i.DeletedAt),
+		Attributes:        i.Attributes,
+		Roles:             i.RoleNames(),
+		Groups:            i.GroupNames(),
+		GroupRoles:        i.GroupRoleNames(),
+		PermissionVersion: i.PermissionVersion,
 	}
 }
 
@@ -71,6 +325,22 @@ func (i *User) RoleNames() (res []string) {
 	return
 }
 
+func (i *User) GroupNames() (res []string) {
+	for _, v := range i.Groups {
+		res = append(res, v.Name)
+	}
+
+	return
+}
+
+func (i *User) GroupRoleNames() (res []string) {
+	for _, v := range i.GroupRoles {
+		res = append(res, v.Name)
+	}
+
+	return
+}
+
 func (i *Role) PermissionNames() (res []string) {
 	for _, v := range i.Permissions {
 		res = append(res, v.Name)
@@ -79,11 +349,150 @@ func (i *Role) PermissionNames() (res []string) {
 	return
 }
 
+func (i *Role) GrantNames() (res []string) {
+	for _, v := range i.Grants {
+		res = append(res, v.String())
+	}
+
+	return
+}
+
+func (i *Role) ParentNames() (res []string) {
+	for _, v := range i.Parents {
+		res = append(res, v.Name)
+	}
+
+	return
+}
+
+func (i *RoleConstraint) ToEntity() *domain.RoleConstraint {
+	res := &domain.RoleConstraint{
+		ID:    i.ID,
+		Name:  i.Name,
+		Roles: []string{},
+	}
+
+	for _, v := range i.Roles {
+		res.Roles = append(res.Roles, v.Name)
+	}
+
+	return res
+}
+
+func (i *Permission) ToEntity() *domain.Permission {
+	return &domain.Permission{
+		ID:   i.ID,
+		Name: i.Name,
+	}
+}
+
+func (i *Policy) ToEntity() *domain.Policy {
+	return &domain.Policy{
+		ID:          i.ID,
+		Name:        i.Name,
+		Description: i.Description,
+		Expression:  i.Expression,
+	}
+}
+
+func MakePolicy(i *domain.Policy) *Policy {
+	return &Policy{
+		ID:          i.ID,
+		Name:        i.Name,
+		Description: i.Description,
+		Expression:  i.Expression,
+	}
+}
+
+func (i *Elevation) ToEntity() *domain.Elevation {
+	return &domain.Elevation{
+		ID:         i.ID,
+		UserID:     i.UserID,
+		OrgID:      i.OrgID,
+		Role:       i.Role.Name,
+		Reason:     i.Reason,
+		Duration:   time.Duration(i.DurationSeconds) * time.Second,
+		Status:     domain.ElevationStatus(i.Status),
+		ApprovedBy: i.ApprovedBy,
+		CreatedAt:  i.CreatedAt,
+		ExpiresAt:  i.ExpiresAt,
+	}
+}
+
+func MakeAuditLog(i *domain.AuditEntry) *AuditLog {
+	return &AuditLog{
+		OrgID:        i.OrgID,
+		ActorID:      i.ActorID,
+		Action:       i.Action,
+		TargetUserID: i.TargetUserID,
+		Detail:       i.Detail,
+	}
+}
+
+func (i *Group) ToEntity() *domain.Group {
+	res := &domain.Group{
+		ID:    i.ID,
+		OrgID: i.OrgID,
+		Name:  i.Name,
+		Roles: []string{},
+	}
+
+	for _, v := range i.Roles {
+		res.Roles = append(res.Roles, v.Name)
+	}
+
+	return res
+}
+
+func (i *Organization) ToEntity() *domain.Organization {
+	return &domain.Organization{
+		ID:        i.ID,
+		Name:      i.Name,
+		CreatedAt: i.CreatedAt,
+	}
+}
+
+func (i *Invitation) ToEntity() *domain.Invitation {
+	return &domain.Invitation{
+		ID:         i.ID,
+		UserID:     i.UserID,
+		OrgID:      i.OrgID,
+		Email:      i.User.Email,
+		InvitedBy:  i.InvitedBy,
+		ExpiresAt:  i.ExpiresAt,
+		AcceptedAt: i.AcceptedAt,
+		RevokedAt:  i.RevokedAt,
+		CreatedAt:  i.CreatedAt,
+	}
+}
+
+func (i *AttributeDefinition) ToEntity() *domain.AttributeDefinition {
+	return &domain.AttributeDefinition{
+		ID:          i.ID,
+		Name:        i.Name,
+		Description: i.Description,
+		Type:        domain.AttributeType(i.Type),
+		Required:    i.Required,
+		Unique:      i.Unique,
+		Pattern:     i.Pattern,
+	}
+}
+
+func deletedAt(v gorm.DeletedAt) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+
+	return &v.Time
+}
+
 func MakeUser(i *domain.User) *User {
 	return &User{
-		ID:       i.ID,
-		Name:     i.Name,
-		Email:    i.Email,
-		Password: i.Password,
+		ID:         i.ID,
+		Name:       i.Name,
+		Email:      i.Email,
+		Password:   i.Password,
+		Status:     string(i.Status),
+		Attributes: i.Attributes,
 	}
 }
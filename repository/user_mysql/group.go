@@ -0,0 +1,266 @@
+package usermysql
+
+import (
+	"context"
+
+	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *repository) ListGroups(ctx context.Context) ([]*domain.Group, error) {
+	groups := []Group{}
+
+	if err := r.db.WithContext(ctx).Preload("Roles").Order("name asc").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	res := make([]*domain.Group, len(groups))
+	for i := 0; i < len(groups); i++ {
+		res[i] = groups[i].ToEntity()
+	}
+
+	return res, nil
+}
+
+func (r *repository) GetGroup(ctx context.Context, id int64) (*domain.Group, error) {
+	group := Group{}
+
+	if err := r.db.WithContext(ctx).Preload("Roles").Where("id = ?", id).First(&group).Error; err != nil {
+		return nil, err
+	}
+
+	return group.ToEntity(), nil
+}
+
+// CreateGroup creates the group in the tenant of ctx.
+func (r *repository) CreateGroup(ctx context.Context, data *domain.Group) (int64, error) {
+	group := Group{
+		OrgID: domain.TenantID(ctx),
+		Name:  data.Name,
+	}
+
+	if err := r.db.WithContext(ctx).Create(&group).Error; err != nil {
+		return 0, err
+	}
+
+	return group.ID, nil
+}
+
+func (r *repository) DeleteGroup(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		group, err := getGroup(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := bumpGroupPermissionVersion(tx, group.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Where("group_id = ?", group.ID).Delete(&GroupMember{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("group_id = ?", group.ID).Delete(&GroupRole{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(group).Error
+	})
+}
+
+func (r *repository) GetGroupMembers(ctx context.Context, groupID int64) ([]*domain.User, error) {
+	db := r.db.WithContext(ctx)
+
+	group, err := getGroup(db, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []User{}
+
+	if err := db.Model(User{}).
+		Where("id IN (?)", db.Model(&GroupMember{}).Select("user_id").Where("group_id = ?", group.ID)).
+		Order("id asc").Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	if err := loadRoles(db, users); err != nil {
+		return nil, err
+	}
+
+	res := make([]*domain.User, len(users))
+	for i := 0; i < len(users); i++ {
+		res[i] = users[i].ToEntity()
+	}
+
+	return res, nil
+}
+
+// AddGroupMembers adds userIDs, who must all be users of the tenant, to the
+// group. The members must not end up holding roles kept apart by a
+// constraint.
+func (r *repository) AddGroupMembers(ctx context.Context, groupID int64, userIDs []int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		group, err := getGroup(tx, groupID)
+		if err != nil {
+			return err
+		}
+
+		var found int64
+
+		if err := tx.Model(User{}).Where("id IN ?", userIDs).Count(&found).Error; err != nil {
+			return err
+		}
+
+		if int(found) != len(uniqueIDs(userIDs)) {
+			return gorm.ErrRecordNotFound
+		}
+
+		members := make([]GroupMember, len(userIDs))
+		for i := 0; i < len(userIDs); i++ {
+			members[i] = GroupMember{
+				GroupID: group.ID,
+				UserID:  userIDs[i],
+				OrgID:   group.OrgID,
+			}
+		}
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error; err != nil {
+			return err
+		}
+
+		for _, v := range uniqueIDs(userIDs) {
+			if err := checkRoleConstraints(tx, v, group.OrgID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(User{}).Where("id IN ?", userIDs).
+			UpdateColumn("permission_version", gorm.Expr("permission_version + 1")).Error
+	})
+}
+
+func (r *repository) RemoveGroupMembers(ctx context.Context, groupID int64, userIDs []int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		group, err := getGroup(tx, groupID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("group_id = ? AND user_id IN ?", group.ID, userIDs).Delete(&GroupMember{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(User{}).Where("id IN ?", userIDs).
+			UpdateColumn("permission_version", gorm.Expr("permission_version + 1")).Error
+	})
+}
+
+// AssignGroupRoles assigns the named roles to the group, checking every
+// member against the role constraints.
+func (r *repository) AssignGroupRoles(ctx context.Context, groupID int64, names []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		group, err := getGroup(tx, groupID)
+		if err != nil {
+			return err
+		}
+
+		roles := []Role{}
+
+		if err := tx.Where("name IN ?", names).Find(&roles).Error; err != nil {
+			return err
+		}
+
+		if len(roles) != len(uniqueStrings(names)) {
+			return domain.ErrRoleNotFound
+		}
+
+		groupRoles := make([]GroupRole, len(roles))
+		for i := 0; i < len(roles); i++ {
+			groupRoles[i] = GroupRole{
+				GroupID: group.ID,
+				RoleID:  roles[i].ID,
+			}
+		}
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&groupRoles).Error; err != nil {
+			return err
+		}
+
+		members := []int64{}
+
+		if err := tx.Model(&GroupMember{}).Where("group_id = ?", group.ID).Pluck("user_id", &members).Error; err != nil {
+			return err
+		}
+
+		for _, v := range members {
+			if err := checkRoleConstraints(tx, v, group.OrgID); err != nil {
+				return err
+			}
+		}
+
+		return bumpGroupPermissionVersion(tx, group.ID)
+	})
+}
+
+func (r *repository) RevokeGroupRoles(ctx context.Context, groupID int64, names []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		group, err := getGroup(tx, groupID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("group_id = ?", group.ID).
+			Where("role_id IN (?)", tx.Model(Role{}).Select("id").Where("name IN ?", names)).
+			Delete(&GroupRole{}).Error; err != nil {
+			return err
+		}
+
+		return bumpGroupPermissionVersion(tx, group.ID)
+	})
+}
+
+func (r *repository) GetUserGroupIDs(ctx context.Context, userID int64) ([]int64, error) {
+	ids := []int64{}
+
+	if err := r.db.WithContext(ctx).Model(&GroupMember{}).
+		Where("user_id = ?", userID).
+		Order("group_id asc").Pluck("group_id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func getGroup(tx *gorm.DB, id int64) (*Group, error) {
+	group := &Group{}
+	if err := tx.Where("id = ?", id).First(group).Error; err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// bumpGroupPermissionVersion invalidates the permissions embedded in the
+// access tokens of the members of groupID.
+func bumpGroupPermissionVersion(tx *gorm.DB, groupID int64) error {
+	return tx.Model(User{}).
+		Where("id IN (?)", tx.Model(&GroupMember{}).Select("user_id").Where("group_id = ?", groupID)).
+		UpdateColumn("permission_version", gorm.Expr("permission_version + 1")).Error
+}
+
+func uniqueIDs(values []int64) []int64 {
+	seen := make(map[int64]bool, len(values))
+	res := []int64{}
+
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,31 @@
+package usermysql
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/adetxt/user/domain"
+)
+
+func TestGetUserGroupIDsTenants(t *testing.T) {
+	// groups scopes are resolved in the tenant of the check only
+	for _, tenantID := range []int64{0, 1, 2} {
+		db, log := dryRun(t)
+		r := &repository{db: db}
+
+		if _, err := r.GetUserGroupIDs(domain.WithTenant(context.Background(), tenantID), 7); err != nil {
+			t.Fatal(err)
+		}
+
+		queries := log.find("SELECT `group_id` FROM `group_members`")
+		if len(queries) != 1 {
+			t.Fatalf("tenant %d: groups were not queried: %q", tenantID, log.statements)
+		}
+
+		if !strings.Contains(queries[0], "`group_members`.`org_id` = "+strconv.FormatInt(tenantID, 10)) {
+			t.Errorf("tenant %d: query is not scoped: %s", tenantID, queries[0])
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package usermysql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateInvitation creates the pending user in the tenant of ctx along with
+// its roles and invitation.
+func (r *repository) CreateInvitation(ctx context.Context, data *domain.User, roles []string, invitation *domain.Invitation) (int64, error) {
+	user := MakeUser(data)
+	user.Status = string(domain.UserPending)
+
+	row := Invitation{
+		InvitedBy: invitation.InvitedBy,
+		TokenHash: invitation.TokenHash,
+		ExpiresAt: invitation.ExpiresAt,
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := createUser(tx, user); err != nil {
+			return err
+		}
+
+		if len(roles) > 0 {
+			if err := assignRoles(tx, user.ID, roles, domain.RoleGrant{
+				GrantedBy: invitation.InvitedBy,
+			}); err != nil {
+				return err
+			}
+		}
+
+		row.UserID = user.ID
+
+		return tx.Create(&row).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return row.ID, nil
+}
+
+func (r *repository) GetInvitation(ctx context.Context, id int64) (*domain.Invitation, error) {
+	invitation := Invitation{}
+
+	if err := r.db.WithContext(ctx).Preload("User").Where("id = ?", id).First(&invitation).Error; err != nil {
+		return nil, err
+	}
+
+	return invitation.ToEntity(), nil
+}
+
+// ListInvitations lists the invitations not accepted or revoked yet,
+// including expired ones which may still be resent.
+func (r *repository) ListInvitations(ctx context.Context) ([]*domain.Invitation, error) {
+	invitations := []Invitation{}
+
+	if err := r.db.WithContext(ctx).Preload("User").
+		Where("accepted_at IS NULL AND revoked_at IS NULL").
+		Order("id desc").Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+
+	res := make([]*domain.Invitation, len(invitations))
+	for i := 0; i < len(invitations); i++ {
+		res[i] = invitations[i].ToEntity()
+	}
+
+	return res, nil
+}
+
+func (r *repository) RenewInvitation(ctx context.Context, id int64, tokenHash string, expiresAt time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		invitation, err := getOpenInvitation(tx, id)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(invitation).Updates(map[string]interface{}{
+			"token_hash": tokenHash,
+			"expires_at": expiresAt,
+		}).Error
+	})
+}
+
+// RevokeInvitation also deletes the pending user, so the address may be
+// invited again.
+func (r *repository) RevokeInvitation(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		invitation, err := getOpenInvitation(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(invitation).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", invitation.UserID).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", invitation.UserID).Delete(&GroupMember{}).Error; err != nil {
+			return err
+		}
+
+		// the user never existed for real, so it is not soft deleted. It is
+		// deleted while still a member, users being filtered by membership.
+		if err := tx.Unscoped().Where("id = ? AND status = ?", invitation.UserID, domain.UserPending).Delete(&User{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", invitation.UserID).Delete(&OrgMember{}).Error
+	})
+}
+
+func (r *repository) AcceptInvitation(ctx context.Context, tokenHash string, data *domain.User, now time.Time) (int64, error) {
+	invitation := Invitation{}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", tokenHash).First(&invitation).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.ErrInvitationInvalid
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if invitation.ToEntity().Status(now) != domain.InvitationPending {
+			return domain.ErrInvitationInvalid
+		}
+
+		if err := tx.Model(&User{}).Where("id = ?", invitation.UserID).Updates(map[string]interface{}{
+			"name":                data.Name,
+			"password":            data.Password,
+			"password_changed_at": now,
+			"status":              string(domain.UserActive),
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&invitation).Update("accepted_at", now).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return invitation.UserID, nil
+}
+
+// getOpenInvitation locks invitation id, which must be neither accepted nor
+// revoked.
+func getOpenInvitation(tx *gorm.DB, id int64) (*Invitation, error) {
+	invitation := &Invitation{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(invitation).Error; err != nil {
+		return nil, err
+	}
+
+	if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return nil, domain.ErrInvitationNotPending
+	}
+
+	return invitation, nil
+}
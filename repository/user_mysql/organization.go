@@ -0,0 +1,122 @@
+package usermysql
+
+import (
+	"context"
+
+	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *repository) ListOrganizations(ctx context.Context) ([]*domain.Organization, error) {
+	organizations := []Organization{}
+
+	if err := r.db.WithContext(ctx).Order("name asc").Find(&organizations).Error; err != nil {
+		return nil, err
+	}
+
+	res := make([]*domain.Organization, len(organizations))
+	for i := 0; i < len(organizations); i++ {
+		res[i] = organizations[i].ToEntity()
+	}
+
+	return res, nil
+}
+
+func (r *repository) CreateOrganization(ctx context.Context, data *domain.Organization) (int64, error) {
+	organization := Organization{Name: data.Name}
+
+	if err := r.db.WithContext(ctx).Create(&organization).Error; err != nil {
+		return 0, err
+	}
+
+	return organization.ID, nil
+}
+
+// AddMember makes userID a member of orgID holding roles there. Adding an
+// existing member only assigns the roles.
+func (r *repository) AddMember(ctx context.Context, orgID, userID int64, roles []string, grant domain.RoleGrant) error {
+	ctx = domain.WithTenant(ctx, orgID)
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", orgID).First(&Organization{}).Error; err != nil {
+			return err
+		}
+
+		// the user is not a member yet, so it is looked up across tenants
+		if err := skipTenant(tx).Where("id = ?", userID).First(&User{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&OrgMember{OrgID: orgID, UserID: userID}).Error; err != nil {
+			return err
+		}
+
+		if len(roles) == 0 {
+			return nil
+		}
+
+		grant.OrgID = orgID
+
+		if err := assignRoles(tx, userID, roles, grant); err != nil {
+			return err
+		}
+
+		return bumpUserPermissionVersion(tx, userID)
+	})
+}
+
+// RemoveMember drops userID from orgID along with the roles it held there.
+func (r *repository) RemoveMember(ctx context.Context, orgID, userID int64) error {
+	ctx = domain.WithTenant(ctx, orgID)
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := bumpUserPermissionVersion(tx, userID); err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+
+		res := tx.Where("user_id = ?", userID).Delete(&OrgMember{})
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
+
+func (r *repository) GetUserOrganizations(ctx context.Context, userIDs []int64) (map[int64][]int64, error) {
+	members := []OrgMember{}
+
+	if err := skipTenant(r.db.WithContext(ctx)).Where("user_id IN ?", userIDs).
+		Order("org_id asc").Find(&members).Error; err != nil {
+		return nil, err
+	}
+
+	res := make(map[int64][]int64, len(userIDs))
+	for _, v := range members {
+		res[v.UserID] = append(res[v.UserID], v.OrgID)
+	}
+
+	return res, nil
+}
+
+func (r *repository) IsMember(ctx context.Context, orgID, userID int64) (bool, error) {
+	var count int64
+
+	if err := skipTenant(r.db.WithContext(ctx)).Model(&OrgMember{}).
+		Where("org_id = ? AND user_id = ?", orgID, userID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,240 @@
+package usermysql
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+
+	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
+)
+
+// seedPolicy is the RBAC policy applied by Seeding.
+//
+//go:embed seed_policy.yaml
+var seedPolicy []byte
+
+func (r *repository) ExportPolicy(ctx context.Context) (*domain.PolicyDocument, error) {
+	return exportPolicy(r.db.WithContext(ctx))
+}
+
+func (r *repository) ApplyPolicy(ctx context.Context, doc *domain.PolicyDocument, prune, dryRun bool) ([]domain.PolicyChange, error) {
+	changes := []domain.PolicyChange{}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		current, err := exportPolicy(tx)
+		if err != nil {
+			return err
+		}
+
+		changes = domain.DiffPolicyDocuments(current, doc, prune)
+		if dryRun {
+			return nil
+		}
+
+		return applyPolicyChanges(tx, doc, changes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+func exportPolicy(tx *gorm.DB) (*domain.PolicyDocument, error) {
+	doc := &domain.PolicyDocument{
+		Permissions: []string{},
+		Policies:    []domain.DocumentPolicy{},
+		Roles:       []domain.DocumentRole{},
+	}
+
+	permissions := []Permission{}
+	if err := tx.Model(&Permission{}).Order("name asc").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	for _, v := range permissions {
+		doc.Permissions = append(doc.Permissions, v.Name)
+	}
+
+	policies := []Policy{}
+	if err := tx.Model(&Policy{}).Order("name asc").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	for _, v := range policies {
+		doc.Policies = append(doc.Policies, domain.DocumentPolicy{
+			Name:        v.Name,
+			Description: v.Description,
+			Expression:  v.Expression,
+		})
+	}
+
+	roles, err := findRoles(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(roles); i++ {
+		doc.Roles = append(doc.Roles, domain.DocumentRole{
+			Name:        roles[i].Name,
+			Parents:     roles[i].ParentNames(),
+			Permissions: roles[i].GrantNames(),
+		})
+	}
+
+	return doc, nil
+}
+
+// applyPolicyChanges applies changes computed against doc. Parents are
+// cleared before any is set, so reordering inheritance is not mistaken for
+// a cycle.
+func applyPolicyChanges(tx *gorm.DB, doc *domain.PolicyDocument, changes []domain.PolicyChange) error {
+	policies := map[string]domain.DocumentPolicy{}
+	for _, v := range doc.Policies {
+		policies[v.Name] = v
+	}
+
+	roles := map[string]domain.DocumentRole{}
+	for _, v := range doc.Roles {
+		roles[v.Name] = v
+	}
+
+	changed := map[string]bool{}
+
+	for _, c := range changes {
+		if c.Kind == domain.PolicyChangeParents {
+			role, err := getRoleByName(tx, c.Name)
+			if err == nil {
+				err = tx.Where("role_id = ?", role.ID).Delete(&RoleParent{}).Error
+			}
+
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+	}
+
+	for _, c := range changes {
+		var err error
+
+		switch {
+		case c.Kind == domain.PolicyChangePermission && c.Action == domain.PolicyChangeCreate:
+			err = tx.Create(&Permission{Name: c.Name}).Error
+		case c.Kind == domain.PolicyChangePermission && c.Action == domain.PolicyChangeDelete:
+			err = deletePermission(tx, c.Name)
+		case c.Kind == domain.PolicyChangePolicy && c.Action == domain.PolicyChangeCreate:
+			err = tx.Create(MakePolicy(&domain.Policy{
+				Name:        c.Name,
+				Description: policies[c.Name].Description,
+				Expression:  policies[c.Name].Expression,
+			})).Error
+		case c.Kind == domain.PolicyChangePolicy && c.Action == domain.PolicyChangeUpdate:
+			err = tx.Model(&Policy{}).Where("name = ?", c.Name).Updates(map[string]interface{}{
+				"description": policies[c.Name].Description,
+				"expression":  policies[c.Name].Expression,
+			}).Error
+		case c.Kind == domain.PolicyChangePolicy && c.Action == domain.PolicyChangeDelete:
+			err = deletePolicyByName(tx, c.Name)
+		case c.Kind == domain.PolicyChangeRole && c.Action == domain.PolicyChangeCreate:
+			err = tx.Create(&Role{Name: c.Name}).Error
+		case c.Kind == domain.PolicyChangeRole && c.Action == domain.PolicyChangeDelete:
+			err = deleteRoleByName(tx, c.Name)
+		case c.Kind == domain.PolicyChangeParents:
+			err = withRole(tx, c.Name, func(role *Role) error {
+				return setRoleParents(tx, role, roles[c.Name].Parents)
+			})
+			changed[c.Name] = true
+		case c.Kind == domain.PolicyChangeGrant && c.Action == domain.PolicyChangeCreate:
+			err = withRole(tx, c.Name, func(role *Role) error {
+				return attachPermissions(tx, role.ID, []string{c.Value})
+			})
+			changed[c.Name] = true
+		case c.Kind == domain.PolicyChangeGrant && c.Action == domain.PolicyChangeDelete:
+			err = withRole(tx, c.Name, func(role *Role) error {
+				return detachPermissions(tx, role.ID, []string{c.Value})
+			})
+			changed[c.Name] = true
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", c, err)
+		}
+	}
+
+	for name := range changed {
+		if err := withRole(tx, name, func(role *Role) error {
+			return bumpPermissionVersion(tx, role.ID)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getRoleByName(tx *gorm.DB, name string) (*Role, error) {
+	role := &Role{}
+	if err := tx.Where("name = ?", name).First(role).Error; err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func withRole(tx *gorm.DB, name string, fn func(role *Role) error) error {
+	role, err := getRoleByName(tx, name)
+	if err != nil {
+		return err
+	}
+
+	return fn(role)
+}
+
+func deleteRoleByName(tx *gorm.DB, name string) error {
+	return withRole(tx, name, func(role *Role) error {
+		return deleteRole(tx, role.ID)
+	})
+}
+
+func deletePolicyByName(tx *gorm.DB, name string) error {
+	policy := Policy{}
+	if err := tx.Where("name = ?", name).First(&policy).Error; err != nil {
+		return err
+	}
+
+	return deletePolicy(tx, policy.ID)
+}
+
+// deletePermission removes a permission along with any grant still using
+// it.
+func deletePermission(tx *gorm.DB, name string) error {
+	permission := Permission{}
+	if err := tx.Where("name = ?", name).First(&permission).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("permission_id = ?", permission.ID).Delete(&RolePermission{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Delete(&permission).Error
+}
+
+// seedRoles applies the seed policy, keeping what is already there.
+func seedRoles(tx *gorm.DB) error {
+	doc, err := domain.ParsePolicyDocument(seedPolicy)
+	if err != nil {
+		return err
+	}
+
+	current, err := exportPolicy(tx)
+	if err != nil {
+		return err
+	}
+
+	changes := domain.DiffPolicyDocuments(current, doc, false)
+
+	return applyPolicyChanges(tx, doc, changes)
+}
@@ -0,0 +1,85 @@
+package usermysql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *repository) RegisterUser(ctx context.Context, data *domain.User, roles []string, verification *domain.EmailVerification) (int64, error) {
+	user := MakeUser(data)
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := createUser(tx, user); err != nil {
+			return err
+		}
+
+		if len(roles) > 0 {
+			if err := assignRoles(tx, user.ID, roles, domain.RoleGrant{}); err != nil {
+				return err
+			}
+		}
+
+		if verification == nil {
+			return nil
+		}
+
+		return tx.Create(&EmailVerification{
+			UserID:    user.ID,
+			TokenHash: verification.TokenHash,
+			ExpiresAt: verification.ExpiresAt,
+		}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return user.ID, nil
+}
+
+func (r *repository) CancelRegistration(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&EmailVerification{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+
+		// the user never signed in, so it is not soft deleted
+		return tx.Unscoped().Where("id = ? AND status = ?", id, domain.UserUnverified).Delete(&User{}).Error
+	})
+}
+
+func (r *repository) VerifyEmail(ctx context.Context, tokenHash string, now time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		verification := EmailVerification{}
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", tokenHash).First(&verification).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.ErrVerificationInvalid
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if verification.VerifiedAt != nil || !now.Before(verification.ExpiresAt) {
+			return domain.ErrVerificationInvalid
+		}
+
+		if err := tx.Model(&User{}).
+			Where("id = ? AND status = ?", verification.UserID, domain.UserUnverified).
+			Update("status", string(domain.UserActive)).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&verification).Update("verified_at", now).Error
+	})
+}
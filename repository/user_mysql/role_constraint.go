@@ -0,0 +1,187 @@
+package usermysql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
+)
+
+func (r *repository) ListRoleConstraints(ctx context.Context) ([]*domain.RoleConstraint, error) {
+	constraints := []RoleConstraint{}
+
+	if err := r.db.WithContext(ctx).Preload("Roles").Order("name asc").Find(&constraints).Error; err != nil {
+		return nil, err
+	}
+
+	res := make([]*domain.RoleConstraint, len(constraints))
+	for i := 0; i < len(constraints); i++ {
+		res[i] = constraints[i].ToEntity()
+	}
+
+	return res, nil
+}
+
+func (r *repository) CreateRoleConstraint(ctx context.Context, data *domain.RoleConstraint) (int64, error) {
+	constraint := RoleConstraint{Name: data.Name}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		names := uniqueStrings(data.Roles)
+		roles := []Role{}
+
+		if err := tx.Where("name IN ?", names).Find(&roles).Error; err != nil {
+			return err
+		}
+
+		if len(roles) != len(names) {
+			return domain.ErrRoleNotFound
+		}
+
+		constraint.Roles = roles
+
+		return tx.Omit("Roles.*").Create(&constraint).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return constraint.ID, nil
+}
+
+func (r *repository) DeleteRoleConstraint(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("constraint_id = ?", id).Delete(&RoleConstraintRole{}).Error; err != nil {
+			return err
+		}
+
+		res := tx.Where("id = ?", id).Delete(&RoleConstraint{})
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
+
+// GetConstraintViolations reports on the caller's organization, or on
+// every organization for the platform tenant.
+func (r *repository) GetConstraintViolations(ctx context.Context) ([]*domain.ConstraintViolation, error) {
+	db := r.db.WithContext(ctx)
+	if domain.TenantID(ctx) == 0 {
+		db = skipTenant(db)
+	}
+
+	return findViolations(db)
+}
+
+// checkRoleConstraints fails when userID holds roles kept apart by a
+// constraint in orgID, so role assignments can be rolled back.
+func checkRoleConstraints(tx *gorm.DB, userID, orgID int64) error {
+	violations, err := findViolations(skipTenant(tx), func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ? AND org_id = ?", userID, orgID)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(violations) > 0 {
+		v := violations[0]
+		return fmt.Errorf("%w: %s keeps %s apart", domain.ErrRoleConflict, v.Constraint, strings.Join(v.Roles, ", "))
+	}
+
+	return nil
+}
+
+type heldRoleRow struct {
+	UserID int64
+	OrgID  int64
+	RoleID int64
+}
+
+// findViolations checks the active roles of every user, narrowed by scopes,
+// against all constraints. Roles are only held together within the same
+// organization, and roles inherited or held through groups count as held.
+func findViolations(tx *gorm.DB, scopes ...func(*gorm.DB) *gorm.DB) ([]*domain.ConstraintViolation, error) {
+	res := []*domain.ConstraintViolation{}
+	constraints := []RoleConstraint{}
+
+	if err := tx.Preload("Roles").Order("name asc").Find(&constraints).Error; err != nil {
+		return nil, err
+	}
+
+	if len(constraints) == 0 {
+		return res, nil
+	}
+
+	g, err := getRoleGraph(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	direct := tx.Model(&UserRole{}).Select("user_id, org_id, role_id").
+		Where("expires_at IS NULL OR expires_at > ?", time.Now())
+	viaGroups := tx.Model(&GroupMember{}).
+		Select("group_members.user_id, group_members.org_id, group_roles.role_id").
+		Joins("JOIN group_roles ON group_roles.group_id = group_members.group_id")
+
+	userRoles := []heldRoleRow{}
+
+	if err := tx.Table("(? UNION ALL ?) AS held", direct, viaGroups).Scopes(scopes...).
+		Order("org_id asc, user_id asc").Scan(&userRoles).Error; err != nil {
+		return nil, err
+	}
+
+	type holder struct {
+		orgID, userID int64
+	}
+
+	holders := []holder{}
+	held := map[holder][]string{}
+	for _, v := range userRoles {
+		role, ok := g.byID(v.RoleID)
+		if !ok {
+			continue
+		}
+
+		h := holder{orgID: v.OrgID, userID: v.UserID}
+		if _, ok := held[h]; !ok {
+			holders = append(holders, h)
+		}
+
+		held[h] = append(held[h], role.Name)
+	}
+
+	for _, h := range holders {
+		roles := map[string]bool{}
+		for _, v := range g.closure(held[h]...) {
+			roles[v] = true
+		}
+
+		for _, c := range constraints {
+			matched := []string{}
+			for _, v := range c.Roles {
+				if roles[v.Name] {
+					matched = append(matched, v.Name)
+				}
+			}
+
+			if len(matched) > 1 {
+				res = append(res, &domain.ConstraintViolation{
+					UserID:     h.userID,
+					OrgID:      h.orgID,
+					Constraint: c.Name,
+					Roles:      matched,
+				})
+			}
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,233 @@
+package usermysql
+
+import (
+	"fmt"
+
+	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
+)
+
+// roleGraph indexes every role by name to resolve inherited permissions.
+type roleGraph map[string]*Role
+
+type rolePermissionRow struct {
+	RoleID int64
+	Name   string
+	Scope  string
+	Policy string
+}
+
+// findRoles loads every role with its parents and scoped grants.
+func findRoles(tx *gorm.DB) ([]Role, error) {
+	roles := []Role{}
+
+	if err := tx.Model(&Role{}).Preload("Parents").
+		Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	rows := []rolePermissionRow{}
+
+	if err := tx.Model(&RolePermission{}).
+		Select("role_permissions.role_id, permissions.name, role_permissions.scope, COALESCE(policies.name, '') AS policy").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Joins("LEFT JOIN policies ON policies.id = role_permissions.policy_id").
+		Order("permissions.name asc").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	grants := map[int64][]domain.Grant{}
+	for _, v := range rows {
+		grants[v.RoleID] = append(grants[v.RoleID], domain.Grant{
+			Permission: v.Name,
+			Scope:      domain.Scope(v.Scope),
+			Policy:     v.Policy,
+		})
+	}
+
+	for i := 0; i < len(roles); i++ {
+		roles[i].Grants = grants[roles[i].ID]
+		for j := 0; j < len(roles[i].Grants); j++ {
+			roles[i].Grants[j].Role = roles[i].Name
+		}
+	}
+
+	return roles, nil
+}
+
+func getRoleGraph(tx *gorm.DB) (roleGraph, error) {
+	roles, err := findRoles(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRoleGraph(roles), nil
+}
+
+func newRoleGraph(roles []Role) roleGraph {
+	g := make(roleGraph, len(roles))
+	for i := 0; i < len(roles); i++ {
+		g[roles[i].Name] = &roles[i]
+	}
+
+	return g
+}
+
+// permissions returns the grants of the named roles and of every role they
+// inherit from, written as permission[@scope][#policy].
+func (g roleGraph) permissions(names ...string) []string {
+	seen := map[string]bool{}
+	res := []string{}
+
+	for _, v := range g.grants(names...) {
+		if !seen[v.String()] {
+			seen[v.String()] = true
+			res = append(res, v.String())
+		}
+	}
+
+	return res
+}
+
+// grants returns the grants of the named roles and of every role they
+// inherit from, keeping the role each grant is defined on. Visited roles are
+// skipped, so a cycle cannot loop.
+func (g roleGraph) grants(names ...string) []domain.Grant {
+	visited := map[string]bool{}
+	res := []domain.Grant{}
+
+	var walk func(name string)
+	walk = func(name string) {
+		role, ok := g[name]
+		if !ok || visited[name] {
+			return
+		}
+
+		visited[name] = true
+		res = append(res, role.Grants...)
+
+		for _, parent := range role.Parents {
+			walk(parent.Name)
+		}
+	}
+
+	for _, v := range names {
+		walk(v)
+	}
+
+	return res
+}
+
+// closure returns the named roles and every role they inherit from.
+func (g roleGraph) closure(names ...string) []string {
+	visited := map[string]bool{}
+	res := []string{}
+
+	var walk func(name string)
+	walk = func(name string) {
+		role, ok := g[name]
+		if !ok || visited[name] {
+			return
+		}
+
+		visited[name] = true
+		res = append(res, name)
+
+		for _, parent := range role.Parents {
+			walk(parent.Name)
+		}
+	}
+
+	for _, v := range names {
+		walk(v)
+	}
+
+	return res
+}
+
+// inherits reports whether role name inherits from ancestor, directly or
+// through other roles.
+func (g roleGraph) inherits(name, ancestor string) bool {
+	visited := map[string]bool{}
+
+	var walk func(name string) bool
+	walk = func(name string) bool {
+		role, ok := g[name]
+		if !ok || visited[name] {
+			return false
+		}
+
+		visited[name] = true
+
+		for _, parent := range role.Parents {
+			if parent.Name == ancestor || walk(parent.Name) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return walk(name)
+}
+
+func (g roleGraph) byID(id int64) (*Role, bool) {
+	for _, role := range g {
+		if role.ID == id {
+			return role, true
+		}
+	}
+
+	return nil, false
+}
+
+// inheritors returns the ID of role name and of every role inheriting from
+// it, i.e. the roles whose effective permissions change along with it.
+func (g roleGraph) inheritors(name string) []int64 {
+	res := []int64{}
+
+	for _, role := range g {
+		if role.Name == name || g.inherits(role.Name, name) {
+			res = append(res, role.ID)
+		}
+	}
+
+	return res
+}
+
+// setRoleParents replaces the parents of role, refusing any parent that
+// would make the inheritance graph cyclic.
+func setRoleParents(tx *gorm.DB, role *Role, names []string) error {
+	if err := tx.Where("role_id = ?", role.ID).Delete(&RoleParent{}).Error; err != nil {
+		return err
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	g, err := getRoleGraph(tx)
+	if err != nil {
+		return err
+	}
+
+	parents := []RoleParent{}
+	for _, name := range uniqueStrings(names) {
+		parent, ok := g[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", domain.ErrRoleNotFound, name)
+		}
+
+		if parent.ID == role.ID || g.inherits(name, role.Name) {
+			return fmt.Errorf("%w: %s", domain.ErrRoleCycle, name)
+		}
+
+		parents = append(parents, RoleParent{
+			RoleID:   role.ID,
+			ParentID: parent.ID,
+		})
+	}
+
+	return tx.Create(&parents).Error
+}
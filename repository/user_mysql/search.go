@@ -0,0 +1,136 @@
+package usermysql
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// minTokenSize is the default innodb_ft_min_token_size, shorter words are
+// not indexed.
+const minTokenSize = 3
+
+// searchColumns are the columns having a FULLTEXT index for each field.
+var searchColumns = map[domain.SearchField]string{
+	domain.SearchName:       "name",
+	domain.SearchEmail:      "email",
+	domain.SearchAttributes: "search_attributes",
+}
+
+type searcher struct {
+	db *gorm.DB
+}
+
+// NewSearcher searches users with the FULLTEXT indexes of the users table,
+// which MySQL keeps up to date, so Index and Remove do nothing. MySQL has
+// no fuzzy search, fuzzy terms match exactly. Terms the indexes cannot
+// find, having words shorter than minTokenSize or no word at all, match
+// anywhere in the fields instead without using them. Searches are scoped to
+// the tenant of their context when the repository is in use.
+func NewSearcher(db *gorm.DB) domain.UserSearcher {
+	return &searcher{
+		db: db,
+	}
+}
+
+func (s *searcher) Index(ctx context.Context, users []*domain.User) error {
+	return nil
+}
+
+func (s *searcher) Remove(ctx context.Context, ids []int64) error {
+	return nil
+}
+
+// Search ranks users by the sum of the relevance of every term in every
+// field, terms matched by LIKE adding nothing.
+func (s *searcher) Search(ctx context.Context, terms []domain.SearchTerm, limit int) ([]int64, error) {
+	ids := []int64{}
+	db := s.db.WithContext(ctx).Model(&User{})
+	scores := []string{}
+	vars := []interface{}{}
+
+	for _, t := range terms {
+		words := searchWords(t.Text)
+		if !indexed(words) {
+			likes := []string{}
+			likeVars := []interface{}{}
+
+			for _, f := range t.Fields {
+				likes = append(likes, searchColumns[f]+" LIKE ?")
+				likeVars = append(likeVars, "%"+escapeLike(t.Text)+"%")
+			}
+
+			db.Where("("+strings.Join(likes, " OR ")+")", likeVars...)
+
+			continue
+		}
+
+		against := booleanQuery(words, t.Prefix)
+		matches := []string{}
+		matchVars := []interface{}{}
+
+		for _, f := range t.Fields {
+			matches = append(matches, "MATCH("+searchColumns[f]+") AGAINST (? IN BOOLEAN MODE)")
+			matchVars = append(matchVars, against)
+		}
+
+		db.Where("("+strings.Join(matches, " OR ")+")", matchVars...)
+
+		scores = append(scores, matches...)
+		vars = append(vars, matchVars...)
+	}
+
+	order := "id DESC"
+	if len(scores) > 0 {
+		order = strings.Join(scores, " + ") + " DESC, " + order
+	}
+
+	err := db.Clauses(clause.OrderBy{Expression: clause.Expr{
+		SQL:                order,
+		Vars:               vars,
+		WithoutParentheses: true,
+	}}).Limit(limit).Pluck("id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// searchWords splits text into words as MySQL indexes it, so they never
+// hold operators.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+// indexed tells whether the FULLTEXT indexes hold every one of words.
+func indexed(words []string) bool {
+	if len(words) == 0 {
+		return false
+	}
+
+	for _, v := range words {
+		if utf8.RuneCountInString(v) < minTokenSize {
+			return false
+		}
+	}
+
+	return true
+}
+
+// booleanQuery requires every one of words in boolean mode, the last one
+// being a prefix when prefix is set.
+func booleanQuery(words []string, prefix bool) string {
+	if prefix {
+		words[len(words)-1] += "*"
+	}
+
+	return "+" + strings.Join(words, " +")
+}
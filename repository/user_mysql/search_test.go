@@ -0,0 +1,80 @@
+package usermysql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/adetxt/user/domain"
+)
+
+func TestSearchFallsBackToLike(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+		not   []string
+	}{
+		{
+			query: "name:alice",
+			want:  []string{"MATCH(name) AGAINST ('+alice' IN BOOLEAN MODE)"},
+			not:   []string{"LIKE"},
+		},
+		{
+			query: "name:ali*",
+			want:  []string{"MATCH(name) AGAINST ('+ali*' IN BOOLEAN MODE)"},
+			not:   []string{"LIKE"},
+		},
+		{
+			query: "name:al",
+			want:  []string{"name LIKE '%al%'", "ORDER BY id DESC"},
+			not:   []string{"MATCH"},
+		},
+		{
+			query: "name:jo.smith",
+			want:  []string{"name LIKE '%jo.smith%'"},
+			not:   []string{"MATCH"},
+		},
+		{
+			query: "email:100%_",
+			want:  []string{`email LIKE '%100\%\_%'`},
+			not:   []string{"MATCH"},
+		},
+		{
+			query: "name:-",
+			want:  []string{"name LIKE '%-%'"},
+		},
+		{
+			query: "name:alice name:al",
+			want:  []string{"MATCH(name) AGAINST ('+alice' IN BOOLEAN MODE)", "name LIKE '%al%'"},
+		},
+	}
+
+	for _, tt := range tests {
+		db, log := dryRun(t)
+
+		terms, err := domain.ParseSearchQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewSearcher(db).Search(context.Background(), terms, 10); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(log.statements) != 1 {
+			t.Fatalf("%s: ran %q", tt.query, log.statements)
+		}
+
+		for _, v := range tt.want {
+			if !strings.Contains(log.statements[0], v) {
+				t.Errorf("%s: %s does not hold %s", tt.query, log.statements[0], v)
+			}
+		}
+
+		for _, v := range tt.not {
+			if strings.Contains(log.statements[0], v) {
+				t.Errorf("%s: %s holds %s", tt.query, log.statements[0], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package usermysql
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tenantColumns maps the tables holding organization data to the column
+// naming their organization.
+var tenantColumns = map[string]string{
+	"organizations": "id",
+	"org_members":   "org_id",
+	"user_roles":    "org_id",
+	"user_groups":   "org_id",
+	"group_members": "org_id",
+	"elevations":    "org_id",
+	"audit_logs":    "org_id",
+	"invitations":   "org_id",
+}
+
+type allTenantsKey struct{}
+
+// tenantScopedKey marks statements already filtered, since a statement is
+// run again e.g. by Count then Find.
+const tenantScopedKey = "tenant:scoped"
+
+// heldTables grant roles to users, so they are filtered in the platform
+// tenant too: roles held in an organization must never count outside it.
+var heldTables = map[string]bool{
+	"user_roles":    true,
+	"user_groups":   true,
+	"group_members": true,
+}
+
+// registerTenantScope filters every statement of the repository by the
+// tenant of its context, see domain.WithTenant, so no query can reach the
+// data of another organization. Users are filtered by membership.
+func registerTenantScope(db *gorm.DB) {
+	cb := db.Callback()
+
+	for _, err := range []error{
+		cb.Query().Before("gorm:query").Register("tenant:query", scopeTenant),
+		cb.Row().Before("gorm:row").Register("tenant:row", scopeTenant),
+		cb.Update().Before("gorm:update").Register("tenant:update", scopeTenant),
+		cb.Delete().Before("gorm:delete").Register("tenant:delete", scopeTenant),
+		cb.Create().Before("gorm:create").Register("tenant:create", setTenant),
+	} {
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// skipTenant lets statements of tx see every tenant, for maintenance that
+// spans organizations such as sweeping expired roles.
+func skipTenant(tx *gorm.DB) *gorm.DB {
+	return tx.WithContext(context.WithValue(tx.Statement.Context, allTenantsKey{}, true))
+}
+
+func scopeTenant(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Context.Value(allTenantsKey{}) != nil {
+		return
+	}
+
+	if _, ok := db.Statement.Settings.LoadOrStore(tenantScopedKey, true); ok {
+		return
+	}
+
+	tenantID := domain.TenantID(db.Statement.Context)
+	table := db.Statement.Table
+
+	switch {
+	case table == "users" && tenantID != 0:
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "users.id IN (SELECT user_id FROM org_members WHERE org_id = ?)", Vars: []interface{}{tenantID}},
+		}})
+	case heldTables[table] || (tenantColumns[table] != "" && tenantID != 0):
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: table, Name: tenantColumns[table]}, Value: tenantID},
+		}})
+	}
+}
+
+// setTenant files created rows under the tenant of the context, unless they
+// name their organization already.
+func setTenant(db *gorm.DB) {
+	tenantID := domain.TenantID(db.Statement.Context)
+	if db.Error != nil || tenantID == 0 || db.Statement.Schema == nil {
+		return
+	}
+
+	column := tenantColumns[db.Statement.Table]
+	if column == "" || column == "id" {
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField(column)
+	if field == nil {
+		return
+	}
+
+	ctx := db.Statement.Context
+	set := func(row reflect.Value) {
+		if _, zero := field.ValueOf(ctx, row); zero {
+			db.AddError(field.Set(ctx, row, tenantID))
+		}
+	}
+
+	switch rv := db.Statement.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			set(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		set(rv)
+	}
+}
@@ -0,0 +1,456 @@
+package usermysql
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adetxt/user/domain"
+	"github.com/adetxt/user/utils/filter"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type userFieldKind int
+
+const (
+	userFieldNumber userFieldKind = iota
+	userFieldText
+	userFieldTime
+	userFieldStatus
+	userFieldRole
+)
+
+// userFields are the fields users may be filtered by. Only their columns,
+// never text of the filter, end up in statements.
+var userFields = map[string]struct {
+	column string
+	kind   userFieldKind
+}{
+	"id":                  {"id", userFieldNumber},
+	"name":                {"name", userFieldText},
+	"email":               {"email", userFieldText},
+	"status":              {"status", userFieldStatus},
+	"role":                {"", userFieldRole},
+	"created_at":          {"created_at", userFieldTime},
+	"updated_at":          {"updated_at", userFieldTime},
+	"last_login_at":       {"last_login_at", userFieldTime},
+	"password_changed_at": {"password_changed_at", userFieldTime},
+}
+
+// userOrderFields are the fields users may be ordered by.
+var userOrderFields = map[string]bool{
+	"id":                  true,
+	"name":                true,
+	"email":               true,
+	"status":              true,
+	"created_at":          true,
+	"updated_at":          true,
+	"last_login_at":       true,
+	"password_changed_at": true,
+}
+
+// nullableUserColumns are the ordering columns which may be NULL.
+var nullableUserColumns = map[string]bool{
+	"last_login_at":       true,
+	"password_changed_at": true,
+}
+
+// userFieldColumns are the columns holding each field, roles and groups
+// being loaded by loadRoles.
+var userFieldColumns = map[string][]string{
+	"id":                  {"id"},
+	"name":                {"name"},
+	"email":               {"email"},
+	"status":              {"status", "status_reason", "status_until"},
+	"status_reason":       {"status", "status_reason", "status_until"},
+	"status_until":        {"status", "status_reason", "status_until"},
+	"created_at":          {"created_at"},
+	"updated_at":          {"updated_at"},
+	"last_login_at":       {"last_login_at"},
+	"password_changed_at": {"password_changed_at"},
+	"deleted_at":          {"deleted_at"},
+	"attributes":          {"attributes"},
+	"roles":               nil,
+	"groups":              nil,
+	"group_roles":         nil,
+}
+
+const attributesPrefix = "attributes."
+
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// userFilter turns filters into conditions on users, see
+// domain.GetUsersParams. db builds the subqueries of role restrictions.
+type userFilter struct {
+	db  *gorm.DB
+	now time.Time
+}
+
+func (f *userFilter) build(expr filter.Expr) (clause.Expression, error) {
+	switch e := expr.(type) {
+	case filter.And:
+		exprs, err := f.buildAll(e)
+		if err != nil {
+			return nil, err
+		}
+
+		return clause.And(exprs...), nil
+	case filter.Or:
+		exprs, err := f.buildAll(e)
+		if err != nil {
+			return nil, err
+		}
+
+		return clause.Or(exprs...), nil
+	case filter.Not:
+		c, err := f.build(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+
+		return clause.Not(c), nil
+	case *filter.Restriction:
+		return f.restriction(e)
+	}
+
+	return nil, fmt.Errorf("%w: unknown expression %T", domain.ErrInvalidFilter, expr)
+}
+
+func (f *userFilter) buildAll(exprs []filter.Expr) ([]clause.Expression, error) {
+	res := make([]clause.Expression, len(exprs))
+
+	for i, v := range exprs {
+		c, err := f.build(v)
+		if err != nil {
+			return nil, err
+		}
+
+		res[i] = c
+	}
+
+	return res, nil
+}
+
+func (f *userFilter) restriction(r *filter.Restriction) (clause.Expression, error) {
+	if strings.HasPrefix(r.Field, attributesPrefix) {
+		return f.attribute(r)
+	}
+
+	field, ok := userFields[r.Field]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown field %s", domain.ErrInvalidFilter, r.Field)
+	}
+
+	column := clause.Column{Name: field.column}
+
+	switch field.kind {
+	case userFieldNumber:
+		id, err := strconv.ParseInt(r.Value, 10, 64)
+		if err != nil || r.Operator == filter.Has {
+			return nil, restrictionError(r)
+		}
+
+		return compare(column, r.Operator, id), nil
+	case userFieldText:
+		return matchText(column, r)
+	case userFieldTime:
+		if r.Operator == filter.Has && r.Value == "*" {
+			return clause.Expr{SQL: "(? IS NOT NULL)", Vars: []interface{}{column}}, nil
+		}
+
+		t, err := time.Parse(time.RFC3339, r.Value)
+		if err != nil || r.Operator == filter.Has {
+			return nil, fmt.Errorf("%w: %s expects an RFC 3339 time", domain.ErrInvalidFilter, r.Field)
+		}
+
+		return compare(column, r.Operator, t), nil
+	case userFieldStatus:
+		status := domain.UserStatus(r.Value)
+		if !status.Valid() {
+			return nil, fmt.Errorf("%w: unknown status %s", domain.ErrInvalidFilter, r.Value)
+		}
+
+		switch r.Operator {
+		case filter.Equal:
+			return statusExpr(status, f.now), nil
+		case filter.NotEqual:
+			return clause.Not(statusExpr(status, f.now)), nil
+		}
+	case userFieldRole:
+		switch r.Operator {
+		case filter.Equal, filter.Has:
+			return f.holdsRole(r.Value), nil
+		case filter.NotEqual:
+			return clause.Not(f.holdsRole(r.Value)), nil
+		}
+	}
+
+	return nil, restrictionError(r)
+}
+
+// attribute compares the custom attribute as text, like
+// GetUsersParams.Attributes.
+func (f *userFilter) attribute(r *filter.Restriction) (clause.Expression, error) {
+	name := strings.TrimPrefix(r.Field, attributesPrefix)
+	if !attributeNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: invalid attribute %s", domain.ErrInvalidFilter, name)
+	}
+
+	if r.Operator == filter.Has && r.Value == "*" {
+		return clause.Expr{SQL: "JSON_CONTAINS_PATH(attributes, 'one', ?)", Vars: []interface{}{attributePath(name)}}, nil
+	}
+
+	return matchText(clause.Expr{
+		SQL:  "JSON_UNQUOTE(JSON_EXTRACT(attributes, ?))",
+		Vars: []interface{}{attributePath(name)},
+	}, r)
+}
+
+// holdsRole matches users holding the role name, directly or through a
+// group, or any role for "*".
+func (f *userFilter) holdsRole(name string) clause.Expression {
+	// the organization is matched explicitly rather than left to the
+	// tenant scope, as roles held elsewhere must never match
+	tenantID := domain.TenantID(f.db.Statement.Context)
+
+	direct := f.db.Model(&UserRole{}).Select("user_id").
+		Where("org_id = ? AND (expires_at IS NULL OR expires_at > ?)", tenantID, f.now)
+	groups := f.db.Model(&GroupRole{}).Select("group_id")
+
+	if name != "*" {
+		roles := f.db.Model(&Role{}).Select("id").Where("name = ?", name)
+
+		direct.Where("role_id IN (?)", roles)
+		groups.Where("role_id IN (?)", roles)
+	}
+
+	return clause.Expr{
+		SQL:  "(users.id IN (?) OR users.id IN (?))",
+		Vars: []interface{}{direct, f.db.Model(&GroupMember{}).Select("user_id").Where("org_id = ? AND group_id IN (?)", tenantID, groups)},
+	}
+}
+
+// matchText compares the text column, a clause.Column or clause.Expr, to
+// the value. "*" matches any characters for = and !=, and : matches values
+// containing the value.
+func matchText(column interface{}, r *filter.Restriction) (clause.Expression, error) {
+	switch r.Operator {
+	case filter.Equal, filter.NotEqual:
+		if !strings.Contains(r.Value, "*") {
+			return compare(column, r.Operator, r.Value), nil
+		}
+
+		like := clause.Expr{SQL: "(? LIKE ?)", Vars: []interface{}{column, strings.ReplaceAll(escapeLike(r.Value), "*", "%")}}
+		if r.Operator == filter.NotEqual {
+			return clause.Not(like), nil
+		}
+
+		return like, nil
+	case filter.Has:
+		return clause.Expr{SQL: "(? LIKE ?)", Vars: []interface{}{column, "%" + escapeLike(r.Value) + "%"}}, nil
+	}
+
+	return nil, restrictionError(r)
+}
+
+// compare applies a comparison operator other than Has to column, a
+// clause.Column or clause.Expr.
+func compare(column interface{}, op filter.Operator, value interface{}) clause.Expression {
+	sql := map[filter.Operator]string{
+		filter.Equal:          "(? = ?)",
+		filter.NotEqual:       "(? <> ?)",
+		filter.Less:           "(? < ?)",
+		filter.LessOrEqual:    "(? <= ?)",
+		filter.Greater:        "(? > ?)",
+		filter.GreaterOrEqual: "(? >= ?)",
+	}[op]
+
+	return clause.Expr{SQL: sql, Vars: []interface{}{column, value}}
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+func restrictionError(r *filter.Restriction) error {
+	return fmt.Errorf("%w: %s does not support %s %s", domain.ErrInvalidFilter, r.Field, r.Operator, r.Value)
+}
+
+// userOrder returns the ordering of users, always ending with the ID so
+// pages are stable.
+func userOrder(orderBy string) ([]clause.OrderByColumn, error) {
+	orders, err := filter.ParseOrderBy(orderBy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidOrderBy, err)
+	}
+
+	res := []clause.OrderByColumn{}
+	byID := false
+
+	for _, v := range orders {
+		if !userOrderFields[v.Field] {
+			return nil, fmt.Errorf("%w: unknown field %s", domain.ErrInvalidOrderBy, v.Field)
+		}
+
+		byID = byID || v.Field == "id"
+		res = append(res, clause.OrderByColumn{Column: clause.Column{Name: v.Field}, Desc: v.Desc})
+	}
+
+	if !byID {
+		res = append(res, clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: true})
+	}
+
+	return res, nil
+}
+
+// userColumns returns the columns holding fields, and whether roles must be
+// loaded. Every column is selected for no fields.
+func userColumns(fields []string) ([]string, bool, error) {
+	if len(fields) == 0 {
+		return nil, true, nil
+	}
+
+	columns := []string{"id"}
+	seen := map[string]bool{"id": true}
+	roles := false
+
+	for _, v := range fields {
+		cols, ok := userFieldColumns[v]
+		if !ok {
+			return nil, false, fmt.Errorf("%w: unknown field %s", domain.ErrInvalidReadMask, v)
+		}
+
+		roles = roles || cols == nil
+
+		for _, c := range cols {
+			if !seen[c] {
+				seen[c] = true
+				columns = append(columns, c)
+			}
+		}
+	}
+
+	return columns, roles, nil
+}
+
+// afterCursor matches the users ordered after cursor, the values of order
+// for the last user of a page: those after it by the first column, or equal
+// by the first and after it by the second, and so on. NULLs come first in
+// ascending order as in MySQL.
+func afterCursor(order []clause.OrderByColumn, cursor domain.Cursor) (clause.Expression, error) {
+	if len(cursor) != len(order) {
+		return nil, domain.ErrInvalidPageToken
+	}
+
+	values := make([]interface{}, len(order))
+	for i, v := range order {
+		value, err := cursorValue(v.Column.Name, cursor[i])
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = value
+	}
+
+	branches := []clause.Expression{}
+
+	for i, v := range order {
+		var after clause.Expression
+
+		switch {
+		case values[i] == nil && v.Desc:
+			// nothing comes after NULL
+			continue
+		case values[i] == nil:
+			after = clause.Expr{SQL: "(? IS NOT NULL)", Vars: []interface{}{v.Column}}
+		case v.Desc && nullableUserColumns[v.Column.Name]:
+			after = clause.Expr{SQL: "(? < ? OR ? IS NULL)", Vars: []interface{}{v.Column, values[i], v.Column}}
+		case v.Desc:
+			after = clause.Lt{Column: v.Column, Value: values[i]}
+		default:
+			after = clause.Gt{Column: v.Column, Value: values[i]}
+		}
+
+		exprs := []clause.Expression{}
+		for j := 0; j < i; j++ {
+			if values[j] == nil {
+				exprs = append(exprs, clause.Expr{SQL: "(? IS NULL)", Vars: []interface{}{order[j].Column}})
+			} else {
+				exprs = append(exprs, clause.Eq{Column: order[j].Column, Value: values[j]})
+			}
+		}
+
+		branches = append(branches, clause.And(append(exprs, after)...))
+	}
+
+	return clause.Or(branches...), nil
+}
+
+// cursorValue parses the cursor value of column, which is nil for NULL.
+func cursorValue(column string, value *string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch userFields[column].kind {
+	case userFieldNumber:
+		id, err := strconv.ParseInt(*value, 10, 64)
+		if err != nil {
+			return nil, domain.ErrInvalidPageToken
+		}
+
+		return id, nil
+	case userFieldTime:
+		t, err := time.Parse(time.RFC3339Nano, *value)
+		if err != nil {
+			return nil, domain.ErrInvalidPageToken
+		}
+
+		return t, nil
+	}
+
+	return *value, nil
+}
+
+// userCursor returns the values of order for user.
+func userCursor(order []clause.OrderByColumn, user *User) domain.Cursor {
+	res := make(domain.Cursor, len(order))
+
+	for i, v := range order {
+		switch v.Column.Name {
+		case "id":
+			res[i] = cursorText(strconv.FormatInt(user.ID, 10))
+		case "name":
+			res[i] = cursorText(user.Name)
+		case "email":
+			res[i] = cursorText(user.Email)
+		case "status":
+			res[i] = cursorText(user.Status)
+		case "created_at":
+			res[i] = cursorTime(&user.CreatedAt)
+		case "updated_at":
+			res[i] = cursorTime(&user.UpdatedAt)
+		case "last_login_at":
+			res[i] = cursorTime(user.LastLoginAt)
+		case "password_changed_at":
+			res[i] = cursorTime(user.PasswordChangedAt)
+		}
+	}
+
+	return res
+}
+
+func cursorText(value string) *string {
+	return &value
+}
+
+func cursorTime(value *time.Time) *string {
+	if value == nil {
+		return nil
+	}
+
+	return cursorText(value.Format(time.RFC3339Nano))
+}
@@ -0,0 +1,74 @@
+package usermysql
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/adetxt/user/domain"
+)
+
+func TestRoleFilterTenants(t *testing.T) {
+	for _, tenantID := range []int64{1, 2} {
+		db, log := dryRun(t)
+		r := &repository{db: db}
+		ctx := domain.WithTenant(context.Background(), tenantID)
+
+		if _, _, err := r.GetUsers(ctx, &domain.GetUsersParams{Page: 1, PageSize: 10, Filter: "role = admin"}); err != nil {
+			t.Fatal(err)
+		}
+
+		// the users are counted with the same conditions first
+		queries := log.find("SELECT count(*) FROM `users`")
+		if len(queries) == 0 {
+			t.Fatalf("tenant %d: users were not queried: %q", tenantID, log.statements)
+		}
+
+		// the role subqueries of both grants and group memberships are bound
+		// to the tenant
+		other := 3 - tenantID
+		for _, table := range []string{"user_roles", "group_members"} {
+			subquery := subqueryOf(queries[0], table)
+			if !strings.Contains(subquery, "org_id = "+strconv.FormatInt(tenantID, 10)) {
+				t.Errorf("tenant %d: %s subquery is not scoped: %s", tenantID, table, subquery)
+			}
+
+			if strings.Contains(subquery, "org_id = "+strconv.FormatInt(other, 10)) {
+				t.Errorf("tenant %d: %s subquery reaches tenant %d: %s", tenantID, table, other, subquery)
+			}
+		}
+	}
+}
+
+func TestRoleFilterPlatform(t *testing.T) {
+	db, log := dryRun(t)
+	r := &repository{db: db}
+
+	if _, _, err := r.GetUsers(context.Background(), &domain.GetUsersParams{Page: 1, PageSize: 10, Filter: "role = admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// roles held in organizations are not platform roles
+	for _, table := range []string{"user_roles", "group_members"} {
+		if subquery := subqueryOf(log.statements[0], table); !strings.Contains(subquery, "org_id = 0") {
+			t.Errorf("%s subquery is not scoped to the platform: %s", table, subquery)
+		}
+	}
+}
+
+// subqueryOf returns the part of query from the subquery of table to the
+// next table.
+func subqueryOf(query, table string) string {
+	i := strings.Index(query, "FROM `"+table+"`")
+	if i < 0 {
+		return ""
+	}
+
+	query = query[i+len(table)+7:]
+	if j := strings.Index(query, "FROM `"); j >= 0 {
+		query = query[:j]
+	}
+
+	return query
+}
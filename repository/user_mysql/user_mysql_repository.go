@@ -2,19 +2,29 @@ package usermysql
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/adetxt/user/domain"
+	"github.com/adetxt/user/utils/filter"
 	"github.com/adetxt/user/utils/password"
 	"golang.org/x/sync/errgroup"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type repository struct {
 	db *gorm.DB
 }
 
+// New returns the user repository. Its statements are scoped to the tenant
+// of their context.
 func New(db *gorm.DB) domain.UserRepository {
+	registerTenantScope(db)
+
 	return &repository{
 		db: db,
 	}
@@ -22,28 +32,81 @@ func New(db *gorm.DB) domain.UserRepository {
 
 func (r *repository) GetUsers(ctx context.Context, params *domain.GetUsersParams) ([]*domain.User, *domain.PaginationInfo, error) {
 	pagination := domain.MakePaginationInfo(params.Page, params.PageSize)
+	now := time.Now()
 
-	users := []User{}
-	db := r.db.Model(User{}).Preload("Roles")
+	// the request is checked whole before running anything
+	expr, err := filter.Parse(params.Filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", domain.ErrInvalidFilter, err)
+	}
 
-	if params.Keyword != "" {
-		db.Where("name LIKE ?", "%"+params.Keyword+"%")
+	var condition clause.Expression
+	if expr != nil {
+		f := &userFilter{db: r.db.WithContext(ctx), now: now}
+		if condition, err = f.build(expr); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	var totalData int64
+	order, err := userOrder(params.OrderBy)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	if err := db.Count(&totalData).Error; err != nil {
+	columns, withRoles, err := userColumns(params.Fields)
+	if err != nil {
 		return nil, nil, err
 	}
 
-	pagination.SetTotalData(totalData)
+	var users []User
+	db := r.db.WithContext(ctx).Model(User{})
+
+	if params.SearchIDs != nil {
+		db.Where("id IN ?", params.SearchIDs)
+	}
+
+	if params.Status != "" {
+		db.Where(statusExpr(params.Status, now))
+	}
+
+	if params.IncludeDeleted {
+		db.Unscoped()
+	}
+
+	for name, value := range params.Attributes {
+		db.Where("JSON_UNQUOTE(JSON_EXTRACT(attributes, ?)) = ?", attributePath(name), value)
+	}
+
+	for field, r := range params.TimeRanges {
+		if r.After != nil {
+			db.Where(clause.Gte{Column: string(field), Value: *r.After})
+		}
+
+		if r.Before != nil {
+			db.Where(clause.Lt{Column: string(field), Value: *r.Before})
+		}
+	}
+
+	if condition != nil {
+		db.Where(condition)
+	}
 
-	db.Offset(int(pagination.GetOffset())).Limit(int(pagination.PageSize))
+	if params.SearchIDs != nil && params.OrderBy == "" {
+		users, err = r.rankedUsers(ctx, db, params, pagination, columns)
+	} else {
+		users, err = pageUsers(db, params, pagination, order, columns)
+	}
 
-	if err := db.Order("id desc").Find(&users).Error; err != nil {
+	if err != nil {
 		return nil, nil, err
 	}
 
+	if withRoles {
+		if err := loadRoles(r.db.WithContext(ctx), users); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	res := make([]*domain.User, len(users))
 	for i := 0; i < len(users); i++ {
 		res[i] = users[i].ToEntity()
@@ -52,9 +115,138 @@ func (r *repository) GetUsers(ctx context.Context, params *domain.GetUsersParams
 	return res, pagination, nil
 }
 
+// pageUsers lists a page of the users of db in the given order.
+func pageUsers(db *gorm.DB, params *domain.GetUsersParams, pagination *domain.PaginationInfo, order []clause.OrderByColumn, columns []string) ([]User, error) {
+	users := []User{}
+
+	// numbered pages are always counted, see GetUsersParams
+	byPage := params.Page > 0
+
+	if byPage || params.CountTotal {
+		var totalData int64
+
+		if err := db.Count(&totalData).Error; err != nil {
+			return nil, err
+		}
+
+		pagination.SetTotalData(totalData)
+	}
+
+	if columns != nil {
+		// the cursor is made of the ordering columns
+		for _, v := range order {
+			columns = append(columns, v.Column.Name)
+		}
+
+		db.Select(uniqueStrings(columns))
+	}
+
+	for _, v := range order {
+		db.Order(v)
+	}
+
+	if byPage {
+		db.Offset(int(pagination.GetOffset()))
+	} else if len(params.Cursor) > 0 {
+		after, err := afterCursor(order, params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		db.Where(after)
+	}
+
+	// one more user tells whether there is a next page, which numbered
+	// pages may follow by token too
+	db.Limit(int(pagination.PageSize) + 1)
+
+	if err := db.Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	if pagination.PageSize > 0 && len(users) > int(pagination.PageSize) {
+		users = users[:pagination.PageSize]
+		pagination.NextCursor = userCursor(order, &users[len(users)-1])
+	}
+
+	return users, nil
+}
+
+// rankedUsers lists a page of the users of db in the order of
+// params.SearchIDs. Searches return few users, so they are paged in memory
+// and the cursor is the rank of the last user listed.
+func (r *repository) rankedUsers(ctx context.Context, db *gorm.DB, params *domain.GetUsersParams, pagination *domain.PaginationInfo, columns []string) ([]User, error) {
+	ids := []int64{}
+	if err := db.Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	rank := make(map[int64]int, len(params.SearchIDs))
+	for i, v := range params.SearchIDs {
+		rank[v] = i
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return rank[ids[i]] < rank[ids[j]] })
+	pagination.SetTotalData(int64(len(ids)))
+
+	start := 0
+
+	if params.Page > 0 {
+		start = int(pagination.GetOffset())
+	} else if len(params.Cursor) > 0 {
+		if len(params.Cursor) != 1 || params.Cursor[0] == nil {
+			return nil, domain.ErrInvalidPageToken
+		}
+
+		last, err := strconv.Atoi(*params.Cursor[0])
+		if err != nil {
+			return nil, domain.ErrInvalidPageToken
+		}
+
+		start = sort.Search(len(ids), func(i int) bool { return rank[ids[i]] > last })
+	}
+
+	if start > len(ids) {
+		start = len(ids)
+	}
+
+	end := start + int(pagination.PageSize)
+	if end > len(ids) {
+		end = len(ids)
+	}
+
+	page := ids[start:end]
+	if len(page) > 0 && end < len(ids) {
+		pagination.NextCursor = domain.Cursor{cursorText(strconv.Itoa(rank[page[len(page)-1]]))}
+	}
+
+	users := []User{}
+	if len(page) == 0 {
+		return users, nil
+	}
+
+	q := r.db.WithContext(ctx).Model(User{}).Where("id IN ?", page)
+
+	if params.IncludeDeleted {
+		q.Unscoped()
+	}
+
+	if columns != nil {
+		q.Select(columns)
+	}
+
+	if err := q.Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	sort.Slice(users, func(i, j int) bool { return rank[users[i].ID] < rank[users[j].ID] })
+
+	return users, nil
+}
+
 func (r *repository) GetUserByIdentifier(ctx context.Context, identifier string, value interface{}) (*domain.User, error) {
 	user := User{}
-	db := r.db.Model(User{}).Preload("Roles")
+	db := r.db.WithContext(ctx).Model(User{})
 
 	switch identifier {
 	case "id":
@@ -69,13 +261,21 @@ func (r *repository) GetUserByIdentifier(ctx context.Context, identifier string,
 		return nil, err
 	}
 
-	return user.ToEntity(), nil
+	users := []User{user}
+	if err := loadRoles(r.db.WithContext(ctx), users); err != nil {
+		return nil, err
+	}
+
+	return users[0].ToEntity(), nil
 }
 
 func (r *repository) CreateUser(ctx context.Context, data *domain.User) (int64, error) {
 	user := MakeUser(data)
 
-	if err := r.db.Create(user).Error; err != nil {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createUser(tx, user)
+	})
+	if err != nil {
 		return 0, err
 	}
 
@@ -100,166 +300,987 @@ func (r *repository) UpdateUser(ctx context.Context, data *domain.User) error {
 
 	if data.Password != "" {
 		updateData["password"] = data.Password
+		updateData["password_changed_at"] = time.Now()
 	}
 
-	if err := r.db.Model(user).Updates(updateData).Error; err != nil {
-		return err
+	if data.Attributes != nil {
+		updateData["attributes"] = Attributes(data.Attributes)
 	}
 
-	return nil
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(updateData) > 0 {
+			if err := tx.Model(user).Updates(updateData).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(data.Roles) == 0 {
+			return nil
+		}
+
+		return replaceRoles(tx, data.ID, user.Roles, data.Roles)
+	})
+}
+
+// replaceRoles makes roles the roles of the user, which holds current. The
+// roles kept keep their grants, so an expiring grant stays expiring.
+func replaceRoles(tx *gorm.DB, userID int64, current, roles []string) error {
+	removed := subtractStrings(current, roles)
+	added := subtractStrings(roles, current)
+
+	if len(removed) == 0 && len(added) == 0 {
+		return nil
+	}
+
+	if len(removed) > 0 {
+		if err := tx.Where("user_id = ?", userID).
+			Where("role_id IN (?)", tx.Model(Role{}).Select("id").Where("name IN ?", removed)).
+			Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(added) > 0 {
+		if err := assignRoles(tx, userID, added, domain.RoleGrant{}); err != nil {
+			return err
+		}
+	}
+
+	return bumpUserPermissionVersion(tx, userID)
 }
 
+// DeleteUser soft deletes the user, keeping its roles and memberships for
+// a restore.
 func (r *repository) DeleteUser(ctx context.Context, id int64) error {
-	if err := r.db.Where("id = ?", id).Delete(&User{}).Error; err != nil {
-		return err
+	res := r.db.WithContext(ctx).Where("id = ?", id).Delete(&User{})
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
 	}
 
 	return nil
 }
 
-func (r *repository) GetRoles(ctx context.Context) ([]*domain.Role, error) {
-	roles := []Role{}
+func (r *repository) RestoreUser(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		user := User{}
+		if err := tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&user).Error; err != nil {
+			return err
+		}
+
+		// emails are unique across tenants
+		var taken int64
+		if err := skipTenant(tx).Model(&User{}).Where("email = ?", user.Email).Count(&taken).Error; err != nil {
+			return err
+		}
+
+		if taken > 0 {
+			return domain.ErrEmailInUse
+		}
+
+		return tx.Unscoped().Model(&user).Update("deleted_at", nil).Error
+	})
+}
+
+func (r *repository) PurgeDeletedUsers(ctx context.Context, before time.Time) ([]int64, error) {
+	userIDs := []int64{}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// deleted users may belong to any organization
+		tx = skipTenant(tx)
+
+		if err := tx.Unscoped().Model(&User{}).Where("deleted_at < ?", before).
+			Pluck("id", &userIDs).Error; err != nil {
+			return err
+		}
 
-	if err := r.db.Model(&Role{}).Preload("Permissions").
-		Find(&roles).Error; err != nil {
+		if len(userIDs) == 0 {
+			return nil
+		}
+
+		for _, v := range []interface{}{
+			&UserRole{}, &GroupMember{}, &OrgMember{}, &Elevation{}, &Invitation{}, &EmailVerification{},
+		} {
+			if err := tx.Where("user_id IN ?", userIDs).Delete(v).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Unscoped().Where("id IN ?", userIDs).Delete(&User{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return userIDs, nil
+}
+
+func (r *repository) AssignRoles(ctx context.Context, userID int64, roles []string, grant domain.RoleGrant) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", userID).First(&User{}).Error; err != nil {
+			return err
+		}
+
+		if err := assignRoles(tx, userID, roles, grant); err != nil {
+			return err
+		}
+
+		return bumpUserPermissionVersion(tx, userID)
+	})
+}
+
+func (r *repository) RevokeRoles(ctx context.Context, userID int64, roles []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", userID).First(&User{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", userID).
+			Where("role_id IN (?)", tx.Model(Role{}).Select("id").Where("name IN ?", roles)).
+			Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+
+		return bumpUserPermissionVersion(tx, userID)
+	})
+}
+
+func (r *repository) GetRoles(ctx context.Context) ([]*domain.Role, error) {
+	roles, err := findRoles(r.db.WithContext(ctx))
+	if err != nil {
 		return nil, err
 	}
 
+	g := newRoleGraph(roles)
+
 	res := make([]*domain.Role, len(roles))
 	for i := 0; i < len(roles); i++ {
 		res[i] = &domain.Role{
-			Name:        roles[i].Name,
-			Permissions: roles[i].PermissionNames(),
+			ID:                   roles[i].ID,
+			Name:                 roles[i].Name,
+			Permissions:          roles[i].GrantNames(),
+			Parents:              roles[i].ParentNames(),
+			EffectivePermissions: g.permissions(roles[i].Name),
 		}
 	}
 
 	return res, nil
 }
 
-func (r *repository) GetPermissionsByRole(ctx context.Context, roleNames []string) ([]string, error) {
-	roles := []Role{}
+func (r *repository) CreateRole(ctx context.Context, data *domain.Role) (int64, error) {
+	role := Role{Name: data.Name}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
 
-	if err := r.db.Model(&Role{}).Preload("Permissions").
-		Where("name IN ?", roleNames).
-		Find(&roles).Error; err != nil {
+		if err := setRoleParents(tx, &role, data.Parents); err != nil {
+			return err
+		}
+
+		return attachPermissions(tx, role.ID, data.Permissions)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return role.ID, nil
+}
+
+func (r *repository) UpdateRole(ctx context.Context, data *domain.Role) error {
+	role := Role{}
+
+	if err := r.db.WithContext(ctx).Where("id = ?", data.ID).First(&role).Error; err != nil {
+		return err
+	}
+
+	return r.db.WithContext(ctx).Model(&role).Update("name", data.Name).Error
+}
+
+func (r *repository) DeleteRole(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return deleteRole(tx, id)
+	})
+}
+
+func (r *repository) ListPermissions(ctx context.Context) ([]*domain.Permission, error) {
+	permissions := []Permission{}
+
+	if err := r.db.WithContext(ctx).Model(&Permission{}).Order("name asc").Find(&permissions).Error; err != nil {
 		return nil, err
 	}
 
-	res := []string{}
-	for i := 0; i < len(roles); i++ {
-		res = append(res, roles[i].PermissionNames()...)
+	res := make([]*domain.Permission, len(permissions))
+	for i := 0; i < len(permissions); i++ {
+		res[i] = permissions[i].ToEntity()
 	}
 
 	return res, nil
 }
 
-func (r *repository) Seeding(ctx context.Context) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
-		eg, _ := errgroup.WithContext(ctx)
+func (r *repository) CreatePermission(ctx context.Context, name string) (int64, error) {
+	permission := Permission{Name: name}
 
-		eg.Go(func() error {
-			return tx.Model(Role{}).Create([]Role{
-				{
-					ID:   1,
-					Name: "admin",
-				},
-				{
-					ID:   2,
-					Name: "user",
-				},
-			}).Error
-		})
+	if err := r.db.WithContext(ctx).Create(&permission).Error; err != nil {
+		return 0, err
+	}
 
-		eg.Go(func() error {
-			return tx.Model(Permission{}).Create([]Permission{
-				{
-					ID:   1,
-					Name: "user:list",
-				},
-				{
-					ID:   2,
-					Name: "user:detail",
-				},
-				{
-					ID:   3,
-					Name: "user:create",
-				},
-				{
-					ID:   4,
-					Name: "user:update",
-				},
-				{
-					ID:   5,
-					Name: "user:delete",
-				},
-			}).Error
-		})
+	return permission.ID, nil
+}
 
-		eg.Go(func() error {
-			hashed, _ := password.HashPassword("password")
+func (r *repository) SetRoleParents(ctx context.Context, roleID int64, parents []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		role := Role{}
 
-			return tx.Model(User{}).Create([]User{
-				{
-					ID:       1,
-					Name:     "admin",
-					Email:    "admin@mail.com",
-					Password: hashed,
-				},
-				{
-					ID:       2,
-					Name:     "user",
-					Email:    "user@mail.com",
-					Password: hashed,
-				},
-			}).Error
-		})
+		if err := tx.Where("id = ?", roleID).First(&role).Error; err != nil {
+			return err
+		}
 
-		eg.Go(func() error {
-			return tx.Model(UserRole{}).Create([]UserRole{
-				{
-					UserID: 1,
-					RoleID: 1,
-				},
-				{
-					UserID: 2,
-					RoleID: 2,
-				},
-			}).Error
-		})
+		if err := setRoleParents(tx, &role, parents); err != nil {
+			return err
+		}
 
-		eg.Go(func() error {
-			return tx.Model(RolePermission{}).Create([]RolePermission{
-				{
-					RoleID:       1,
-					PermissionID: 1,
-				},
-				{
-					RoleID:       1,
-					PermissionID: 2,
-				},
-				{
-					RoleID:       1,
-					PermissionID: 3,
-				},
-				{
-					RoleID:       1,
-					PermissionID: 4,
-				},
-				{
-					RoleID:       1,
-					PermissionID: 5,
-				},
-				{
-					RoleID:       2,
-					PermissionID: 1,
-				},
-				{
-					RoleID:       2,
-					PermissionID: 2,
-				},
-			}).Error
-		})
+		return bumpPermissionVersion(tx, roleID)
+	})
+}
+
+func (r *repository) AttachPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", roleID).First(&Role{}).Error; err != nil {
+			return err
+		}
+
+		if err := attachPermissions(tx, roleID, permissions); err != nil {
+			return err
+		}
 
-		return eg.Wait()
+		return bumpPermissionVersion(tx, roleID)
 	})
 }
+
+func (r *repository) DetachPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", roleID).First(&Role{}).Error; err != nil {
+			return err
+		}
+
+		if err := detachPermissions(tx, roleID, permissions); err != nil {
+			return err
+		}
+
+		return bumpPermissionVersion(tx, roleID)
+	})
+}
+
+func (r *repository) ListPolicies(ctx context.Context) ([]*domain.Policy, error) {
+	policies := []Policy{}
+
+	if err := r.db.WithContext(ctx).Model(&Policy{}).Order("name asc").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	res := make([]*domain.Policy, len(policies))
+	for i := 0; i < len(policies); i++ {
+		res[i] = policies[i].ToEntity()
+	}
+
+	return res, nil
+}
+
+func (r *repository) GetPoliciesByName(ctx context.Context, names []string) ([]*domain.Policy, error) {
+	policies := []Policy{}
+
+	if err := r.db.WithContext(ctx).Model(&Policy{}).Where("name IN ?", names).Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	res := make([]*domain.Policy, len(policies))
+	for i := 0; i < len(policies); i++ {
+		res[i] = policies[i].ToEntity()
+	}
+
+	return res, nil
+}
+
+func (r *repository) CreatePolicy(ctx context.Context, data *domain.Policy) (int64, error) {
+	policy := MakePolicy(data)
+
+	if err := r.db.WithContext(ctx).Create(policy).Error; err != nil {
+		return 0, err
+	}
+
+	return policy.ID, nil
+}
+
+func (r *repository) UpdatePolicy(ctx context.Context, data *domain.Policy) error {
+	policy := Policy{}
+
+	if err := r.db.WithContext(ctx).Where("id = ?", data.ID).First(&policy).Error; err != nil {
+		return err
+	}
+
+	updateData := make(map[string]interface{})
+
+	if data.Description != "" {
+		updateData["description"] = data.Description
+	}
+
+	if data.Expression != "" {
+		updateData["expression"] = data.Expression
+	}
+
+	if len(updateData) == 0 {
+		return nil
+	}
+
+	return r.db.WithContext(ctx).Model(&policy).Updates(updateData).Error
+}
+
+func (r *repository) DeletePolicy(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return deletePolicy(tx, id)
+	})
+}
+
+func (r *repository) CreateElevation(ctx context.Context, data *domain.Elevation) (int64, error) {
+	elevation := Elevation{
+		UserID:          data.UserID,
+		Reason:          data.Reason,
+		DurationSeconds: int64(data.Duration / time.Second),
+		Status:          string(domain.ElevationPending),
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		role := Role{}
+		if err := tx.Where("name = ?", data.Role).First(&role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: %s", domain.ErrRoleNotFound, data.Role)
+			}
+
+			return err
+		}
+
+		elevation.RoleID = role.ID
+
+		if err := tx.Create(&elevation).Error; err != nil {
+			return err
+		}
+
+		return createAuditLog(tx, &domain.AuditEntry{
+			ActorID:      data.UserID,
+			Action:       domain.AuditElevationRequested,
+			TargetUserID: data.UserID,
+			Detail:       fmt.Sprintf("elevation %d: %s for %s, %s", elevation.ID, role.Name, data.Duration, data.Reason),
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return elevation.ID, nil
+}
+
+func (r *repository) GetElevation(ctx context.Context, id int64) (*domain.Elevation, error) {
+	elevation := Elevation{}
+
+	if err := r.db.WithContext(ctx).Preload("Role").Where("id = ?", id).First(&elevation).Error; err != nil {
+		return nil, err
+	}
+
+	return elevation.ToEntity(), nil
+}
+
+func (r *repository) ListElevations(ctx context.Context, status domain.ElevationStatus) ([]*domain.Elevation, error) {
+	elevations := []Elevation{}
+
+	if err := r.db.WithContext(ctx).Preload("Role").Where("status = ?", string(status)).
+		Order("id asc").Find(&elevations).Error; err != nil {
+		return nil, err
+	}
+
+	res := make([]*domain.Elevation, len(elevations))
+	for i := 0; i < len(elevations); i++ {
+		res[i] = elevations[i].ToEntity()
+	}
+
+	return res, nil
+}
+
+// ApproveElevation grants the requested role until the requested duration
+// after now. The request is locked so it cannot be approved twice.
+func (r *repository) ApproveElevation(ctx context.Context, id, approverID int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		elevation := Elevation{}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Role").
+			Where("id = ?", id).First(&elevation).Error; err != nil {
+			return err
+		}
+
+		if elevation.Status != string(domain.ElevationPending) {
+			return domain.ErrElevationNotPending
+		}
+
+		now := time.Now()
+		expiresAt := now.Add(time.Duration(elevation.DurationSeconds) * time.Second)
+
+		if err := assignRoles(tx, elevation.UserID, []string{elevation.Role.Name}, domain.RoleGrant{
+			OrgID:     elevation.OrgID,
+			GrantedBy: approverID,
+			ExpiresAt: &expiresAt,
+		}); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&elevation).Updates(map[string]interface{}{
+			"status":      string(domain.ElevationApproved),
+			"approved_by": approverID,
+			"approved_at": now,
+			"expires_at":  expiresAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := createAuditLog(tx, &domain.AuditEntry{
+			OrgID:        elevation.OrgID,
+			ActorID:      approverID,
+			Action:       domain.AuditElevationApproved,
+			TargetUserID: elevation.UserID,
+			Detail:       fmt.Sprintf("elevation %d: %s until %s", elevation.ID, elevation.Role.Name, expiresAt.Format(time.RFC3339)),
+		}); err != nil {
+			return err
+		}
+
+		return bumpUserPermissionVersion(tx, elevation.UserID)
+	})
+}
+
+func (r *repository) DeleteExpiredRoles(ctx context.Context, now time.Time) ([]int64, error) {
+	res := []int64{}
+
+	err := skipTenant(r.db.WithContext(ctx)).Transaction(func(tx *gorm.DB) error {
+		expired := []UserRole{}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("expires_at <= ?", now).Find(&expired).Error; err != nil {
+			return err
+		}
+
+		if len(expired) == 0 {
+			return nil
+		}
+
+		if err := tx.Where("expires_at <= ?", now).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+
+		g, err := getRoleGraph(tx)
+		if err != nil {
+			return err
+		}
+
+		seen := map[int64]bool{}
+		for _, v := range expired {
+			detail := fmt.Sprintf("role %d expired at %s", v.RoleID, v.ExpiresAt.Format(time.RFC3339))
+			if role, ok := g.byID(v.RoleID); ok {
+				detail = fmt.Sprintf("%s expired at %s", role.Name, v.ExpiresAt.Format(time.RFC3339))
+			}
+
+			if err := createAuditLog(tx, &domain.AuditEntry{
+				OrgID:        v.OrgID,
+				ActorID:      v.GrantedBy,
+				Action:       domain.AuditRoleExpired,
+				TargetUserID: v.UserID,
+				Detail:       detail,
+			}); err != nil {
+				return err
+			}
+
+			if !seen[v.UserID] {
+				seen[v.UserID] = true
+				res = append(res, v.UserID)
+			}
+		}
+
+		return tx.Model(User{}).Where("id IN ?", res).
+			UpdateColumn("permission_version", gorm.Expr("permission_version + 1")).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetPermissionsByRole resolves the permissions of roleNames, which callers
+// take from GetUserByIdentifier so expired role grants are already left out.
+func (r *repository) GetPermissionsByRole(ctx context.Context, roleNames []string) ([]string, error) {
+	g, err := getRoleGraph(r.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return g.permissions(roleNames...), nil
+}
+
+func (r *repository) GetGrantsByRole(ctx context.Context, roleNames []string) ([]domain.Grant, error) {
+	g, err := getRoleGraph(r.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return g.grants(roleNames...), nil
+}
+
+func (r *repository) GetPermissionVersion(ctx context.Context, userID int64) (int64, error) {
+	user := User{}
+
+	if err := r.db.WithContext(ctx).Model(User{}).Select("id", "permission_version").
+		Where("id = ?", userID).
+		First(&user).Error; err != nil {
+		return 0, err
+	}
+
+	return user.PermissionVersion, nil
+}
+
+func (r *repository) Seeding(ctx context.Context) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		eg, _ := errgroup.WithContext(ctx)
+
+		eg.Go(func() error {
+			return seedRoles(tx)
+		})
+
+		eg.Go(func() error {
+			hashed, _ := password.HashPassword("password")
+
+			return tx.Model(User{}).Create([]User{
+				{
+					ID:       1,
+					Name:     "admin",
+					Email:    "admin@mail.com",
+					Password: hashed,
+				},
+				{
+					ID:       2,
+					Name:     "user",
+					Email:    "user@mail.com",
+					Password: hashed,
+				},
+			}).Error
+		})
+
+		if err := eg.Wait(); err != nil {
+			return err
+		}
+
+		if err := assignRoles(tx, 1, []string{"admin"}, domain.RoleGrant{}); err != nil {
+			return err
+		}
+
+		return assignRoles(tx, 2, []string{"user"}, domain.RoleGrant{})
+	})
+}
+
+// createUser creates user, which joins the organization it is created in.
+func createUser(tx *gorm.DB, user *User) error {
+	if user.Password != "" {
+		now := time.Now()
+		user.PasswordChangedAt = &now
+	}
+
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+
+	if tenantID := domain.TenantID(tx.Statement.Context); tenantID != 0 {
+		return tx.Create(&OrgMember{OrgID: tenantID, UserID: user.ID}).Error
+	}
+
+	return nil
+}
+
+// attachPermissions links the grants, written as permission[@scope], to
+// roleID, skipping the ones already attached. All permissions must exist.
+func attachPermissions(tx *gorm.DB, roleID int64, grants []string) error {
+	if len(grants) == 0 {
+		return nil
+	}
+
+	names := []string{}
+	parsed := make([]domain.Grant, len(grants))
+
+	for i := 0; i < len(grants); i++ {
+		grant, err := domain.ParseGrant(grants[i])
+		if err != nil {
+			return err
+		}
+
+		parsed[i] = grant
+		names = append(names, grant.Permission)
+	}
+
+	permissions := []Permission{}
+
+	if err := tx.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return err
+	}
+
+	if len(permissions) != len(uniqueStrings(names)) {
+		return domain.ErrPermissionNotFound
+	}
+
+	ids := make(map[string]int64, len(permissions))
+	for _, v := range permissions {
+		ids[v.Name] = v.ID
+	}
+
+	policyIDs, err := getPolicyIDs(tx, parsed)
+	if err != nil {
+		return err
+	}
+
+	rolePermissions := make([]RolePermission, len(parsed))
+	for i := 0; i < len(parsed); i++ {
+		rolePermissions[i] = RolePermission{
+			RoleID:       roleID,
+			PermissionID: ids[parsed[i].Permission],
+			Scope:        string(parsed[i].Scope),
+			PolicyID:     policyIDs[parsed[i].Policy],
+		}
+	}
+
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rolePermissions).Error
+}
+
+// detachPermissions unlinks the grants, written as
+// permission[@scope][#policy], from roleID.
+func detachPermissions(tx *gorm.DB, roleID int64, grants []string) error {
+	for _, v := range grants {
+		grant, err := domain.ParseGrant(v)
+		if err != nil {
+			return err
+		}
+
+		policyIDs, err := getPolicyIDs(tx, []domain.Grant{grant})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("role_id = ? AND scope = ? AND policy_id = ?", roleID, string(grant.Scope), policyIDs[grant.Policy]).
+			Where("permission_id IN (?)", tx.Model(Permission{}).Select("id").Where("name = ?", grant.Permission)).
+			Delete(&RolePermission{}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteRole removes a role no user or group holds in any organization,
+// along with its grants and inheritance links.
+func deleteRole(tx *gorm.DB, id int64) error {
+	var assigned, groups int64
+
+	if err := skipTenant(tx).Model(UserRole{}).Where("role_id = ?", id).Count(&assigned).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(GroupRole{}).Where("role_id = ?", id).Count(&groups).Error; err != nil {
+		return err
+	}
+
+	if assigned > 0 || groups > 0 {
+		return domain.ErrRoleInUse
+	}
+
+	if err := bumpPermissionVersion(tx, id); err != nil {
+		return err
+	}
+
+	if err := tx.Where("role_id = ?", id).Delete(&RolePermission{}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("role_id = ? OR parent_id = ?", id, id).Delete(&RoleParent{}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("role_id = ?", id).Delete(&RoleConstraintRole{}).Error; err != nil {
+		return err
+	}
+
+	res := tx.Where("id = ?", id).Delete(&Role{})
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// deletePolicy removes a policy no grant uses.
+func deletePolicy(tx *gorm.DB, id int64) error {
+	var used int64
+
+	if err := tx.Model(RolePermission{}).Where("policy_id = ?", id).Count(&used).Error; err != nil {
+		return err
+	}
+
+	if used > 0 {
+		return domain.ErrPolicyInUse
+	}
+
+	res := tx.Where("id = ?", id).Delete(&Policy{})
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// getPolicyIDs maps the policy names used by grants to their IDs, with the
+// empty name mapped to zero. All policies must exist.
+func getPolicyIDs(tx *gorm.DB, grants []domain.Grant) (map[string]int64, error) {
+	res := map[string]int64{"": 0}
+
+	names := []string{}
+	for _, v := range grants {
+		if v.Policy != "" {
+			names = append(names, v.Policy)
+		}
+	}
+
+	if len(names) == 0 {
+		return res, nil
+	}
+
+	policies := []Policy{}
+
+	if err := tx.Where("name IN ?", names).Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	if len(policies) != len(uniqueStrings(names)) {
+		return nil, domain.ErrPolicyNotFound
+	}
+
+	for _, v := range policies {
+		res[v.Name] = v.ID
+	}
+
+	return res, nil
+}
+
+type userRoleRow struct {
+	UserID int64
+	RoleID int64
+	Name   string
+}
+
+type userGroupRow struct {
+	UserID  int64
+	GroupID int64
+	Name    string
+}
+
+// loadRoles sets the roles and groups of users, leaving out expired grants.
+func loadRoles(tx *gorm.DB, users []User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(users))
+	for i := 0; i < len(users); i++ {
+		ids[i] = users[i].ID
+	}
+
+	rows := []userRoleRow{}
+
+	if err := tx.Model(&UserRole{}).
+		Select("user_roles.user_id, roles.id AS role_id, roles.name").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id IN ?", ids).
+		Where("user_roles.expires_at IS NULL OR user_roles.expires_at > ?", time.Now()).
+		Order("roles.id asc").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	roles := map[int64][]Role{}
+	for _, v := range rows {
+		roles[v.UserID] = append(roles[v.UserID], Role{
+			ID:   v.RoleID,
+			Name: v.Name,
+		})
+	}
+
+	groupRows := []userGroupRow{}
+
+	if err := tx.Model(&GroupMember{}).
+		Select("group_members.user_id, user_groups.id AS group_id, user_groups.name").
+		Joins("JOIN user_groups ON user_groups.id = group_members.group_id").
+		Where("group_members.user_id IN ?", ids).
+		Order("user_groups.name asc").
+		Scan(&groupRows).Error; err != nil {
+		return err
+	}
+
+	groups := map[int64][]Group{}
+	for _, v := range groupRows {
+		groups[v.UserID] = append(groups[v.UserID], Group{
+			ID:   v.GroupID,
+			Name: v.Name,
+		})
+	}
+
+	groupRoleRows := []userRoleRow{}
+
+	if err := tx.Model(&GroupMember{}).
+		Select("DISTINCT group_members.user_id, roles.id AS role_id, roles.name").
+		Joins("JOIN group_roles ON group_roles.group_id = group_members.group_id").
+		Joins("JOIN roles ON roles.id = group_roles.role_id").
+		Where("group_members.user_id IN ?", ids).
+		Order("roles.id asc").
+		Scan(&groupRoleRows).Error; err != nil {
+		return err
+	}
+
+	groupRoles := map[int64][]Role{}
+	for _, v := range groupRoleRows {
+		groupRoles[v.UserID] = append(groupRoles[v.UserID], Role{
+			ID:   v.RoleID,
+			Name: v.Name,
+		})
+	}
+
+	for i := 0; i < len(users); i++ {
+		users[i].Roles = roles[users[i].ID]
+		users[i].Groups = groups[users[i].ID]
+		users[i].GroupRoles = groupRoles[users[i].ID]
+	}
+
+	return nil
+}
+
+// assignRoles links the named roles to userID as described by grant. A role
+// already assigned keeps the later expiry of both grants, where nil never
+// expires, and its original granter. All roles must exist and the result
+// must not break a role constraint.
+func assignRoles(tx *gorm.DB, userID int64, names []string, grant domain.RoleGrant) error {
+	orgID := grant.OrgID
+	if orgID == 0 {
+		orgID = domain.TenantID(tx.Statement.Context)
+	}
+
+	roles := []Role{}
+
+	if err := tx.Where("name IN ?", names).Find(&roles).Error; err != nil {
+		return err
+	}
+
+	if len(roles) != len(uniqueStrings(names)) {
+		return domain.ErrRoleNotFound
+	}
+
+	userRoles := make([]UserRole, len(roles))
+	for i := 0; i < len(roles); i++ {
+		userRoles[i] = UserRole{
+			UserID:    userID,
+			RoleID:    roles[i].ID,
+			OrgID:     orgID,
+			GrantedBy: grant.GrantedBy,
+			ExpiresAt: grant.ExpiresAt,
+		}
+	}
+
+	if err := tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"expires_at": gorm.Expr("IF(user_roles.expires_at IS NULL OR VALUES(expires_at) IS NULL, NULL, GREATEST(user_roles.expires_at, VALUES(expires_at)))"),
+		}),
+	}).Create(&userRoles).Error; err != nil {
+		return err
+	}
+
+	return checkRoleConstraints(tx, userID, orgID)
+}
+
+func createAuditLog(tx *gorm.DB, entry *domain.AuditEntry) error {
+	return tx.Create(MakeAuditLog(entry)).Error
+}
+
+func bumpUserPermissionVersion(tx *gorm.DB, userID int64) error {
+	return tx.Model(User{}).Where("id = ?", userID).
+		UpdateColumn("permission_version", gorm.Expr("permission_version + 1")).Error
+}
+
+// bumpPermissionVersion invalidates the permissions embedded in the access
+// tokens of every user holding roleID or a role inheriting from it, in any
+// organization.
+func bumpPermissionVersion(tx *gorm.DB, roleID int64) error {
+	tx = skipTenant(tx)
+
+	g, err := getRoleGraph(tx)
+	if err != nil {
+		return err
+	}
+
+	role, ok := g.byID(roleID)
+	if !ok {
+		return nil
+	}
+
+	roleIDs := g.inheritors(role.Name)
+	groupIDs := tx.Model(GroupRole{}).Select("group_id").Where("role_id IN ?", roleIDs)
+
+	return tx.Model(User{}).
+		Where("id IN (?) OR id IN (?)",
+			tx.Model(UserRole{}).Select("user_id").Where("role_id IN ?", roleIDs),
+			tx.Model(GroupMember{}).Select("user_id").Where("group_id IN (?)", groupIDs)).
+		UpdateColumn("permission_version", gorm.Expr("permission_version + 1")).Error
+}
+
+// subtractStrings returns the values missing from other, without
+// duplicates.
+func subtractStrings(values, other []string) []string {
+	skip := make(map[string]bool, len(other))
+	for _, v := range other {
+		skip[v] = true
+	}
+
+	res := []string{}
+
+	for _, v := range uniqueStrings(values) {
+		if !skip[v] {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	res := []string{}
+
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,109 @@
+package usermysql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// statementLog records the SQL of the statements run.
+type statementLog struct {
+	logger.Interface
+	statements []string
+}
+
+func (l *statementLog) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	l.statements = append(l.statements, sql)
+}
+
+// find returns the statements starting with prefix.
+func (l *statementLog) find(prefix string) []string {
+	res := []string{}
+
+	for _, v := range l.statements {
+		if strings.HasPrefix(v, prefix) {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// dryRun returns a database which only builds statements, scoped to the
+// tenants as the repository's.
+func dryRun(t *testing.T) (*gorm.DB, *statementLog) {
+	conn, err := sql.Open("mysql", "user:password@tcp(localhost:3306)/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := &statementLog{Interface: logger.Discard}
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registerTenantScope(db)
+
+	return db.WithContext(context.Background()), log
+}
+
+func TestReplaceRolesKeepsGrants(t *testing.T) {
+	db, log := dryRun(t)
+
+	if err := replaceRoles(db, 1, []string{"admin", "user"}, []string{"user", "admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// an elevated admin grant would lose its expiry if rewritten
+	if len(log.statements) != 0 {
+		t.Errorf("unchanged roles ran %q", log.statements)
+	}
+
+	db, log = dryRun(t)
+
+	if err := replaceRoles(db, 1, []string{"admin", "user"}, []string{"admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	deletes := log.find("DELETE FROM `user_roles`")
+	if len(deletes) != 1 || !strings.Contains(deletes[0], "name IN ('user')") {
+		t.Errorf("expected the user role to be deleted alone, got %q", deletes)
+	}
+
+	if inserts := log.find("INSERT INTO `user_roles`"); len(inserts) != 0 {
+		t.Errorf("kept roles were granted again: %q", inserts)
+	}
+}
+
+func TestSubtractStrings(t *testing.T) {
+	tests := []struct {
+		values, other, want []string
+	}{
+		{nil, []string{"a"}, []string{}},
+		{[]string{"a", "b"}, nil, []string{"a", "b"}},
+		{[]string{"a", "b", "a"}, []string{"b"}, []string{"a"}},
+		{[]string{"a"}, []string{"a", "b"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		got := subtractStrings(tt.values, tt.other)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("subtractStrings(%q, %q) = %q, want %q", tt.values, tt.other, got, tt.want)
+		}
+	}
+}
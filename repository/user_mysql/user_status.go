@@ -0,0 +1,142 @@
+package usermysql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *repository) SetUserStatus(ctx context.Context, id int64, from domain.UserStatus, change *domain.StatusChange) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", id).First(&User{}).Error; err != nil {
+			return err
+		}
+
+		// the status is matched too, so concurrent changes cannot skip the
+		// transition checks
+		res := tx.Model(&User{}).Where("id = ? AND status = ?", id, string(from)).
+			Updates(statusColumns(change))
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return domain.ErrInvalidTransition
+		}
+
+		return createAuditLog(tx, &domain.AuditEntry{
+			ActorID:      change.ChangedBy,
+			Action:       domain.AuditUserStatusChanged,
+			TargetUserID: id,
+			Detail:       statusDetail(from, change),
+		})
+	})
+}
+
+func (r *repository) RecordLoginFailure(ctx context.Context, id int64, max int, lock *domain.StatusChange) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", id).
+			UpdateColumn("failed_logins", gorm.Expr("failed_logins + 1")).Error; err != nil {
+			return err
+		}
+
+		if max <= 0 {
+			return nil
+		}
+
+		user := User{}
+		if err := tx.Select("id", "status", "status_until", "failed_logins").Where("id = ?", id).First(&user).Error; err != nil {
+			return err
+		}
+
+		// only active users are locked, a lock must not replace e.g. a
+		// deactivation which would then end with the lock
+		if user.FailedLogins < max || user.ToEntity().EffectiveStatus(time.Now()) != domain.UserActive {
+			return nil
+		}
+
+		columns := statusColumns(lock)
+		columns["failed_logins"] = 0
+
+		// as in SetUserStatus, the status is matched so a concurrent change
+		// wins
+		res := tx.Model(&User{}).Where("id = ? AND status = ?", id, user.Status).Updates(columns)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return nil
+		}
+
+		return createAuditLog(tx, &domain.AuditEntry{
+			ActorID:      lock.ChangedBy,
+			Action:       domain.AuditUserStatusChanged,
+			TargetUserID: id,
+			Detail:       statusDetail(domain.UserStatus(user.Status), lock),
+		})
+	})
+}
+
+// RecordLogin leaves updated_at alone, signing in does not change the user.
+func (r *repository) RecordLogin(ctx context.Context, id int64, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{
+			"last_login_at": at,
+			"failed_logins": 0,
+		}).Error
+}
+
+func statusColumns(change *domain.StatusChange) map[string]interface{} {
+	columns := map[string]interface{}{
+		"status":        string(change.Status),
+		"status_reason": change.Reason,
+		"status_until":  change.Until,
+	}
+
+	// a reactivated user starts over with its login attempts
+	if change.Status == domain.UserActive {
+		columns["failed_logins"] = 0
+	}
+
+	return columns
+}
+
+func statusDetail(from domain.UserStatus, change *domain.StatusChange) string {
+	detail := fmt.Sprintf("%s -> %s", from, change.Status)
+
+	if change.Until != nil {
+		detail += " until " + change.Until.Format(time.RFC3339)
+	}
+
+	if change.Reason != "" {
+		detail += ": " + change.Reason
+	}
+
+	return detail
+}
+
+// statusExpr matches users having the effective status at now, suspensions
+// and locks which have ended counting as active.
+func statusExpr(status domain.UserStatus, now time.Time) clause.Expr {
+	ending := []string{string(domain.UserSuspended), string(domain.UserLocked)}
+
+	switch status {
+	case domain.UserActive:
+		return clause.Expr{
+			SQL:  "(status = ? OR (status IN ? AND status_until <= ?))",
+			Vars: []interface{}{string(status), ending, now},
+		}
+	case domain.UserSuspended, domain.UserLocked:
+		return clause.Expr{
+			SQL:  "(status = ? AND (status_until IS NULL OR status_until > ?))",
+			Vars: []interface{}{string(status), now},
+		}
+	}
+
+	return clause.Expr{SQL: "status = ?", Vars: []interface{}{string(status)}}
+}
@@ -2,41 +2,82 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/adetxt/user/config"
 	"github.com/adetxt/user/domain"
 	authUtils "github.com/adetxt/user/utils/auth"
 	passwordUtils "github.com/adetxt/user/utils/password"
+	"gorm.io/gorm"
 )
 
 type authUsecase struct {
 	cfg      config.Config
 	userRepo domain.UserRepository
+	mailer   domain.Mailer
+	searcher domain.UserSearcher
+	guard    domain.RegistrationGuard
 }
 
-func NewAuthUsecase(cfg config.Config, userRepo domain.UserRepository) domain.AuthUsecase {
+// NewAuthUsecase returns the auth usecase. guard may be nil to accept every
+// registration.
+func NewAuthUsecase(cfg config.Config, userRepo domain.UserRepository, mailer domain.Mailer, searcher domain.UserSearcher, guard domain.RegistrationGuard) domain.AuthUsecase {
 	return &authUsecase{
 		cfg:      cfg,
 		userRepo: userRepo,
+		mailer:   mailer,
+		searcher: searcher,
+		guard:    guard,
 	}
 }
 
-func (uc *authUsecase) Login(ctx context.Context, email, password string) (*domain.FullToken, error) {
+func (uc *authUsecase) Login(ctx context.Context, email, password string, orgID int64) (*domain.FullToken, error) {
 	user, err := uc.userRepo.GetUserByIdentifier(ctx, "email", email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.ErrInvalidCredentials
+	}
+
 	if err != nil {
 		return nil, err
 	}
 
+	// a locked user tells nothing, not even whether the password matched,
+	// so guessing stays pointless until the lock ends
+	if user.EffectiveStatus(time.Now()) == domain.UserLocked {
+		return nil, domain.ErrInvalidCredentials
+	}
+
 	if err := passwordUtils.ComparePassword(password, user.Password); err != nil {
-		return nil, domain.ErrPasswordIncorrect
+		until := time.Now().Add(uc.cfg.LockDuration)
+
+		if err := uc.userRepo.RecordLoginFailure(ctx, user.ID, uc.cfg.MaxFailedLogins, &domain.StatusChange{
+			Status: domain.UserLocked,
+			Reason: "too many failed logins",
+			Until:  &until,
+		}); err != nil {
+			return nil, err
+		}
+
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	if err := checkStatus(user, time.Now()); err != nil {
+		return nil, err
+	}
+
+	user, err = uc.getTenantUser(ctx, user.ID, orgID)
+	if err != nil {
+		return nil, err
 	}
 
 	expDuration := time.Duration(1) * time.Hour
 	exp := time.Now().Add(expDuration)
 
-	token, err := authUtils.GetToken(user.ID, exp, uc.cfg.JWTKey)
+	token, err := uc.getToken(ctx, user, orgID, exp)
 	if err != nil {
 		return nil, fmt.Errorf("failen when generating token : %v", err.Error())
 	}
@@ -44,11 +85,15 @@ func (uc *authUsecase) Login(ctx context.Context, email, password string) (*doma
 	refreshExpDuration := time.Duration((24 * 7)) * time.Hour
 	refreshExp := time.Now().Add(refreshExpDuration)
 
-	refreshToken, err := authUtils.GetRefreshToken(user.ID, refreshExp, uc.cfg.JWTKey)
+	refreshToken, err := authUtils.GetRefreshToken(user.ID, orgID, refreshExp, uc.cfg.JWTKey)
 	if err != nil {
 		return nil, fmt.Errorf("failen when generating refresh token")
 	}
 
+	if err := uc.userRepo.RecordLogin(ctx, user.ID, time.Now()); err != nil {
+		return nil, err
+	}
+
 	return &domain.FullToken{
 		Token:                 token,
 		TokenExpiredAt:        exp,
@@ -57,11 +102,16 @@ func (uc *authUsecase) Login(ctx context.Context, email, password string) (*doma
 	}, nil
 }
 
-func (uc *authUsecase) RefreshToken(ctx context.Context, id int64) (*domain.AccessToken, error) {
+func (uc *authUsecase) RefreshToken(ctx context.Context, id, orgID int64) (*domain.AccessToken, error) {
 	expDuration := time.Duration(1) * time.Hour
 	exp := time.Now().Add(expDuration)
 
-	token, err := authUtils.GetToken(id, exp, uc.cfg.JWTKey)
+	user, err := uc.getTenantUser(ctx, id, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := uc.getToken(ctx, user, orgID, exp)
 	if err != nil {
 		return nil, fmt.Errorf("failen when generating token")
 	}
@@ -71,3 +121,182 @@ func (uc *authUsecase) RefreshToken(ctx context.Context, id int64) (*domain.Acce
 		TokenExpiredAt: exp,
 	}, nil
 }
+
+func (uc *authUsecase) AcceptInvitation(ctx context.Context, token, name, password string) error {
+	hashed, err := passwordUtils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	id, err := uc.userRepo.AcceptInvitation(ctx, authUtils.HashOpaqueToken(token), &domain.User{
+		Name:     name,
+		Password: hashed,
+	}, time.Now())
+	if err != nil {
+		return err
+	}
+
+	indexUsers(ctx, uc.userRepo, uc.searcher, id)
+
+	return nil
+}
+
+func (uc *authUsecase) Register(ctx context.Context, r *domain.Registration) (int64, error) {
+	mode := domain.RegistrationMode(uc.cfg.RegistrationMode)
+	if mode != domain.RegistrationOpen && mode != domain.RegistrationDomains {
+		return 0, domain.ErrRegistrationDisabled
+	}
+
+	addr, err := mail.ParseAddress(r.Email)
+	if err != nil || addr.Address != r.Email {
+		return 0, domain.ErrInvalidEmail
+	}
+
+	if mode == domain.RegistrationDomains && !uc.domainAllowed(r.Email) {
+		return 0, domain.ErrEmailDomainNotAllowed
+	}
+
+	if uc.guard != nil {
+		if err := uc.guard.Check(ctx, r); err != nil {
+			return 0, err
+		}
+	}
+
+	hashed, err := passwordUtils.HashPassword(r.Password)
+	if err != nil {
+		return 0, err
+	}
+
+	user := &domain.User{
+		Name:     r.Name,
+		Email:    r.Email,
+		Password: hashed,
+		Status:   domain.UserActive,
+	}
+
+	roles := []string{}
+	if uc.cfg.RegistrationRole != "" {
+		roles = append(roles, uc.cfg.RegistrationRole)
+	}
+
+	if !uc.cfg.RegistrationVerifyEmail {
+		id, err := uc.userRepo.RegisterUser(ctx, user, roles, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		indexUsers(ctx, uc.userRepo, uc.searcher, id)
+
+		return id, nil
+	}
+
+	token, hash, err := authUtils.NewOpaqueToken()
+	if err != nil {
+		return 0, err
+	}
+
+	verification := &domain.EmailVerification{
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(uc.cfg.VerifyEmailTTL),
+	}
+
+	link, err := tokenLink(uc.cfg.VerifyEmailURL, token)
+	if err != nil {
+		return 0, err
+	}
+
+	user.Status = domain.UserUnverified
+
+	id, err := uc.userRepo.RegisterUser(ctx, user, roles, verification)
+	if err != nil {
+		return 0, err
+	}
+
+	// the user could never verify the address, which it would hold, so it
+	// is removed and may register again
+	if err := uc.mailer.Send(ctx, r.Email, "Verify your email address", fmt.Sprintf(
+		"Confirm your email address at the link below before %s to start signing in.\n\n%s\n",
+		verification.ExpiresAt.Format(time.RFC1123), link,
+	)); err != nil {
+		if cancelErr := uc.userRepo.CancelRegistration(ctx, id); cancelErr != nil {
+			return 0, fmt.Errorf("%w (cancelling the registration failed: %v)", err, cancelErr)
+		}
+
+		return 0, err
+	}
+
+	indexUsers(ctx, uc.userRepo, uc.searcher, id)
+
+	return id, nil
+}
+
+func (uc *authUsecase) VerifyEmail(ctx context.Context, token string) error {
+	return uc.userRepo.VerifyEmail(ctx, authUtils.HashOpaqueToken(token), time.Now())
+}
+
+func (uc *authUsecase) domainAllowed(email string) bool {
+	domainName := strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+
+	for _, v := range uc.cfg.RegistrationDomains {
+		if strings.ToLower(strings.TrimSpace(v)) == domainName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getTenantUser loads userID with the roles it holds in orgID, which it
+// must be an active member of.
+func (uc *authUsecase) getTenantUser(ctx context.Context, userID, orgID int64) (*domain.User, error) {
+	if orgID != 0 {
+		member, err := uc.userRepo.IsMember(ctx, orgID, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !member {
+			return nil, domain.ErrNotMember
+		}
+	}
+
+	user, err := uc.userRepo.GetUserByIdentifier(domain.WithTenant(ctx, orgID), "id", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkStatus(user, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// checkStatus makes sure user may sign in at now.
+func checkStatus(user *domain.User, now time.Time) error {
+	switch status := user.EffectiveStatus(now); status {
+	case domain.UserActive:
+		return nil
+	case domain.UserUnverified:
+		return domain.ErrEmailNotVerified
+	default:
+		return fmt.Errorf("%w: %s", domain.ErrUserNotActive, status)
+	}
+}
+
+// getToken signs an access token for user in orgID, embedding its roles and
+// permissions when JWTEmbedPermissions is enabled.
+func (uc *authUsecase) getToken(ctx context.Context, user *domain.User, orgID int64, exp time.Time) (string, error) {
+	if !uc.cfg.JWTEmbedPermissions {
+		return authUtils.GetToken(user.ID, orgID, exp, uc.cfg.JWTKey)
+	}
+
+	roles := user.AllRoles()
+
+	ps, err := uc.userRepo.GetPermissionsByRole(ctx, roles)
+	if err != nil {
+		return "", err
+	}
+
+	return authUtils.GetTokenWithPermissions(user.ID, orgID, roles, ps, user.PermissionVersion, exp, uc.cfg.JWTKey)
+}
@@ -0,0 +1,53 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adetxt/user/config"
+	"github.com/adetxt/user/domain"
+	passwordUtils "github.com/adetxt/user/utils/password"
+)
+
+func TestLoginHidesStatusWithoutPassword(t *testing.T) {
+	hashed, err := passwordUtils.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	until := time.Now().Add(time.Hour)
+	repo := &fakeUserRepo{
+		users: map[int64]*domain.User{
+			1: {ID: 1, Email: "locked@example.com", Password: hashed, Status: domain.UserLocked, StatusUntil: &until},
+			2: {ID: 2, Email: "suspended@example.com", Password: hashed, Status: domain.UserSuspended},
+			3: {ID: 3, Email: "deactivated@example.com", Password: hashed, Status: domain.UserDeactivated},
+			4: {ID: 4, Email: "unverified@example.com", Password: hashed, Status: domain.UserUnverified},
+		},
+	}
+	uc := NewAuthUsecase(config.Config{MaxFailedLogins: 5, LockDuration: time.Minute}, repo, nil, nil, nil)
+
+	tests := []struct {
+		email    string
+		password string
+		err      error
+	}{
+		{email: "nobody@example.com", password: "secret", err: domain.ErrInvalidCredentials},
+		// locked users give nothing away, the right password included
+		{email: "locked@example.com", password: "wrong", err: domain.ErrInvalidCredentials},
+		{email: "locked@example.com", password: "secret", err: domain.ErrInvalidCredentials},
+		{email: "suspended@example.com", password: "wrong", err: domain.ErrInvalidCredentials},
+		{email: "suspended@example.com", password: "secret", err: domain.ErrUserNotActive},
+		{email: "deactivated@example.com", password: "wrong", err: domain.ErrInvalidCredentials},
+		{email: "deactivated@example.com", password: "secret", err: domain.ErrUserNotActive},
+		{email: "unverified@example.com", password: "wrong", err: domain.ErrInvalidCredentials},
+		{email: "unverified@example.com", password: "secret", err: domain.ErrEmailNotVerified},
+	}
+
+	for _, tt := range tests {
+		if _, err := uc.Login(context.Background(), tt.email, tt.password, 0); !errors.Is(err, tt.err) {
+			t.Errorf("Login(%s, %s) = %v, want %v", tt.email, tt.password, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/adetxt/user/domain"
+	"github.com/adetxt/user/utils/pow"
+	"github.com/adetxt/user/utils/ratelimit"
+)
+
+type rateLimitGuard struct {
+	limiter *ratelimit.Limiter
+}
+
+// NewRateLimitGuard allows limit registrations per client IP and window.
+func NewRateLimitGuard(limit int, window time.Duration) domain.RegistrationGuard {
+	return &rateLimitGuard{
+		limiter: ratelimit.New(limit, window),
+	}
+}
+
+func (g *rateLimitGuard) Check(ctx context.Context, r *domain.Registration) error {
+	if !g.limiter.Allow(r.ClientIP) {
+		return domain.ErrTooManyRegistrations
+	}
+
+	return nil
+}
+
+type proofOfWorkGuard struct {
+	difficulty int
+}
+
+// NewProofOfWorkGuard requires a proof of work of difficulty leading zero
+// bits for the email address, see package pow.
+func NewProofOfWorkGuard(difficulty int) domain.RegistrationGuard {
+	return &proofOfWorkGuard{
+		difficulty: difficulty,
+	}
+}
+
+func (g *proofOfWorkGuard) Check(ctx context.Context, r *domain.Registration) error {
+	if err := pow.Verify(strings.ToLower(r.Email), r.Proof, g.difficulty, 10*time.Minute, time.Now()); err != nil {
+		return domain.ErrInvalidProofOfWork
+	}
+
+	return nil
+}
@@ -0,0 +1,397 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/adetxt/user/domain"
+)
+
+// maxRelationDepth bounds how many usersets a check may follow.
+const maxRelationDepth = 25
+
+type relationUsecase struct {
+	namespaces   map[string]map[string]domain.Relation
+	relationRepo domain.RelationRepository
+}
+
+func NewRelationUsecase(namespaces []domain.Namespace, relationRepo domain.RelationRepository) domain.RelationUsecase {
+	uc := &relationUsecase{
+		namespaces:   map[string]map[string]domain.Relation{},
+		relationRepo: relationRepo,
+	}
+
+	for _, ns := range namespaces {
+		relations := map[string]domain.Relation{}
+		for _, r := range ns.Relations {
+			relations[r.Name] = r
+		}
+
+		uc.namespaces[ns.Name] = relations
+	}
+
+	return uc
+}
+
+func (uc *relationUsecase) Check(ctx context.Context, tuple domain.RelationTuple) (bool, error) {
+	if _, err := uc.getRelation(tuple.Object.Namespace, tuple.Relation); err != nil {
+		return false, err
+	}
+
+	return uc.check(ctx, tuple.Object, tuple.Relation, tuple.Subject, map[string]bool{})
+}
+
+func (uc *relationUsecase) Expand(ctx context.Context, object domain.Object, relation string) (*domain.SubjectTree, error) {
+	if _, err := uc.getRelation(object.Namespace, relation); err != nil {
+		return nil, err
+	}
+
+	return uc.expand(ctx, object, relation, map[string]bool{})
+}
+
+// ListObjects walks the rewrites backwards from subject to every userset
+// holding it, so only the tuples on the way are read instead of checking
+// every object of namespace. Each userset is visited once, which ends
+// cycles. Objects are sorted by ID.
+func (uc *relationUsecase) ListObjects(ctx context.Context, namespace, relation string, subject domain.Subject) ([]domain.Object, error) {
+	if _, err := uc.getRelation(namespace, relation); err != nil {
+		return nil, err
+	}
+
+	reached := map[domain.Subject]bool{}
+	queue := []domain.Subject{}
+	reach := func(userset domain.Subject) {
+		if !reached[userset] {
+			reached[userset] = true
+			queue = append(queue, userset)
+		}
+	}
+
+	// a userset holds itself, as in check
+	if subject.Relation != "" {
+		reach(subject)
+	} else if err := uc.reachDirect(ctx, subject, reach); err != nil {
+		return nil, err
+	}
+
+	res := []domain.Object{}
+
+	for len(queue) > 0 {
+		userset := queue[0]
+		queue = queue[1:]
+
+		if userset.Object.Namespace == namespace && userset.Relation == relation {
+			res = append(res, userset.Object)
+		}
+
+		if err := uc.reachDirect(ctx, userset, reach); err != nil {
+			return nil, err
+		}
+
+		if err := uc.reachRewrites(ctx, userset, reach); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+
+	return res, nil
+}
+
+// reachDirect reaches the usersets of the tuples written for subject, when
+// their relation takes direct tuples.
+func (uc *relationUsecase) reachDirect(ctx context.Context, subject domain.Subject, reach func(domain.Subject)) error {
+	tuples, err := uc.relationRepo.ReadTuples(ctx, &domain.TupleFilter{
+		Subject: &subject,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tuples {
+		r, err := uc.getRelation(t.Object.Namespace, t.Relation)
+		if err != nil {
+			continue
+		}
+
+		for _, u := range rewrite(r) {
+			if u.This {
+				reach(domain.Subject{Object: t.Object, Relation: t.Relation})
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// reachRewrites reaches the relations computing userset, on its own object
+// or on the objects of their tuplesets.
+func (uc *relationUsecase) reachRewrites(ctx context.Context, userset domain.Subject, reach func(domain.Subject)) error {
+	for namespace, relations := range uc.namespaces {
+		for _, r := range relations {
+			for _, u := range rewrite(r) {
+				switch {
+				case u.ComputedUserset != "":
+					if namespace == userset.Object.Namespace && u.ComputedUserset == userset.Relation {
+						reach(domain.Subject{Object: userset.Object, Relation: r.Name})
+					}
+				case u.TupleToUserset != nil:
+					if u.TupleToUserset.ComputedUserset != userset.Relation {
+						continue
+					}
+
+					tuples, err := uc.relationRepo.ReadTuples(ctx, &domain.TupleFilter{
+						Namespace:     namespace,
+						Relation:      u.TupleToUserset.Tupleset,
+						SubjectObject: &userset.Object,
+					})
+					if err != nil {
+						return err
+					}
+
+					for _, t := range tuples {
+						reach(domain.Subject{Object: t.Object, Relation: r.Name})
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteTuples only accepts platform callers, tuples being shared by every
+// organization.
+func (uc *relationUsecase) WriteTuples(ctx context.Context, writes, deletes []domain.RelationTuple) error {
+	if err := checkPlatform(ctx); err != nil {
+		return err
+	}
+
+	for _, v := range append(append([]domain.RelationTuple{}, writes...), deletes...) {
+		if err := uc.validateTuple(v); err != nil {
+			return err
+		}
+	}
+
+	return uc.relationRepo.WriteTuples(ctx, writes, deletes)
+}
+
+// validateTuple makes sure the tuple fits the namespace config and is
+// written for a relation that takes direct tuples.
+func (uc *relationUsecase) validateTuple(tuple domain.RelationTuple) error {
+	relation, err := uc.getRelation(tuple.Object.Namespace, tuple.Relation)
+	if err != nil {
+		return err
+	}
+
+	direct := false
+	for _, v := range rewrite(relation) {
+		direct = direct || v.This
+	}
+
+	if !direct {
+		return fmt.Errorf("%w: %s only has computed subjects", domain.ErrInvalidTuple, tuple)
+	}
+
+	if _, ok := uc.namespaces[tuple.Subject.Object.Namespace]; !ok {
+		return fmt.Errorf("%w: %s", domain.ErrUnknownNamespace, tuple.Subject.Object.Namespace)
+	}
+
+	if tuple.Subject.Relation != "" {
+		if _, err := uc.getRelation(tuple.Subject.Object.Namespace, tuple.Subject.Relation); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// check reports whether subject holds relation on object. visited holds the
+// usersets on the current path, so cyclic tuples end instead of looping.
+func (uc *relationUsecase) check(ctx context.Context, object domain.Object, relation string, subject domain.Subject, visited map[string]bool) (bool, error) {
+	if subject.Relation != "" && subject.Object == object && subject.Relation == relation {
+		return true, nil
+	}
+
+	userset := domain.Subject{Object: object, Relation: relation}.String()
+	if visited[userset] {
+		return false, nil
+	}
+
+	if len(visited) >= maxRelationDepth {
+		return false, domain.ErrRelationDepth
+	}
+
+	r, err := uc.getRelation(object.Namespace, relation)
+	if err != nil {
+		return false, err
+	}
+
+	visited[userset] = true
+	defer delete(visited, userset)
+
+	for _, u := range rewrite(r) {
+		switch {
+		case u.This:
+			tuples, err := uc.readTuples(ctx, object, relation)
+			if err != nil {
+				return false, err
+			}
+
+			for _, t := range tuples {
+				if t.Subject == subject {
+					return true, nil
+				}
+
+				if t.Subject.Relation == "" {
+					continue
+				}
+
+				ok, err := uc.check(ctx, t.Subject.Object, t.Subject.Relation, subject, visited)
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+		case u.ComputedUserset != "":
+			ok, err := uc.check(ctx, object, u.ComputedUserset, subject, visited)
+			if err != nil || ok {
+				return ok, err
+			}
+		case u.TupleToUserset != nil:
+			tuples, err := uc.readTuples(ctx, object, u.TupleToUserset.Tupleset)
+			if err != nil {
+				return false, err
+			}
+
+			for _, t := range tuples {
+				if !uc.hasRelation(t.Subject.Object.Namespace, u.TupleToUserset.ComputedUserset) {
+					continue
+				}
+
+				ok, err := uc.check(ctx, t.Subject.Object, u.TupleToUserset.ComputedUserset, subject, visited)
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// expand builds the subject tree of relation on object, leaving usersets
+// already on the current path empty.
+func (uc *relationUsecase) expand(ctx context.Context, object domain.Object, relation string, visited map[string]bool) (*domain.SubjectTree, error) {
+	node := &domain.SubjectTree{
+		Userset: domain.Subject{Object: object, Relation: relation},
+	}
+
+	userset := node.Userset.String()
+	if visited[userset] {
+		return node, nil
+	}
+
+	if len(visited) >= maxRelationDepth {
+		return nil, domain.ErrRelationDepth
+	}
+
+	r, err := uc.getRelation(object.Namespace, relation)
+	if err != nil {
+		return nil, err
+	}
+
+	visited[userset] = true
+	defer delete(visited, userset)
+
+	for _, u := range rewrite(r) {
+		switch {
+		case u.This:
+			tuples, err := uc.readTuples(ctx, object, relation)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, t := range tuples {
+				if t.Subject.Relation == "" {
+					node.Subjects = append(node.Subjects, t.Subject)
+					continue
+				}
+
+				child, err := uc.expand(ctx, t.Subject.Object, t.Subject.Relation, visited)
+				if err != nil {
+					return nil, err
+				}
+
+				node.Children = append(node.Children, child)
+			}
+		case u.ComputedUserset != "":
+			child, err := uc.expand(ctx, object, u.ComputedUserset, visited)
+			if err != nil {
+				return nil, err
+			}
+
+			node.Children = append(node.Children, child)
+		case u.TupleToUserset != nil:
+			tuples, err := uc.readTuples(ctx, object, u.TupleToUserset.Tupleset)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, t := range tuples {
+				if !uc.hasRelation(t.Subject.Object.Namespace, u.TupleToUserset.ComputedUserset) {
+					continue
+				}
+
+				child, err := uc.expand(ctx, t.Subject.Object, u.TupleToUserset.ComputedUserset, visited)
+				if err != nil {
+					return nil, err
+				}
+
+				node.Children = append(node.Children, child)
+			}
+		}
+	}
+
+	return node, nil
+}
+
+func (uc *relationUsecase) readTuples(ctx context.Context, object domain.Object, relation string) ([]domain.RelationTuple, error) {
+	return uc.relationRepo.ReadTuples(ctx, &domain.TupleFilter{
+		Namespace: object.Namespace,
+		ObjectID:  object.ID,
+		Relation:  relation,
+	})
+}
+
+func (uc *relationUsecase) getRelation(namespace, relation string) (domain.Relation, error) {
+	relations, ok := uc.namespaces[namespace]
+	if !ok {
+		return domain.Relation{}, fmt.Errorf("%w: %s", domain.ErrUnknownNamespace, namespace)
+	}
+
+	r, ok := relations[relation]
+	if !ok {
+		return domain.Relation{}, fmt.Errorf("%w: %s#%s", domain.ErrUnknownRelation, namespace, relation)
+	}
+
+	return r, nil
+}
+
+func (uc *relationUsecase) hasRelation(namespace, relation string) bool {
+	_, err := uc.getRelation(namespace, relation)
+	return err == nil
+}
+
+// rewrite returns the usersets of relation, a relation without rewrite
+// only has its direct tuples.
+func rewrite(relation domain.Relation) []domain.Userset {
+	if len(relation.Rewrite) == 0 {
+		return []domain.Userset{{This: true}}
+	}
+
+	return relation.Rewrite
+}
@@ -0,0 +1,373 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/adetxt/user/domain"
+	relationmemory "github.com/adetxt/user/repository/relation_memory"
+)
+
+const testNamespaces = `[
+	{"name": "user"},
+	{"name": "group", "relations": [{"name": "member"}]},
+	{"name": "folder", "relations": [
+		{"name": "owner"},
+		{"name": "viewer", "rewrite": [{"this": true}, {"computed_userset": "owner"}]}
+	]},
+	{"name": "doc", "relations": [
+		{"name": "parent"},
+		{"name": "owner"},
+		{"name": "editor", "rewrite": [{"this": true}, {"computed_userset": "owner"}]},
+		{"name": "viewer", "rewrite": [
+			{"this": true},
+			{"computed_userset": "editor"},
+			{"tuple_to_userset": {"tupleset": "parent", "computed_userset": "viewer"}}
+		]},
+		{"name": "can_delete", "rewrite": [{"computed_userset": "owner"}]}
+	]}
+]`
+
+// testTuples share a document through a group, its folder and ownership,
+// with groups a and b containing each other.
+var testTuples = []string{
+	"doc:readme#owner@user:alice",
+	"doc:readme#editor@group:eng#member",
+	"doc:readme#parent@folder:shared",
+	"doc:notes#viewer@user:dave",
+	"doc:notes#parent@folder:private",
+	"doc:plan#parent@folder:shared",
+	"group:eng#member@user:bob",
+	"folder:shared#viewer@user:carol",
+	"folder:private#owner@user:erin",
+	"group:a#member@group:b#member",
+	"group:b#member@group:a#member",
+	"group:b#member@user:frank",
+}
+
+func newTestRelationUsecase(t *testing.T, tuples []string) domain.RelationUsecase {
+	t.Helper()
+
+	namespaces, err := domain.ParseNamespaces([]byte(testNamespaces))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uc := NewRelationUsecase(namespaces, relationmemory.New())
+	if err := uc.WriteTuples(context.Background(), parseTestTuples(t, tuples), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return uc
+}
+
+func parseTestTuples(t *testing.T, values []string) []domain.RelationTuple {
+	t.Helper()
+
+	res := make([]domain.RelationTuple, len(values))
+	for i, v := range values {
+		tuple, err := domain.ParseRelationTuple(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res[i] = tuple
+	}
+
+	return res
+}
+
+// groupChain makes group:g0 to group:g<n> contain each other in a row, the
+// last one holding user:zoe.
+func groupChain(n int) []string {
+	res := []string{}
+	for i := 0; i < n; i++ {
+		res = append(res, fmt.Sprintf("group:g%d#member@group:g%d#member", i, i+1))
+	}
+
+	return append(res, fmt.Sprintf("group:g%d#member@user:zoe", n))
+}
+
+func TestRelationCheck(t *testing.T) {
+	uc := newTestRelationUsecase(t, testTuples)
+
+	tests := []struct {
+		tuple string
+		want  bool
+	}{
+		{tuple: "doc:readme#owner@user:alice", want: true},
+		{tuple: "doc:readme#editor@user:alice", want: true},
+		{tuple: "doc:readme#viewer@user:alice", want: true},
+		{tuple: "doc:readme#can_delete@user:alice", want: true},
+		{tuple: "doc:readme#editor@user:bob", want: true},
+		{tuple: "doc:readme#viewer@user:bob", want: true},
+		{tuple: "doc:readme#owner@user:bob", want: false},
+		{tuple: "doc:readme#can_delete@user:bob", want: false},
+		{tuple: "doc:readme#viewer@user:carol", want: true},
+		{tuple: "doc:readme#editor@user:carol", want: false},
+		{tuple: "doc:plan#viewer@user:carol", want: true},
+		{tuple: "doc:notes#viewer@user:carol", want: false},
+		{tuple: "doc:notes#viewer@user:dave", want: true},
+		{tuple: "doc:notes#viewer@user:erin", want: true},
+		{tuple: "doc:readme#viewer@group:eng#member", want: true},
+		{tuple: "doc:readme#viewer@folder:shared#viewer", want: true},
+		{tuple: "doc:readme#viewer@doc:readme#owner", want: true},
+		{tuple: "doc:notes#viewer@group:eng#member", want: false},
+		{tuple: "group:a#member@user:frank", want: true},
+		{tuple: "group:a#member@user:zoe", want: false},
+		{tuple: "group:b#member@group:a#member", want: true},
+	}
+
+	for _, tt := range tests {
+		tuple := parseTestTuples(t, []string{tt.tuple})[0]
+
+		got, err := uc.Check(context.Background(), tuple)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.tuple, err)
+		}
+
+		if got != tt.want {
+			t.Errorf("Check(%s) = %v, want %v", tt.tuple, got, tt.want)
+		}
+	}
+}
+
+func TestRelationCheckErrors(t *testing.T) {
+	uc := newTestRelationUsecase(t, groupChain(maxRelationDepth+1))
+
+	tests := []struct {
+		tuple string
+		err   error
+	}{
+		{tuple: "project:x#member@user:alice", err: domain.ErrUnknownNamespace},
+		{tuple: "doc:readme#reader@user:alice", err: domain.ErrUnknownRelation},
+		{tuple: "group:g0#member@user:zoe", err: domain.ErrRelationDepth},
+	}
+
+	for _, tt := range tests {
+		tuple := parseTestTuples(t, []string{tt.tuple})[0]
+
+		if _, err := uc.Check(context.Background(), tuple); !errors.Is(err, tt.err) {
+			t.Errorf("Check(%s) = %v, want %v", tt.tuple, err, tt.err)
+		}
+	}
+
+	// the depth is counted along one path only
+	ok, err := uc.Check(context.Background(), parseTestTuples(t, []string{"group:g5#member@user:zoe"})[0])
+	if err != nil || !ok {
+		t.Errorf("Check(group:g5#member@user:zoe) = %v, %v, want true", ok, err)
+	}
+}
+
+func TestRelationWriteTuples(t *testing.T) {
+	uc := newTestRelationUsecase(t, nil)
+
+	tests := []struct {
+		tuple string
+		err   error
+	}{
+		{tuple: "doc:readme#viewer@user:alice", err: nil},
+		{tuple: "doc:readme#viewer@group:eng#member", err: nil},
+		{tuple: "doc:readme#can_delete@user:alice", err: domain.ErrInvalidTuple},
+		{tuple: "doc:readme#reader@user:alice", err: domain.ErrUnknownRelation},
+		{tuple: "project:x#member@user:alice", err: domain.ErrUnknownNamespace},
+		{tuple: "doc:readme#viewer@robot:r2", err: domain.ErrUnknownNamespace},
+		{tuple: "doc:readme#viewer@group:eng#admin", err: domain.ErrUnknownRelation},
+	}
+
+	for _, tt := range tests {
+		err := uc.WriteTuples(context.Background(), parseTestTuples(t, []string{tt.tuple}), nil)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("WriteTuples(%s) = %v, want %v", tt.tuple, err, tt.err)
+		}
+	}
+
+	// deleting takes access away
+	tuples := parseTestTuples(t, []string{"doc:readme#viewer@user:alice"})
+
+	if err := uc.WriteTuples(context.Background(), nil, tuples); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := uc.Check(context.Background(), tuples[0]); err != nil || ok {
+		t.Errorf("Check(%s) after deleting it = %v, %v, want false", tuples[0], ok, err)
+	}
+}
+
+// treeString writes tree on one line, children in brackets.
+func treeString(tree *domain.SubjectTree) string {
+	parts := []string{}
+	for _, v := range tree.Subjects {
+		parts = append(parts, v.String())
+	}
+
+	for _, v := range tree.Children {
+		parts = append(parts, treeString(v))
+	}
+
+	if len(parts) == 0 {
+		return tree.Userset.String()
+	}
+
+	return tree.Userset.String() + "[" + strings.Join(parts, " ") + "]"
+}
+
+func TestRelationExpand(t *testing.T) {
+	uc := newTestRelationUsecase(t, testTuples)
+
+	tests := []struct {
+		userset string
+		want    string
+	}{
+		{
+			userset: "doc:readme#editor",
+			want:    "doc:readme#editor[group:eng#member[user:bob] doc:readme#owner[user:alice]]",
+		},
+		{
+			userset: "doc:readme#viewer",
+			want: "doc:readme#viewer[" +
+				"doc:readme#editor[group:eng#member[user:bob] doc:readme#owner[user:alice]] " +
+				"folder:shared#viewer[user:carol folder:shared#owner]]",
+		},
+		{
+			userset: "doc:notes#viewer",
+			want:    "doc:notes#viewer[user:dave doc:notes#editor[doc:notes#owner] folder:private#viewer[folder:private#owner[user:erin]]]",
+		},
+		// the cycle ends with group:a left unexpanded
+		{
+			userset: "group:a#member",
+			want:    "group:a#member[group:b#member[user:frank group:a#member]]",
+		},
+	}
+
+	for _, tt := range tests {
+		subject, err := domain.ParseSubject(tt.userset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tree, err := uc.Expand(context.Background(), subject.Object, subject.Relation)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.userset, err)
+		}
+
+		if got := treeString(tree); got != tt.want {
+			t.Errorf("Expand(%s) = %s, want %s", tt.userset, got, tt.want)
+		}
+	}
+
+	chain := newTestRelationUsecase(t, groupChain(maxRelationDepth+1))
+	if _, err := chain.Expand(context.Background(), domain.Object{Namespace: "group", ID: "g0"}, "member"); !errors.Is(err, domain.ErrRelationDepth) {
+		t.Errorf("Expand(group:g0#member) = %v, want %v", err, domain.ErrRelationDepth)
+	}
+}
+
+func TestRelationListObjects(t *testing.T) {
+	uc := newTestRelationUsecase(t, testTuples)
+
+	tests := []struct {
+		namespace string
+		relation  string
+		subject   string
+		want      []string
+	}{
+		{namespace: "doc", relation: "viewer", subject: "user:alice", want: []string{"doc:readme"}},
+		{namespace: "doc", relation: "viewer", subject: "user:bob", want: []string{"doc:readme"}},
+		{namespace: "doc", relation: "viewer", subject: "user:carol", want: []string{"doc:plan", "doc:readme"}},
+		{namespace: "doc", relation: "viewer", subject: "user:erin", want: []string{"doc:notes"}},
+		{namespace: "doc", relation: "editor", subject: "user:carol", want: []string{}},
+		{namespace: "doc", relation: "can_delete", subject: "user:alice", want: []string{"doc:readme"}},
+		{namespace: "doc", relation: "viewer", subject: "group:eng#member", want: []string{"doc:readme"}},
+		{namespace: "doc", relation: "viewer", subject: "folder:shared#viewer", want: []string{"doc:plan", "doc:readme"}},
+		{namespace: "folder", relation: "viewer", subject: "user:erin", want: []string{"folder:private"}},
+		{namespace: "group", relation: "member", subject: "user:frank", want: []string{"group:a", "group:b"}},
+		{namespace: "group", relation: "member", subject: "group:a#member", want: []string{"group:a", "group:b"}},
+		{namespace: "doc", relation: "viewer", subject: "user:nobody", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		subject, err := domain.ParseSubject(tt.subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		objects, err := uc.ListObjects(context.Background(), tt.namespace, tt.relation, subject)
+		if err != nil {
+			t.Fatalf("%s#%s@%s: %v", tt.namespace, tt.relation, tt.subject, err)
+		}
+
+		got := make([]string, len(objects))
+		for i, v := range objects {
+			got[i] = v.String()
+		}
+
+		sort.Strings(got)
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListObjects(%s#%s@%s) = %v, want %v", tt.namespace, tt.relation, tt.subject, got, tt.want)
+		}
+	}
+
+	if _, err := uc.ListObjects(context.Background(), "doc", "reader", domain.Subject{}); !errors.Is(err, domain.ErrUnknownRelation) {
+		t.Errorf("ListObjects(doc#reader) = %v, want %v", err, domain.ErrUnknownRelation)
+	}
+}
+
+func TestRelationListObjectsAgreesWithCheck(t *testing.T) {
+	uc := newTestRelationUsecase(t, testTuples)
+	ctx := context.Background()
+
+	objects := map[string][]string{
+		"doc":    {"readme", "notes", "plan"},
+		"folder": {"shared", "private"},
+		"group":  {"eng", "a", "b"},
+	}
+	relations := map[string][]string{
+		"doc":    {"parent", "owner", "editor", "viewer", "can_delete"},
+		"folder": {"owner", "viewer"},
+		"group":  {"member"},
+	}
+	subjects := []string{
+		"user:alice", "user:bob", "user:carol", "user:dave", "user:erin", "user:frank",
+		"group:eng#member", "group:a#member", "folder:shared#viewer", "doc:readme#owner",
+	}
+
+	for namespace, names := range relations {
+		for _, relation := range names {
+			for _, s := range subjects {
+				subject, err := domain.ParseSubject(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				listed, err := uc.ListObjects(ctx, namespace, relation, subject)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				found := map[string]bool{}
+				for _, v := range listed {
+					found[v.ID] = true
+				}
+
+				for _, id := range objects[namespace] {
+					object := domain.Object{Namespace: namespace, ID: id}
+
+					ok, err := uc.Check(ctx, domain.RelationTuple{Object: object, Relation: relation, Subject: subject})
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if ok != found[id] {
+						t.Errorf("%s#%s@%s: Check = %v but listed = %v", object, relation, s, ok, found[id])
+					}
+				}
+			}
+		}
+	}
+}
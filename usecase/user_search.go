@@ -0,0 +1,129 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/adetxt/user/domain"
+	"gorm.io/gorm"
+)
+
+// reindexPageSize is how many users ReindexUsers loads at a time.
+const reindexPageSize = 500
+
+// indexUsers brings the search index up to date with the users ids,
+// removing those which are gone. The change is made already and searches
+// are checked against the database, so failures are only logged.
+func indexUsers(ctx context.Context, userRepo domain.UserRepository, searcher domain.UserSearcher, ids ...int64) {
+	// the index holds the users of every organization
+	ctx = domain.WithTenant(ctx, 0)
+
+	users := []*domain.User{}
+	removed := []int64{}
+
+	for _, id := range ids {
+		user, err := userRepo.GetUserByIdentifier(ctx, "id", id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			removed = append(removed, id)
+			continue
+		}
+
+		if err != nil {
+			log.Println(err.Error())
+			return
+		}
+
+		users = append(users, user)
+	}
+
+	if len(users) > 0 {
+		if err := loadOrganizations(ctx, userRepo, users); err != nil {
+			log.Println(err.Error())
+			return
+		}
+
+		if err := searcher.Index(ctx, users); err != nil {
+			log.Println(err.Error())
+		}
+	}
+
+	if len(removed) > 0 {
+		if err := searcher.Remove(ctx, removed); err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
+
+// ReindexUsers indexes every user not deleted. Users removed while the
+// index was not kept up to date stay in it, which is harmless as searches
+// are checked against the database.
+func (uc *userUsecase) ReindexUsers(ctx context.Context) error {
+	return uc.forIndexedUsers(ctx, "", func(users []*domain.User) error {
+		return uc.searcher.Index(ctx, users)
+	})
+}
+
+// forIndexedUsers calls fn with the users of every organization matching
+// filter a page at a time, loading the fields which are indexed.
+func (uc *userUsecase) forIndexedUsers(ctx context.Context, filter string, fn func(users []*domain.User) error) error {
+	ctx = domain.WithTenant(ctx, 0)
+	params := &domain.GetUsersParams{
+		PageSize: reindexPageSize,
+		Filter:   filter,
+		Fields:   []string{"name", "email", "attributes"},
+	}
+
+	for {
+		users, pagination, err := uc.userRepo.GetUsers(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		if len(users) > 0 {
+			if err := loadOrganizations(ctx, uc.userRepo, users); err != nil {
+				return err
+			}
+
+			if err := fn(users); err != nil {
+				return err
+			}
+		}
+
+		if pagination.NextCursor == nil {
+			return nil
+		}
+
+		params.Cursor = pagination.NextCursor
+	}
+}
+
+// loadOrganizations sets the OrgIDs of users, which searches are scoped
+// by.
+func loadOrganizations(ctx context.Context, userRepo domain.UserRepository, users []*domain.User) error {
+	ids := make([]int64, len(users))
+	for i, v := range users {
+		ids[i] = v.ID
+	}
+
+	orgs, err := userRepo.GetUserOrganizations(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range users {
+		v.OrgIDs = orgs[v.ID]
+	}
+
+	return nil
+}
+
+// searchUsers finds the users matching keyword for GetUsers.
+func (uc *userUsecase) searchUsers(ctx context.Context, keyword string) ([]int64, error) {
+	terms, err := domain.ParseSearchQuery(keyword)
+	if err != nil {
+		return nil, err
+	}
+
+	return uc.searcher.Search(ctx, terms, uc.cfg.MaxSearchHits)
+}
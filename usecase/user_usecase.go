@@ -2,24 +2,125 @@ package usecase
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/adetxt/user/config"
 	"github.com/adetxt/user/domain"
+	"github.com/adetxt/user/utils/auth"
+	"github.com/adetxt/user/utils/cache"
+	"github.com/adetxt/user/utils/pagetoken"
 	"github.com/adetxt/user/utils/password"
+	"github.com/adetxt/user/utils/permission"
+	"github.com/adetxt/user/utils/policy"
 )
 
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
 type userUsecase struct {
+	cfg      config.Config
 	userRepo domain.UserRepository
+	mailer   domain.Mailer
+	searcher domain.UserSearcher
+	grants   *cache.TTL[grantsKey, []domain.Grant]
+	policies *cache.TTL[string, string]
+	statuses *cache.TTL[int64, *domain.User]
+	engine   *policy.Engine
+	// pageKey signs page tokens, see pagetoken.DeriveKey.
+	pageKey []byte
 }
 
-func NewUserUsecase(userRepo domain.UserRepository) domain.UserUsecase {
-	return &userUsecase{
+func NewUserUsecase(cfg config.Config, userRepo domain.UserRepository, mailer domain.Mailer, searcher domain.UserSearcher) domain.UserUsecase {
+	uc := &userUsecase{
+		cfg:      cfg,
 		userRepo: userRepo,
+		mailer:   mailer,
+		searcher: searcher,
+		engine:   policy.NewEngine(),
+	}
+
+	secret := cfg.PageTokenKey
+	if secret == "" {
+		secret = cfg.JWTKey
+	}
+
+	uc.pageKey = pagetoken.DeriveKey([]byte(secret))
+
+	if cfg.AuthzCacheTTL > 0 {
+		uc.grants = cache.NewTTL[grantsKey, []domain.Grant](cfg.AuthzCacheTTL)
+		uc.policies = cache.NewTTL[string, string](cfg.AuthzCacheTTL)
+		uc.statuses = cache.NewTTL[int64, *domain.User](cfg.AuthzCacheTTL)
 	}
+
+	return uc
 }
 
 func (uc *userUsecase) GetUsers(ctx context.Context, params *domain.GetUsersParams) ([]*domain.User, *domain.PaginationInfo, error) {
-	return uc.userRepo.GetUsers(ctx, params)
+	if params.OrgID != 0 {
+		if err := checkTenant(ctx, params.OrgID); err != nil {
+			return nil, nil, err
+		}
+
+		ctx = domain.WithTenant(ctx, params.OrgID)
+	}
+
+	if len(params.Attributes) > 0 {
+		definitions, err := uc.attributeDefinitions(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for name := range params.Attributes {
+			if definitions[name] == nil {
+				return nil, nil, fmt.Errorf("%w: %s is not defined", domain.ErrInvalidAttribute, name)
+			}
+		}
+	}
+
+	query, err := usersQuery(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if params.PageToken != "" {
+		token := usersPageToken{}
+		if err := pagetoken.Decode(uc.pageKey, params.PageToken, &token); err != nil || token.Query != query {
+			return nil, nil, domain.ErrInvalidPageToken
+		}
+
+		params.Cursor = token.Cursor
+	}
+
+	if params.Keyword != "" {
+		if params.SearchIDs, err = uc.searchUsers(ctx, params.Keyword); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	users, pagination, err := uc.userRepo.GetUsers(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if pagination.NextCursor != nil {
+		pagination.NextPageToken, err = pagetoken.Encode(uc.pageKey, usersPageToken{
+			Query:  query,
+			Cursor: pagination.NextCursor,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return users, pagination, nil
 }
 
 func (uc *userUsecase) GetUserByIdentifier(ctx context.Context, identifier string, value interface{}) (*domain.User, error) {
@@ -27,6 +128,10 @@ func (uc *userUsecase) GetUserByIdentifier(ctx context.Context, identifier strin
 }
 
 func (uc *userUsecase) CreateUser(ctx context.Context, data *domain.User) (int64, error) {
+	if err := uc.checkAttributes(ctx, 0, data.Attributes); err != nil {
+		return 0, err
+	}
+
 	hashed, err := password.HashPassword(data.Password)
 	if err != nil {
 		return 0, err
@@ -34,7 +139,14 @@ func (uc *userUsecase) CreateUser(ctx context.Context, data *domain.User) (int64
 
 	data.Password = hashed
 
-	return uc.userRepo.CreateUser(ctx, data)
+	id, err := uc.userRepo.CreateUser(ctx, data)
+	if err != nil {
+		return 0, err
+	}
+
+	indexUsers(ctx, uc.userRepo, uc.searcher, id)
+
+	return id, nil
 }
 
 func (uc *userUsecase) UpdateUser(ctx context.Context, data *domain.User) error {
@@ -47,35 +159,1418 @@ func (uc *userUsecase) UpdateUser(ctx context.Context, data *domain.User) error
 		data.Password = hashed
 	}
 
-	return uc.userRepo.UpdateUser(ctx, data)
+	// attributes are changed rather than replaced, so the result is
+	// validated as a whole
+	if len(data.Roles) > 0 || data.Attributes != nil {
+		current, err := uc.userRepo.GetUserByIdentifier(ctx, "id", data.ID)
+		if err != nil {
+			return err
+		}
+
+		if len(data.Roles) > 0 {
+			if err := uc.checkRoleAssignment(ctx, symmetricDifference(current.Roles, data.Roles)); err != nil {
+				return err
+			}
+		}
+
+		if data.Attributes != nil {
+			data.Attributes = mergeAttributes(current.Attributes, data.Attributes)
+
+			if err := uc.checkAttributes(ctx, data.ID, data.Attributes); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := uc.userRepo.UpdateUser(ctx, data); err != nil {
+		return err
+	}
+
+	uc.invalidateGrants(ctx, data.ID)
+	indexUsers(ctx, uc.userRepo, uc.searcher, data.ID)
+
+	return nil
 }
 
 func (uc *userUsecase) DeleteUser(ctx context.Context, id int64) error {
-	return uc.userRepo.DeleteUser(ctx, id)
+	if err := uc.userRepo.DeleteUser(ctx, id); err != nil {
+		return err
+	}
+
+	// the user may have grants cached in any organization
+	uc.invalidateGrants(ctx, 0)
+
+	if uc.statuses != nil {
+		uc.statuses.Delete(id)
+	}
+
+	indexUsers(ctx, uc.userRepo, uc.searcher, id)
+
+	return nil
+}
+
+func (uc *userUsecase) RestoreUser(ctx context.Context, id int64) error {
+	if err := uc.userRepo.RestoreUser(ctx, id); err != nil {
+		return err
+	}
+
+	indexUsers(ctx, uc.userRepo, uc.searcher, id)
+
+	return nil
+}
+
+func (uc *userUsecase) PurgeDeletedUsers(ctx context.Context) error {
+	if uc.cfg.DeletedUserRetentionDays <= 0 {
+		return nil
+	}
+
+	before := time.Now().AddDate(0, 0, -uc.cfg.DeletedUserRetentionDays)
+
+	ids, err := uc.userRepo.PurgeDeletedUsers(ctx, before)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	return uc.searcher.Remove(ctx, ids)
+}
+
+func (uc *userUsecase) AssignRoles(ctx context.Context, userID int64, roles []string) error {
+	if err := uc.checkRoleAssignment(ctx, roles); err != nil {
+		return err
+	}
+
+	callerID, _ := strconv.ParseInt(domain.GetClaims(ctx).ID, 10, 64)
+
+	if err := uc.userRepo.AssignRoles(ctx, userID, roles, domain.RoleGrant{
+		GrantedBy: callerID,
+	}); err != nil {
+		return err
+	}
+
+	uc.invalidateGrants(ctx, userID)
+
+	return nil
+}
+
+func (uc *userUsecase) RevokeRoles(ctx context.Context, userID int64, roles []string) error {
+	if err := uc.checkRoleAssignment(ctx, roles); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.RevokeRoles(ctx, userID, roles); err != nil {
+		return err
+	}
+
+	uc.invalidateGrants(ctx, userID)
+
+	return nil
 }
 
 func (uc *userUsecase) GetRoles(ctx context.Context) ([]*domain.Role, error) {
 	return uc.userRepo.GetRoles(ctx)
 }
 
-func (uc *userUsecase) Granted(ctx context.Context, userID int64, permissions []string) error {
-	user, err := uc.GetUserByIdentifier(ctx, "id", userID)
-	if err != nil {
+func (uc *userUsecase) CreateRole(ctx context.Context, data *domain.Role) (int64, error) {
+	if err := checkPlatform(ctx); err != nil {
+		return 0, err
+	}
+
+	if !roleNamePattern.MatchString(data.Name) {
+		return 0, domain.ErrInvalidRoleName
+	}
+
+	if err := validatePermissionNames(data.Permissions); err != nil {
+		return 0, err
+	}
+
+	if err := uc.checkRoleGrants(ctx, data.Parents, grantedPermissions(data.Permissions, false)); err != nil {
+		return 0, err
+	}
+
+	return uc.userRepo.CreateRole(ctx, data)
+}
+
+func (uc *userUsecase) UpdateRole(ctx context.Context, data *domain.Role) error {
+	if err := checkPlatform(ctx); err != nil {
 		return err
 	}
 
-	ps, err := uc.userRepo.GetPermissionsByRole(ctx, user.Roles)
-	if err != nil {
+	if !roleNamePattern.MatchString(data.Name) {
+		return domain.ErrInvalidRoleName
+	}
+
+	if err := uc.userRepo.UpdateRole(ctx, data); err != nil {
 		return err
 	}
 
-	for _, p := range permissions {
-		for _, v := range ps {
-			if p == v {
-				return nil
-			}
+	uc.invalidateGrants(ctx, 0)
+
+	return nil
+}
+
+func (uc *userUsecase) DeleteRole(ctx context.Context, id int64) error {
+	if err := checkPlatform(ctx); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.DeleteRole(ctx, id); err != nil {
+		return err
+	}
+
+	uc.invalidateGrants(ctx, 0)
+
+	return nil
+}
+
+func (uc *userUsecase) ListPermissions(ctx context.Context) ([]*domain.Permission, error) {
+	return uc.userRepo.ListPermissions(ctx)
+}
+
+func (uc *userUsecase) CreatePermission(ctx context.Context, name string) (int64, error) {
+	if err := checkPlatform(ctx); err != nil {
+		return 0, err
+	}
+
+	if !permission.Valid(name) {
+		return 0, fmt.Errorf("%w: %s", domain.ErrInvalidPermissionName, name)
+	}
+
+	return uc.userRepo.CreatePermission(ctx, name)
+}
+
+func (uc *userUsecase) SetRoleParents(ctx context.Context, roleID int64, parents []string) error {
+	if err := checkPlatform(ctx); err != nil {
+		return err
+	}
+
+	if err := uc.checkRoleGrants(ctx, parents, nil); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.SetRoleParents(ctx, roleID, parents); err != nil {
+		return err
+	}
+
+	uc.invalidateGrants(ctx, 0)
+
+	return nil
+}
+
+func (uc *userUsecase) AttachPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	if err := checkPlatform(ctx); err != nil {
+		return err
+	}
+
+	if err := validatePermissionNames(permissions); err != nil {
+		return err
+	}
+
+	if err := uc.checkRoleGrants(ctx, nil, grantedPermissions(permissions, false)); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.AttachPermissions(ctx, roleID, permissions); err != nil {
+		return err
+	}
+
+	uc.invalidateGrants(ctx, 0)
+
+	return nil
+}
+
+func (uc *userUsecase) DetachPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	if err := checkPlatform(ctx); err != nil {
+		return err
+	}
+
+	if err := validatePermissionNames(permissions); err != nil {
+		return err
+	}
+
+	// detaching a deny grant hands out what it denied
+	if err := uc.checkRoleGrants(ctx, nil, grantedPermissions(permissions, true)); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.DetachPermissions(ctx, roleID, permissions); err != nil {
+		return err
+	}
+
+	uc.invalidateGrants(ctx, 0)
+
+	return nil
+}
+
+func (uc *userUsecase) ListPolicies(ctx context.Context) ([]*domain.Policy, error) {
+	return uc.userRepo.ListPolicies(ctx)
+}
+
+func (uc *userUsecase) CreatePolicy(ctx context.Context, data *domain.Policy) (int64, error) {
+	if err := checkPlatform(ctx); err != nil {
+		return 0, err
+	}
+
+	if !roleNamePattern.MatchString(data.Name) {
+		return 0, fmt.Errorf("%w: invalid name %s", domain.ErrInvalidPolicy, data.Name)
+	}
+
+	if err := uc.engine.Compile(data.Expression); err != nil {
+		return 0, fmt.Errorf("%w: %v", domain.ErrInvalidPolicy, err)
+	}
+
+	return uc.userRepo.CreatePolicy(ctx, data)
+}
+
+func (uc *userUsecase) UpdatePolicy(ctx context.Context, data *domain.Policy) error {
+	if err := checkPlatform(ctx); err != nil {
+		return err
+	}
+
+	if data.Expression != "" {
+		if err := uc.engine.Compile(data.Expression); err != nil {
+			return fmt.Errorf("%w: %v", domain.ErrInvalidPolicy, err)
+		}
+	}
+
+	if err := uc.userRepo.UpdatePolicy(ctx, data); err != nil {
+		return err
+	}
+
+	if uc.policies != nil {
+		uc.policies.Purge()
+	}
+
+	return nil
+}
+
+func (uc *userUsecase) DeletePolicy(ctx context.Context, id int64) error {
+	if err := checkPlatform(ctx); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.DeletePolicy(ctx, id); err != nil {
+		return err
+	}
+
+	// a policy created again under the name must not evaluate this one
+	if uc.policies != nil {
+		uc.policies.Purge()
+	}
+
+	return nil
+}
+
+func (uc *userUsecase) ListRoleConstraints(ctx context.Context) ([]*domain.RoleConstraint, error) {
+	return uc.userRepo.ListRoleConstraints(ctx)
+}
+
+func (uc *userUsecase) CreateRoleConstraint(ctx context.Context, data *domain.RoleConstraint) (int64, error) {
+	if err := checkPlatform(ctx); err != nil {
+		return 0, err
+	}
+
+	if !roleNamePattern.MatchString(data.Name) || len(uniqueStrings(data.Roles)) < 2 {
+		return 0, domain.ErrInvalidConstraint
+	}
+
+	return uc.userRepo.CreateRoleConstraint(ctx, data)
+}
+
+func (uc *userUsecase) DeleteRoleConstraint(ctx context.Context, id int64) error {
+	if err := checkPlatform(ctx); err != nil {
+		return err
+	}
+
+	return uc.userRepo.DeleteRoleConstraint(ctx, id)
+}
+
+func (uc *userUsecase) GetConstraintViolations(ctx context.Context) ([]*domain.ConstraintViolation, error) {
+	return uc.userRepo.GetConstraintViolations(ctx)
+}
+
+func (uc *userUsecase) ExportPolicy(ctx context.Context) (*domain.PolicyDocument, error) {
+	return uc.userRepo.ExportPolicy(ctx)
+}
+
+func (uc *userUsecase) ApplyPolicy(ctx context.Context, doc *domain.PolicyDocument, prune, dryRun bool) ([]domain.PolicyChange, error) {
+	if err := checkPlatform(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := uc.validatePolicyDocument(doc); err != nil {
+		return nil, err
+	}
+
+	changes, err := uc.userRepo.ApplyPolicy(ctx, doc, prune, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun && len(changes) > 0 {
+		uc.invalidateGrants(ctx, 0)
+
+		if uc.policies != nil {
+			uc.policies.Purge()
+		}
+	}
+
+	return changes, nil
+}
+
+func (uc *userUsecase) RequestElevation(ctx context.Context, data *domain.Elevation) (int64, error) {
+	callerID, err := strconv.ParseInt(domain.GetClaims(ctx).ID, 10, 64)
+	if err != nil {
+		return 0, domain.ErrNotGranted
+	}
+
+	if data.Duration <= 0 || data.Duration > uc.cfg.MaxElevation {
+		return 0, domain.ErrInvalidElevation
+	}
+
+	data.UserID = callerID
+
+	return uc.userRepo.CreateElevation(ctx, data)
+}
+
+func (uc *userUsecase) ListElevations(ctx context.Context) ([]*domain.Elevation, error) {
+	return uc.userRepo.ListElevations(ctx, domain.ElevationPending)
+}
+
+// ApproveElevation grants a pending elevation. The approver must be someone
+// else holding the requested role, so elevation cannot escalate either.
+func (uc *userUsecase) ApproveElevation(ctx context.Context, id int64) error {
+	callerID, err := strconv.ParseInt(domain.GetClaims(ctx).ID, 10, 64)
+	if err != nil {
+		return domain.ErrNotGranted
+	}
+
+	elevation, err := uc.userRepo.GetElevation(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if elevation.Status != domain.ElevationPending {
+		return domain.ErrElevationNotPending
+	}
+
+	if elevation.UserID == callerID {
+		return domain.ErrSelfApproval
+	}
+
+	if err := uc.checkRolesHeld(ctx, callerID, []string{elevation.Role}); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.ApproveElevation(ctx, id, callerID); err != nil {
+		return err
+	}
+
+	uc.invalidateGrants(domain.WithTenant(ctx, elevation.OrgID), elevation.UserID)
+
+	return nil
+}
+
+func (uc *userUsecase) SweepExpiredRoles(ctx context.Context) error {
+	userIDs, err := uc.userRepo.DeleteExpiredRoles(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// expired roles may belong to any organization
+	if len(userIDs) > 0 {
+		uc.invalidateGrants(ctx, 0)
+	}
+
+	return nil
+}
+
+func (uc *userUsecase) ListOrganizations(ctx context.Context) ([]*domain.Organization, error) {
+	return uc.userRepo.ListOrganizations(ctx)
+}
+
+func (uc *userUsecase) CreateOrganization(ctx context.Context, data *domain.Organization) (int64, error) {
+	if err := checkPlatform(ctx); err != nil {
+		return 0, err
+	}
+
+	if !roleNamePattern.MatchString(data.Name) {
+		return 0, domain.ErrInvalidOrganization
+	}
+
+	return uc.userRepo.CreateOrganization(ctx, data)
+}
+
+// AddMember adds userID to orgID with roles there, which the caller must
+// hold like for any role assignment.
+func (uc *userUsecase) AddMember(ctx context.Context, orgID, userID int64, roles []string) error {
+	if err := checkTenant(ctx, orgID); err != nil {
+		return err
+	}
+
+	if err := uc.checkRoleAssignment(ctx, roles); err != nil {
+		return err
+	}
+
+	callerID, _ := strconv.ParseInt(domain.GetClaims(ctx).ID, 10, 64)
+
+	if err := uc.userRepo.AddMember(ctx, orgID, userID, roles, domain.RoleGrant{
+		GrantedBy: callerID,
+	}); err != nil {
+		return err
+	}
+
+	uc.invalidateGrants(domain.WithTenant(ctx, orgID), userID)
+	indexUsers(ctx, uc.userRepo, uc.searcher, userID)
+
+	return nil
+}
+
+func (uc *userUsecase) RemoveMember(ctx context.Context, orgID, userID int64) error {
+	if err := checkTenant(ctx, orgID); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.RemoveMember(ctx, orgID, userID); err != nil {
+		return err
+	}
+
+	uc.invalidateGrants(domain.WithTenant(ctx, orgID), userID)
+	indexUsers(ctx, uc.userRepo, uc.searcher, userID)
+
+	return nil
+}
+
+func (uc *userUsecase) ListGroups(ctx context.Context) ([]*domain.Group, error) {
+	return uc.userRepo.ListGroups(ctx)
+}
+
+func (uc *userUsecase) CreateGroup(ctx context.Context, data *domain.Group) (int64, error) {
+	if !roleNamePattern.MatchString(data.Name) {
+		return 0, domain.ErrInvalidGroupName
+	}
+
+	return uc.userRepo.CreateGroup(ctx, data)
+}
+
+func (uc *userUsecase) DeleteGroup(ctx context.Context, id int64) error {
+	if err := uc.userRepo.DeleteGroup(ctx, id); err != nil {
+		return err
+	}
+
+	uc.invalidateGrants(ctx, 0)
+
+	return nil
+}
+
+func (uc *userUsecase) GetGroupMembers(ctx context.Context, groupID int64) ([]*domain.User, error) {
+	return uc.userRepo.GetGroupMembers(ctx, groupID)
+}
+
+// AddGroupMembers hands the roles of the group to userIDs, so the caller
+// must be allowed to assign every one of them.
+func (uc *userUsecase) AddGroupMembers(ctx context.Context, groupID int64, userIDs []int64) error {
+	group, err := uc.userRepo.GetGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	if err := uc.checkRoleAssignment(ctx, group.Roles); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.AddGroupMembers(ctx, groupID, userIDs); err != nil {
+		return err
+	}
+
+	for _, v := range userIDs {
+		uc.invalidateGrants(ctx, v)
+	}
+
+	return nil
+}
+
+func (uc *userUsecase) RemoveGroupMembers(ctx context.Context, groupID int64, userIDs []int64) error {
+	group, err := uc.userRepo.GetGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	if err := uc.checkRoleAssignment(ctx, group.Roles); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.RemoveGroupMembers(ctx, groupID, userIDs); err != nil {
+		return err
+	}
+
+	for _, v := range userIDs {
+		uc.invalidateGrants(ctx, v)
+	}
+
+	return nil
+}
+
+func (uc *userUsecase) AssignGroupRoles(ctx context.Context, groupID int64, roles []string) error {
+	if err := uc.checkRoleAssignment(ctx, roles); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.AssignGroupRoles(ctx, groupID, roles); err != nil {
+		return err
+	}
+
+	uc.invalidateGrants(ctx, 0)
+
+	return nil
+}
+
+func (uc *userUsecase) RevokeGroupRoles(ctx context.Context, groupID int64, roles []string) error {
+	if err := uc.checkRoleAssignment(ctx, roles); err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.RevokeGroupRoles(ctx, groupID, roles); err != nil {
+		return err
+	}
+
+	uc.invalidateGrants(ctx, 0)
+
+	return nil
+}
+
+func (uc *userUsecase) SuspendUser(ctx context.Context, id int64, reason string, until *time.Time) error {
+	return uc.changeStatus(ctx, id, &domain.StatusChange{
+		Status: domain.UserSuspended,
+		Reason: reason,
+		Until:  until,
+	})
+}
+
+func (uc *userUsecase) ReactivateUser(ctx context.Context, id int64, reason string) error {
+	return uc.changeStatus(ctx, id, &domain.StatusChange{
+		Status: domain.UserActive,
+		Reason: reason,
+	})
+}
+
+func (uc *userUsecase) DeactivateUser(ctx context.Context, id int64, reason string) error {
+	return uc.changeStatus(ctx, id, &domain.StatusChange{
+		Status: domain.UserDeactivated,
+		Reason: reason,
+	})
+}
+
+// changeStatus applies change if the current status allows it. The status
+// of a user holds in every organization, so only platform callers may
+// change it.
+func (uc *userUsecase) changeStatus(ctx context.Context, id int64, change *domain.StatusChange) error {
+	if err := checkPlatform(ctx); err != nil {
+		return err
+	}
+
+	callerID, err := strconv.ParseInt(domain.GetClaims(ctx).ID, 10, 64)
+	if err != nil {
+		return domain.ErrNotGranted
+	}
+
+	if callerID == id {
+		return domain.ErrSelfStatusChange
+	}
+
+	user, err := uc.userRepo.GetUserByIdentifier(ctx, "id", id)
+	if err != nil {
+		return err
+	}
+
+	if from := user.EffectiveStatus(time.Now()); !from.CanTransitionTo(change.Status) {
+		return fmt.Errorf("%w: %s to %s", domain.ErrInvalidTransition, from, change.Status)
+	}
+
+	change.ChangedBy = callerID
+
+	if err := uc.userRepo.SetUserStatus(ctx, id, user.Status, change); err != nil {
+		return err
+	}
+
+	if uc.statuses != nil {
+		uc.statuses.Delete(id)
+	}
+
+	return nil
+}
+
+// CheckActive looks the status up in the platform tenant, which holds
+// every user.
+func (uc *userUsecase) CheckActive(ctx context.Context, userID int64) error {
+	var user *domain.User
+
+	if uc.statuses != nil {
+		user, _ = uc.statuses.Get(userID)
+	}
+
+	if user == nil {
+		var err error
+
+		user, err = uc.userRepo.GetUserByIdentifier(domain.WithTenant(ctx, 0), "id", userID)
+		if err != nil {
+			return err
+		}
+
+		if uc.statuses != nil {
+			uc.statuses.Set(userID, user)
+		}
+	}
+
+	if status := user.EffectiveStatus(time.Now()); status != domain.UserActive {
+		return fmt.Errorf("%w: %s", domain.ErrUserNotActive, status)
+	}
+
+	return nil
+}
+
+// InviteUser returns the ID of the invitation. Like AssignRoles, the caller
+// must hold the roles handed to the invitee.
+func (uc *userUsecase) InviteUser(ctx context.Context, email string, roles []string) (int64, error) {
+	if err := uc.checkRoleAssignment(ctx, roles); err != nil {
+		return 0, err
+	}
+
+	callerID, _ := strconv.ParseInt(domain.GetClaims(ctx).ID, 10, 64)
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return 0, err
+	}
+
+	invitation := &domain.Invitation{
+		InvitedBy: callerID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(uc.cfg.InviteTTL),
+	}
+
+	id, err := uc.userRepo.CreateInvitation(ctx, &domain.User{Email: email}, roles, invitation)
+	if err != nil {
+		return 0, err
+	}
+
+	// an invitation which never reached the invitee would hold the email,
+	// so it is revoked and may be made again
+	if err := uc.sendInvitation(ctx, email, token, invitation.ExpiresAt); err != nil {
+		if revokeErr := uc.userRepo.RevokeInvitation(ctx, id); revokeErr != nil {
+			return 0, fmt.Errorf("%w (revoking the invitation failed: %v)", err, revokeErr)
+		}
+
+		return 0, err
+	}
+
+	if created, err := uc.userRepo.GetInvitation(ctx, id); err == nil {
+		indexUsers(ctx, uc.userRepo, uc.searcher, created.UserID)
+	}
+
+	return id, nil
+}
+
+func (uc *userUsecase) ListInvitations(ctx context.Context) ([]*domain.Invitation, error) {
+	return uc.userRepo.ListInvitations(ctx)
+}
+
+// ResendInvitation mails a new link, which also restarts the expiry. The
+// previous link stops working.
+func (uc *userUsecase) ResendInvitation(ctx context.Context, id int64) error {
+	invitation, err := uc.userRepo.GetInvitation(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(uc.cfg.InviteTTL)
+
+	if err := uc.userRepo.RenewInvitation(ctx, id, hash, expiresAt); err != nil {
+		return err
+	}
+
+	return uc.sendInvitation(ctx, invitation.Email, token, expiresAt)
+}
+
+func (uc *userUsecase) RevokeInvitation(ctx context.Context, id int64) error {
+	invitation, err := uc.userRepo.GetInvitation(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := uc.userRepo.RevokeInvitation(ctx, id); err != nil {
+		return err
+	}
+
+	indexUsers(ctx, uc.userRepo, uc.searcher, invitation.UserID)
+
+	return nil
+}
+
+func (uc *userUsecase) sendInvitation(ctx context.Context, email, token string, expiresAt time.Time) error {
+	link, err := tokenLink(uc.cfg.InviteURL, token)
+	if err != nil {
+		return err
+	}
+
+	return uc.mailer.Send(ctx, email, "You are invited", fmt.Sprintf(
+		"You have been invited to create an account. Set your name and password at the link below before %s.\n\n%s\n",
+		expiresAt.Format(time.RFC1123), link,
+	))
+}
+
+func (uc *userUsecase) ListAttributeDefinitions(ctx context.Context) ([]*domain.AttributeDefinition, error) {
+	return uc.userRepo.ListAttributeDefinitions(ctx)
+}
+
+func (uc *userUsecase) CreateAttributeDefinition(ctx context.Context, data *domain.AttributeDefinition) (int64, error) {
+	if err := checkPlatform(ctx); err != nil {
+		return 0, err
+	}
+
+	if !roleNamePattern.MatchString(data.Name) {
+		return 0, fmt.Errorf("%w: invalid name %s", domain.ErrInvalidAttributeDefinition, data.Name)
+	}
+
+	if err := data.Validate(); err != nil {
+		return 0, err
+	}
+
+	return uc.userRepo.CreateAttributeDefinition(ctx, data)
+}
+
+// DeleteAttributeDefinition removes the attribute from every user, so the
+// users holding it are indexed again without it.
+func (uc *userUsecase) DeleteAttributeDefinition(ctx context.Context, id int64) error {
+	if err := checkPlatform(ctx); err != nil {
+		return err
+	}
+
+	definitions, err := uc.userRepo.ListAttributeDefinitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	holders := []*domain.User{}
+
+	for _, v := range definitions {
+		if v.ID != id {
+			continue
+		}
+
+		if err := uc.forIndexedUsers(ctx, fmt.Sprintf("attributes.%s:*", v.Name), func(users []*domain.User) error {
+			for _, u := range users {
+				delete(u.Attributes, v.Name)
+			}
+
+			holders = append(holders, users...)
+
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := uc.userRepo.DeleteAttributeDefinition(ctx, id); err != nil {
+		return err
+	}
+
+	if len(holders) > 0 {
+		if err := uc.searcher.Index(ctx, holders); err != nil {
+			log.Println(err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (uc *userUsecase) Granted(ctx context.Context, userID int64, permissions []string) error {
+	decision, err := uc.Authorize(ctx, &domain.AuthorizeParams{
+		UserID:      userID,
+		Permissions: permissions,
+		Mode:        domain.GrantAny,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !decision.Allowed {
+		return &domain.NotGrantedError{Decision: decision}
+	}
+
+	return nil
+}
+
+func (uc *userUsecase) Authorize(ctx context.Context, params *domain.AuthorizeParams) (*domain.Decision, error) {
+	grants, err := uc.getGrants(ctx, params.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the grants whose scope covers the target and whose policy holds
+	// take part
+	names := []string{}
+	applicable := map[string]domain.Grant{}
+	input := &policyInput{}
+	var targetGroups []int64
+	for _, v := range grants {
+		// the groups of the target are only loaded for the grants scoped
+		// to groups
+		if v.Scope.ByGroups() && params.TargetUserID != 0 && targetGroups == nil {
+			if targetGroups, err = uc.userRepo.GetUserGroupIDs(ctx, params.TargetUserID); err != nil {
+				return nil, err
+			}
+		}
+
+		if !v.Scope.Covers(params.UserID, params.TargetUserID, targetGroups) {
+			continue
+		}
+
+		if v.Policy != "" && !uc.policyHolds(ctx, v, params, input) {
+			continue
+		}
+
+		if _, ok := applicable[v.Permission]; !ok {
+			names = append(names, v.Permission)
+			applicable[v.Permission] = v
+		}
+	}
+
+	matcher := permission.NewMatcher(names)
+	decision := &domain.Decision{Mode: params.Mode}
+
+	for _, p := range params.Permissions {
+		name, ok := matcher.Check(p)
+		match := domain.PermissionMatch{
+			Permission: p,
+		}
+
+		if grant, found := applicable[name]; found {
+			match.Grant = grant.String()
+			match.Role = grant.Role
+		}
+
+		if ok {
+			decision.Matched = append(decision.Matched, match)
+			continue
+		}
+
+		if name != "" {
+			decision.Denied = append(decision.Denied, match)
+		}
+
+		decision.Missing = append(decision.Missing, p)
+	}
+
+	if params.Mode == domain.GrantAll {
+		decision.Allowed = len(params.Permissions) > 0 && len(decision.Missing) == 0
+	} else {
+		decision.Allowed = len(decision.Matched) > 0
+	}
+
+	return decision, nil
+}
+
+// policyInput holds the policy variables of one authorization, built on
+// first use since loading the caller and target users costs queries.
+type policyInput struct {
+	input *policy.Input
+	err   error
+}
+
+// policyHolds evaluates the policy of grant. Failures count against the
+// caller: allow grants are dropped while deny grants still apply.
+func (uc *userUsecase) policyHolds(ctx context.Context, grant domain.Grant, params *domain.AuthorizeParams, in *policyInput) bool {
+	failed := permission.IsDeny(grant.Permission)
+
+	expr, err := uc.getPolicy(ctx, grant.Policy)
+	if err != nil {
+		return failed
+	}
+
+	if in.input == nil && in.err == nil {
+		in.input, in.err = uc.buildPolicyInput(ctx, params)
+	}
+
+	if in.err != nil {
+		return failed
+	}
+
+	ok, err := uc.engine.Eval(expr, *in.input)
+	if err != nil {
+		return failed
+	}
+
+	return ok
+}
+
+func (uc *userUsecase) getPolicy(ctx context.Context, name string) (string, error) {
+	if uc.policies != nil {
+		if expr, ok := uc.policies.Get(name); ok {
+			return expr, nil
+		}
+	}
+
+	policies, err := uc.userRepo.GetPoliciesByName(ctx, []string{name})
+	if err != nil {
+		return "", err
+	}
+
+	if len(policies) == 0 {
+		return "", domain.ErrPolicyNotFound
+	}
+
+	if uc.policies != nil {
+		uc.policies.Set(name, policies[0].Expression)
+	}
+
+	return policies[0].Expression, nil
+}
+
+func (uc *userUsecase) buildPolicyInput(ctx context.Context, params *domain.AuthorizeParams) (*policy.Input, error) {
+	caller, err := uc.userRepo.GetUserByIdentifier(ctx, "id", params.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &policy.Input{
+		Caller:  userAttributes(caller),
+		Request: map[string]interface{}{},
+	}
+
+	if params.TargetUserID != 0 {
+		target, err := uc.userRepo.GetUserByIdentifier(ctx, "id", params.TargetUserID)
+		if err != nil {
+			return nil, err
+		}
+
+		input.Target = userAttributes(target)
+	}
+
+	if req := params.Request; req != nil {
+		input.Caller["claims"] = req.Claims
+		input.Request["method"] = req.Method
+		input.Request["metadata"] = req.Metadata
+		input.Request["time"] = req.Time
+	}
+
+	return input, nil
+}
+
+func userAttributes(user *domain.User) map[string]interface{} {
+	groups := user.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+
+	return map[string]interface{}{
+		"id":     user.ID,
+		"name":   user.Name,
+		"email":  user.Email,
+		"roles":  user.AllRoles(),
+		"groups": groups,
+	}
+}
+
+// validatePolicyDocument applies the checks of the single create methods to
+// every entry of doc.
+func (uc *userUsecase) validatePolicyDocument(doc *domain.PolicyDocument) error {
+	if err := doc.Validate(); err != nil {
+		return err
+	}
+
+	for _, v := range doc.Permissions {
+		if !permission.Valid(v) {
+			return fmt.Errorf("%w: %s", domain.ErrInvalidPermissionName, v)
+		}
+	}
+
+	for _, v := range doc.Policies {
+		if !roleNamePattern.MatchString(v.Name) {
+			return fmt.Errorf("%w: invalid name %s", domain.ErrInvalidPolicy, v.Name)
+		}
+
+		if err := uc.engine.Compile(v.Expression); err != nil {
+			return fmt.Errorf("%w: %s: %v", domain.ErrInvalidPolicy, v.Name, err)
+		}
+	}
+
+	for _, v := range doc.Roles {
+		if !roleNamePattern.MatchString(v.Name) {
+			return fmt.Errorf("%w: %s", domain.ErrInvalidRoleName, v.Name)
+		}
+
+		if err := validatePermissionNames(v.Permissions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (uc *userUsecase) attributeDefinitions(ctx context.Context) (map[string]*domain.AttributeDefinition, error) {
+	definitions, err := uc.userRepo.ListAttributeDefinitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*domain.AttributeDefinition, len(definitions))
+	for _, v := range definitions {
+		res[v.Name] = v
+	}
+
+	return res, nil
+}
+
+// checkAttributes validates every custom attribute of user userID, zero for
+// a new user, against the attribute definitions.
+func (uc *userUsecase) checkAttributes(ctx context.Context, userID int64, attributes map[string]interface{}) error {
+	definitions, err := uc.attributeDefinitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range attributes {
+		definition := definitions[name]
+		if definition == nil {
+			return fmt.Errorf("%w: %s is not defined", domain.ErrInvalidAttribute, name)
+		}
+
+		if err := definition.Check(value); err != nil {
+			return err
+		}
+	}
+
+	for _, v := range definitions {
+		value, ok := attributes[v.Name]
+		if !ok {
+			if v.Required {
+				return fmt.Errorf("%w: %s is required", domain.ErrInvalidAttribute, v.Name)
+			}
+
+			continue
+		}
+
+		if !v.Unique {
+			continue
+		}
+
+		taken, err := uc.userRepo.AttributeValueTaken(ctx, v.Name, value, userID)
+		if err != nil {
+			return err
+		}
+
+		if taken {
+			return fmt.Errorf("%w: %s", domain.ErrAttributeInUse, v.Name)
+		}
+	}
+
+	return nil
+}
+
+// checkRoleAssignment makes sure the caller may assign roles and holds every
+// one of them, so nobody can escalate to a role they do not have.
+func (uc *userUsecase) checkRoleAssignment(ctx context.Context, roles []string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	callerID, err := strconv.ParseInt(domain.GetClaims(ctx).ID, 10, 64)
+	if err != nil {
+		return domain.ErrNotGranted
+	}
+
+	if err := uc.Granted(ctx, callerID, []string{"role:assign"}); err != nil {
+		return err
+	}
+
+	return uc.checkRolesHeld(ctx, callerID, roles)
+}
+
+// checkRolesHeld makes sure callerID holds every one of roles, directly or
+// through groups.
+func (uc *userUsecase) checkRolesHeld(ctx context.Context, callerID int64, roles []string) error {
+	caller, err := uc.userRepo.GetUserByIdentifier(ctx, "id", callerID)
+	if err != nil {
+		return err
+	}
+
+	held := map[string]bool{}
+	for _, v := range caller.AllRoles() {
+		held[v] = true
+	}
+
+	for _, v := range roles {
+		if !held[v] {
+			return fmt.Errorf("%w: %s", domain.ErrRoleEscalation, v)
+		}
+	}
+
+	return nil
+}
+
+// checkRoleGrants makes sure the caller holds every one of the parents and
+// permissions a role gains, so editing a role they hold never gives them
+// more than they have.
+func (uc *userUsecase) checkRoleGrants(ctx context.Context, parents, permissions []string) error {
+	if len(parents) == 0 && len(permissions) == 0 {
+		return nil
+	}
+
+	callerID, err := strconv.ParseInt(domain.GetClaims(ctx).ID, 10, 64)
+	if err != nil {
+		return domain.ErrNotGranted
+	}
+
+	if len(parents) > 0 {
+		if err := uc.checkRolesHeld(ctx, callerID, parents); err != nil {
+			return err
+		}
+	}
+
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	// without a target only the global grants of the caller count
+	decision, err := uc.Authorize(ctx, &domain.AuthorizeParams{
+		UserID:      callerID,
+		Permissions: permissions,
+		Mode:        domain.GrantAll,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !decision.Allowed {
+		return fmt.Errorf("%w: %s", domain.ErrPermissionEscalation, strings.Join(decision.Missing, ", "))
+	}
+
+	return nil
+}
+
+// grantedPermissions returns the permissions of the allow grants among
+// names, or of the deny grants when deny is set. names must be valid.
+func grantedPermissions(names []string, deny bool) []string {
+	res := []string{}
+
+	for _, v := range names {
+		grant, _ := domain.ParseGrant(v)
+		if permission.IsDeny(grant.Permission) == deny {
+			res = append(res, strings.TrimPrefix(grant.Permission, "!"))
+		}
+	}
+
+	return res
+}
+
+// getGrants returns the grants of userID in the tenant of ctx, taken from
+// the access token claims when they are embedded for that tenant and still
+// up to date.
+func (uc *userUsecase) getGrants(ctx context.Context, userID int64) ([]domain.Grant, error) {
+	if uc.cfg.JWTEmbedPermissions {
+		claims := domain.GetClaims(ctx)
+
+		if claims.ID == strconv.FormatInt(userID, 10) && claims.OrgID == domain.TenantID(ctx) && claims.PermissionVersion > 0 {
+			version, err := uc.userRepo.GetPermissionVersion(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+
+			if version != claims.PermissionVersion {
+				return nil, domain.ErrPermissionChanged
+			}
+
+			grants := []domain.Grant{}
+			for _, v := range claims.Permissions {
+				if grant, err := domain.ParseGrant(v); err == nil {
+					grants = append(grants, grant)
+				}
+			}
+
+			return grants, nil
+		}
+	}
+
+	key := grantsKey{orgID: domain.TenantID(ctx), userID: userID}
+
+	if uc.grants != nil {
+		if grants, ok := uc.grants.Get(key); ok {
+			return grants, nil
+		}
+	}
+
+	user, err := uc.GetUserByIdentifier(ctx, "id", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := uc.userRepo.GetGrantsByRole(ctx, user.AllRoles())
+	if err != nil {
+		return nil, err
+	}
+
+	if uc.grants != nil {
+		uc.grants.Set(key, grants)
+	}
+
+	return grants, nil
+}
+
+// grantsKey identifies the grants a user holds in an organization.
+type grantsKey struct {
+	orgID, userID int64
+}
+
+// invalidateGrants drops the cached grants of userID in the tenant of ctx,
+// or of every user in every tenant when userID is zero, e.g. after a role
+// changed.
+func (uc *userUsecase) invalidateGrants(ctx context.Context, userID int64) {
+	if uc.grants == nil {
+		return
+	}
+
+	if userID == 0 {
+		uc.grants.Purge()
+		return
+	}
+
+	uc.grants.Delete(grantsKey{orgID: domain.TenantID(ctx), userID: userID})
+}
+
+// checkTenant makes sure a caller scoped to an organization only acts on
+// that organization. Platform callers may act on any.
+func checkTenant(ctx context.Context, orgID int64) error {
+	if tenantID := domain.TenantID(ctx); tenantID != 0 && tenantID != orgID {
+		return domain.ErrOtherTenant
+	}
+
+	return nil
+}
+
+// checkPlatform makes sure the caller acts for the platform, as roles,
+// permissions, policies, constraints and attribute definitions are shared
+// by every organization.
+func checkPlatform(ctx context.Context) error {
+	if domain.TenantID(ctx) != 0 {
+		return domain.ErrOtherTenant
+	}
+
+	return nil
+}
+
+// validatePermissionNames validates grants written as permission[@scope].
+func validatePermissionNames(names []string) error {
+	for _, v := range names {
+		grant, err := domain.ParseGrant(v)
+		if err != nil {
+			return err
+		}
+
+		if !permission.Valid(grant.Permission) {
+			return fmt.Errorf("%w: %s", domain.ErrInvalidPermissionName, v)
+		}
+	}
+
+	return nil
+}
+
+// tokenLink adds token to the page base as the token query parameter.
+func tokenLink(base, token string) (string, error) {
+	link, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return link.String(), nil
+}
+
+// mergeAttributes applies changes to attributes, a nil value removing the
+// attribute.
+func mergeAttributes(attributes, changes map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(attributes)+len(changes))
+	for k, v := range attributes {
+		res[k] = v
+	}
+
+	for k, v := range changes {
+		if v == nil {
+			delete(res, k)
+			continue
+		}
+
+		res[k] = v
+	}
+
+	return res
+}
+
+// usersPageToken continues listing users after Cursor, for the parameters
+// hashed as Query only.
+type usersPageToken struct {
+	Query  string        `json:"q"`
+	Cursor domain.Cursor `json:"c"`
+}
+
+// usersQuery hashes the parameters and tenant deciding which users are
+// listed and in what order, leaving out those of the page.
+func usersQuery(ctx context.Context, params *domain.GetUsersParams) (string, error) {
+	query := *params
+	query.Page, query.PageSize, query.PageToken, query.Cursor = 0, 0, "", nil
+	query.CountTotal, query.Fields, query.SearchIDs = false, nil, nil
+
+	b, err := json.Marshal(struct {
+		TenantID int64
+		Params   domain.GetUsersParams
+	}{domain.TenantID(ctx), query})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	res := []string{}
+
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// symmetricDifference returns the values present in only one of a and b.
+func symmetricDifference(a, b []string) []string {
+	count := map[string]int{}
+	for _, v := range a {
+		count[v] |= 1
+	}
+
+	for _, v := range b {
+		count[v] |= 2
+	}
+
+	res := []string{}
+	for k, v := range count {
+		if v != 3 {
+			res = append(res, k)
 		}
 	}
 
-	return fmt.Errorf("not granted")
+	return res
 }
@@ -0,0 +1,252 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adetxt/user/domain"
+	relationmemory "github.com/adetxt/user/repository/relation_memory"
+	"github.com/adetxt/user/utils/cache"
+	"github.com/adetxt/user/utils/policy"
+	"gorm.io/gorm"
+)
+
+func TestSharedDefinitionsNeedPlatform(t *testing.T) {
+	// no repository: the calls must be rejected before reaching it
+	uc := &userUsecase{}
+	relations := NewRelationUsecase(nil, relationmemory.New())
+	ctx := domain.WithTenant(context.Background(), 1)
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"CreateRole", func() error {
+			_, err := uc.CreateRole(ctx, &domain.Role{Name: "auditor"})
+			return err
+		}},
+		{"UpdateRole", func() error { return uc.UpdateRole(ctx, &domain.Role{ID: 1, Name: "admin"}) }},
+		{"DeleteRole", func() error { return uc.DeleteRole(ctx, 1) }},
+		{"CreatePermission", func() error {
+			_, err := uc.CreatePermission(ctx, "user:read")
+			return err
+		}},
+		{"SetRoleParents", func() error { return uc.SetRoleParents(ctx, 1, []string{"admin"}) }},
+		{"AttachPermissions", func() error { return uc.AttachPermissions(ctx, 1, []string{"*:*"}) }},
+		{"DetachPermissions", func() error { return uc.DetachPermissions(ctx, 1, []string{"user:read"}) }},
+		{"CreatePolicy", func() error {
+			_, err := uc.CreatePolicy(ctx, &domain.Policy{Name: "office", Expression: "true"})
+			return err
+		}},
+		{"UpdatePolicy", func() error { return uc.UpdatePolicy(ctx, &domain.Policy{ID: 1}) }},
+		{"DeletePolicy", func() error { return uc.DeletePolicy(ctx, 1) }},
+		{"CreateRoleConstraint", func() error {
+			_, err := uc.CreateRoleConstraint(ctx, &domain.RoleConstraint{Name: "sod", Roles: []string{"a", "b"}})
+			return err
+		}},
+		{"DeleteRoleConstraint", func() error { return uc.DeleteRoleConstraint(ctx, 1) }},
+		{"ApplyPolicy", func() error {
+			_, err := uc.ApplyPolicy(ctx, &domain.PolicyDocument{}, true, false)
+			return err
+		}},
+		{"CreateAttributeDefinition", func() error {
+			_, err := uc.CreateAttributeDefinition(ctx, &domain.AttributeDefinition{Name: "department"})
+			return err
+		}},
+		{"DeleteAttributeDefinition", func() error { return uc.DeleteAttributeDefinition(ctx, 1) }},
+		{"CreateOrganization", func() error {
+			_, err := uc.CreateOrganization(ctx, &domain.Organization{Name: "acme"})
+			return err
+		}},
+		{"WriteTuples", func() error { return relations.WriteTuples(ctx, nil, nil) }},
+	}
+
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, domain.ErrOtherTenant) {
+			t.Errorf("%s in an organization = %v, want %v", tt.name, err, domain.ErrOtherTenant)
+		}
+	}
+}
+
+// fakeUserRepo holds the users and role grants of the tests and records
+// the role changes made.
+type fakeUserRepo struct {
+	domain.UserRepository
+	users   map[int64]*domain.User
+	grants  map[string][]string
+	changes []string
+}
+
+func (r *fakeUserRepo) GetUserByIdentifier(ctx context.Context, identifier string, value interface{}) (*domain.User, error) {
+	for _, v := range r.users {
+		if identifier == "id" && v.ID == value || identifier == "email" && v.Email == value {
+			return v, nil
+		}
+	}
+
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) RecordLoginFailure(ctx context.Context, id int64, max int, lock *domain.StatusChange) error {
+	r.changes = append(r.changes, "login failure")
+	return nil
+}
+
+func (r *fakeUserRepo) GetGrantsByRole(ctx context.Context, roles []string) ([]domain.Grant, error) {
+	res := []domain.Grant{}
+
+	for _, role := range roles {
+		for _, v := range r.grants[role] {
+			grant, err := domain.ParseGrant(v)
+			if err != nil {
+				return nil, err
+			}
+
+			grant.Role = role
+			res = append(res, grant)
+		}
+	}
+
+	return res, nil
+}
+
+func (r *fakeUserRepo) CreateRole(ctx context.Context, data *domain.Role) (int64, error) {
+	r.changes = append(r.changes, "create "+data.Name)
+	return 1, nil
+}
+
+func (r *fakeUserRepo) SetRoleParents(ctx context.Context, roleID int64, parents []string) error {
+	r.changes = append(r.changes, "parents "+strings.Join(parents, ","))
+	return nil
+}
+
+func (r *fakeUserRepo) AttachPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	r.changes = append(r.changes, "attach "+strings.Join(permissions, ","))
+	return nil
+}
+
+func (r *fakeUserRepo) DetachPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	r.changes = append(r.changes, "detach "+strings.Join(permissions, ","))
+	return nil
+}
+
+func TestRoleEditsCannotEscalate(t *testing.T) {
+	repo := &fakeUserRepo{
+		users: map[int64]*domain.User{
+			1: {ID: 1, Roles: []string{"editor"}},
+			2: {ID: 2, Roles: []string{"admin"}},
+			3: {ID: 3, Roles: []string{"admin", "no_delete"}},
+		},
+		grants: map[string][]string{
+			"editor":    {"role:update", "user:read", "user:update@self"},
+			"admin":     {"*:*"},
+			"no_delete": {"!user:delete"},
+		},
+	}
+	uc := &userUsecase{userRepo: repo, engine: policy.NewEngine()}
+
+	as := func(callerID string) context.Context {
+		return context.WithValue(context.Background(), "claims", `{"jti":"`+callerID+`"}`)
+	}
+
+	tests := []struct {
+		name   string
+		caller string
+		call   func(ctx context.Context) error
+		err    error
+	}{
+		// inheriting a role the caller does not hold
+		{"inherit admin", "1", func(ctx context.Context) error { return uc.SetRoleParents(ctx, 1, []string{"admin"}) }, domain.ErrRoleEscalation},
+		{"inherit a held role", "1", func(ctx context.Context) error { return uc.SetRoleParents(ctx, 1, []string{"editor"}) }, nil},
+		{"create inheriting admin", "1", func(ctx context.Context) error {
+			_, err := uc.CreateRole(ctx, &domain.Role{Name: "mine", Parents: []string{"admin"}})
+			return err
+		}, domain.ErrRoleEscalation},
+		// attaching permissions the caller does not hold
+		{"attach everything", "1", func(ctx context.Context) error { return uc.AttachPermissions(ctx, 1, []string{"*:*"}) }, domain.ErrPermissionEscalation},
+		{"attach a missing permission", "1", func(ctx context.Context) error {
+			return uc.AttachPermissions(ctx, 1, []string{"user:read", "user:delete"})
+		}, domain.ErrPermissionEscalation},
+		{"attach beyond a scoped grant", "1", func(ctx context.Context) error { return uc.AttachPermissions(ctx, 1, []string{"user:update"}) }, domain.ErrPermissionEscalation},
+		{"attach a held permission", "1", func(ctx context.Context) error { return uc.AttachPermissions(ctx, 1, []string{"user:read@self"}) }, nil},
+		{"attach a deny", "1", func(ctx context.Context) error { return uc.AttachPermissions(ctx, 1, []string{"!user:delete"}) }, nil},
+		{"create with a missing permission", "1", func(ctx context.Context) error {
+			_, err := uc.CreateRole(ctx, &domain.Role{Name: "mine", Permissions: []string{"user:delete"}})
+			return err
+		}, domain.ErrPermissionEscalation},
+		// detaching a deny hands out what it denied
+		{"detach a deny", "1", func(ctx context.Context) error { return uc.DetachPermissions(ctx, 1, []string{"!user:delete"}) }, domain.ErrPermissionEscalation},
+		{"detach an allow", "1", func(ctx context.Context) error { return uc.DetachPermissions(ctx, 1, []string{"user:read"}) }, nil},
+		{"admin attaches everything", "2", func(ctx context.Context) error { return uc.AttachPermissions(ctx, 1, []string{"*:*"}) }, nil},
+		{"denied admin", "3", func(ctx context.Context) error { return uc.AttachPermissions(ctx, 1, []string{"user:delete"}) }, domain.ErrPermissionEscalation},
+		{"unknown caller", "", func(ctx context.Context) error { return uc.AttachPermissions(ctx, 1, []string{"user:read"}) }, domain.ErrNotGranted},
+	}
+
+	for _, tt := range tests {
+		repo.changes = nil
+
+		err := tt.call(as(tt.caller))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+
+		if tt.err != nil && len(repo.changes) > 0 {
+			t.Errorf("%s: rejected change was made: %q", tt.name, repo.changes)
+		}
+
+		if tt.err == nil && len(repo.changes) != 1 {
+			t.Errorf("%s: change was not made", tt.name)
+		}
+	}
+}
+
+// policyRepo keeps policy expressions by name.
+type policyRepo struct {
+	domain.UserRepository
+	policies map[string]string
+}
+
+func (r *policyRepo) GetPoliciesByName(ctx context.Context, names []string) ([]*domain.Policy, error) {
+	res := []*domain.Policy{}
+
+	for _, v := range names {
+		if expr, ok := r.policies[v]; ok {
+			res = append(res, &domain.Policy{Name: v, Expression: expr})
+		}
+	}
+
+	return res, nil
+}
+
+func (r *policyRepo) DeletePolicy(ctx context.Context, id int64) error {
+	delete(r.policies, "office")
+	return nil
+}
+
+func TestDeletePolicyPurgesCache(t *testing.T) {
+	repo := &policyRepo{policies: map[string]string{"office": "false"}}
+	uc := &userUsecase{userRepo: repo, policies: cache.NewTTL[string, string](time.Hour)}
+	ctx := context.Background()
+
+	if _, err := uc.getPolicy(ctx, "office"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := uc.DeletePolicy(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	repo.policies["office"] = "true"
+
+	expr, err := uc.getPolicy(ctx, "office")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expr != "true" {
+		t.Errorf("policy created again evaluates %q, want %q", expr, "true")
+	}
+}
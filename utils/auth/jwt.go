@@ -7,11 +7,50 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 )
 
-func GetToken(id int64, expAt time.Time, signKey string) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Issuer:    "user",
-		ID:        fmt.Sprintf("%v", id),
-		ExpiresAt: jwt.NewNumericDate(expAt),
+// TokenClaims are token claims carrying the organization the token acts
+// in, zero for the platform.
+type TokenClaims struct {
+	jwt.RegisteredClaims
+	OrgID int64 `json:"org,omitempty"`
+}
+
+func GetToken(id, orgID int64, expAt time.Time, signKey string) (string, error) {
+	claims := TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "user",
+			ID:        fmt.Sprintf("%v", id),
+			ExpiresAt: jwt.NewNumericDate(expAt),
+		},
+		OrgID: orgID,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	return token.SignedString([]byte(signKey))
+}
+
+// PermissionClaims are access token claims carrying the user's roles and
+// permissions, so they can be authorized without hitting the database.
+type PermissionClaims struct {
+	TokenClaims
+	Roles             []string `json:"roles"`
+	Permissions       []string `json:"permissions"`
+	PermissionVersion int64    `json:"pv"`
+}
+
+func GetTokenWithPermissions(id, orgID int64, roles, permissions []string, version int64, expAt time.Time, signKey string) (string, error) {
+	claims := PermissionClaims{
+		TokenClaims: TokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "user",
+				ID:        fmt.Sprintf("%v", id),
+				ExpiresAt: jwt.NewNumericDate(expAt),
+			},
+			OrgID: orgID,
+		},
+		Roles:             roles,
+		Permissions:       permissions,
+		PermissionVersion: version,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -19,10 +58,13 @@ func GetToken(id int64, expAt time.Time, signKey string) (string, error) {
 	return token.SignedString([]byte(signKey))
 }
 
-func GetRefreshToken(id int64, expAt time.Time, signKey string) (string, error) {
-	claims := jwt.RegisteredClaims{
-		ID:        fmt.Sprintf("%v", id),
-		ExpiresAt: jwt.NewNumericDate(expAt),
+func GetRefreshToken(id, orgID int64, expAt time.Time, signKey string) (string, error) {
+	claims := TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        fmt.Sprintf("%v", id),
+			ExpiresAt: jwt.NewNumericDate(expAt),
+		},
+		OrgID: orgID,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
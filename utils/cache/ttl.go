@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// TTL is an in-memory cache safe for concurrent use whose entries expire
+// after a fixed duration.
+type TTL[K comparable, V any] struct {
+	ttl       time.Duration
+	mu        sync.RWMutex
+	entries   map[K]entry[V]
+	nextSweep time.Time
+}
+
+func NewTTL[K comparable, V any](ttl time.Duration) *TTL[K, V] {
+	return &TTL[K, V]{
+		ttl:     ttl,
+		entries: make(map[K]entry[V]),
+	}
+}
+
+func (c *TTL[K, V]) Get(key K) (V, bool) {
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(e.expiresAt) {
+		var zero V
+		return zero, false
+	}
+
+	return e.value, true
+}
+
+func (c *TTL[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	// drop expired entries once per ttl, so the map does not grow with keys
+	// that are never read again
+	if now.After(c.nextSweep) {
+		for k, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+
+		c.nextSweep = now.Add(c.ttl)
+	}
+
+	c.entries[key] = entry[V]{
+		value:     value,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+func (c *TTL[K, V]) Delete(key K) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+func (c *TTL[K, V]) Purge() {
+	c.mu.Lock()
+	c.entries = make(map[K]entry[V])
+	c.mu.Unlock()
+}
@@ -0,0 +1,430 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Filters follow the AIP-160 grammar without functions and traversal of
+// repeated fields, e.g.
+//
+//	status = active AND (role = admin OR email = "*@example.com")
+//	created_at >= "2024-01-01T00:00:00Z" -last_login_at:*
+//
+// Restrictions next to each other are joined by AND, which binds looser
+// than OR. NOT and a leading "-" negate the following term. Values may be
+// quoted and must be when holding spaces or parentheses.
+//
+// Parse only builds the expression tree; which fields exist and what the
+// values mean is up to the caller, which must never put them in queries
+// other than as bound parameters.
+
+const (
+	// MaxLength is the length limit of filters and MaxRestrictions the
+	// number of restrictions they may hold, so filters stay cheap to run.
+	MaxLength       = 1024
+	MaxRestrictions = 32
+	maxDepth        = 8
+)
+
+var ErrInvalid = errors.New("invalid filter")
+
+type Operator string
+
+const (
+	Equal          Operator = "="
+	NotEqual       Operator = "!="
+	Less           Operator = "<"
+	LessOrEqual    Operator = "<="
+	Greater        Operator = ">"
+	GreaterOrEqual Operator = ">="
+	// Has matches fields containing the value, or set at all for "*".
+	Has Operator = ":"
+)
+
+// operators are ordered so the longest operator matches first.
+var operators = []Operator{NotEqual, LessOrEqual, GreaterOrEqual, Equal, Less, Greater, Has}
+
+// Expr is a node of a filter, one of And, Or, Not and *Restriction.
+type Expr interface {
+	expr()
+}
+
+type And []Expr
+
+type Or []Expr
+
+type Not struct {
+	Expr Expr
+}
+
+// Restriction compares Field to Value, which is unquoted already.
+type Restriction struct {
+	Field    string
+	Operator Operator
+	Value    string
+}
+
+func (And) expr()          {}
+func (Or) expr()           {}
+func (Not) expr()          {}
+func (*Restriction) expr() {}
+
+// Parse returns the expression of filter, nil for an empty filter.
+func Parse(filter string) (Expr, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+
+	if len(filter) > MaxLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrInvalid, MaxLength)
+	}
+
+	tokens, err := lex(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	expr, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.unexpected(t)
+	}
+
+	return expr, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenText
+	tokenString
+	tokenOperator
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lex(s string) ([]token, error) {
+	tokens := []token{}
+	// a value follows an operator, and values such as times may hold
+	// operator characters
+	value := false
+
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+			continue
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")", pos: i})
+			i++
+		case c == '"' || c == '\'':
+			text, n, err := lexString(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v at %d", ErrInvalid, err, i)
+			}
+
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i})
+			i += n
+		case !value && strings.IndexByte("=!<>:", c) >= 0:
+			op := lexOperator(s[i:])
+			if op == "" {
+				return nil, fmt.Errorf("%w: unknown operator at %d", ErrInvalid, i)
+			}
+
+			tokens = append(tokens, token{kind: tokenOperator, text: string(op), pos: i})
+			i += len(op)
+			value = true
+
+			continue
+		default:
+			stop := " \t\r\n()\"'"
+			if !value {
+				stop += "=!<>:"
+			}
+
+			n := strings.IndexAny(s[i:], stop)
+			if n < 0 {
+				n = len(s) - i
+			}
+
+			tokens = append(tokens, token{kind: tokenText, text: s[i : i+n], pos: i})
+			i += n
+		}
+
+		value = false
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(s)}), nil
+}
+
+func lexOperator(s string) Operator {
+	for _, v := range operators {
+		if strings.HasPrefix(s, string(v)) {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// lexString reads the quoted string s starts with, where a backslash
+// escapes the next character, and returns it along with its length.
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	b := strings.Builder{}
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 == len(s) {
+				return "", 0, errors.New("unterminated string")
+			}
+
+			i++
+			b.WriteByte(s[i])
+		case quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return "", 0, errors.New("unterminated string")
+}
+
+type parser struct {
+	tokens       []token
+	pos          int
+	depth        int
+	restrictions int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) keyword(t token, keyword string) bool {
+	return t.kind == tokenText && t.text == keyword
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokenEOF {
+		return fmt.Errorf("%w: unexpected end", ErrInvalid)
+	}
+
+	return fmt.Errorf("%w: unexpected %q at %d", ErrInvalid, t.text, t.pos)
+}
+
+// expression: sequence {AND sequence}
+func (p *parser) expression() (Expr, error) {
+	res := And{}
+
+	for {
+		e, err := p.sequence()
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, e)
+
+		if !p.keyword(p.peek(), "AND") {
+			break
+		}
+
+		p.next()
+	}
+
+	return flatten(res), nil
+}
+
+// sequence: factor {factor}
+func (p *parser) sequence() (Expr, error) {
+	res := And{}
+
+	for {
+		e, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, e)
+
+		if t := p.peek(); t.kind == tokenEOF || t.kind == tokenClose || p.keyword(t, "AND") {
+			break
+		}
+	}
+
+	return flatten(res), nil
+}
+
+// factor: term {OR term}
+func (p *parser) factor() (Expr, error) {
+	res := Or{}
+
+	for {
+		e, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, e)
+
+		if !p.keyword(p.peek(), "OR") {
+			break
+		}
+
+		p.next()
+	}
+
+	if len(res) == 1 {
+		return res[0], nil
+	}
+
+	return res, nil
+}
+
+// term: [NOT | -] simple
+func (p *parser) term() (Expr, error) {
+	t := p.peek()
+
+	switch {
+	case p.keyword(t, "NOT"):
+		p.next()
+	case t.kind == tokenText && len(t.text) > 1 && t.text[0] == '-':
+		p.tokens[p.pos].text = t.text[1:]
+	default:
+		return p.simple()
+	}
+
+	e, err := p.simple()
+	if err != nil {
+		return nil, err
+	}
+
+	return Not{Expr: e}, nil
+}
+
+// simple: restriction | "(" expression ")"
+func (p *parser) simple() (Expr, error) {
+	if p.peek().kind != tokenOpen {
+		return p.restriction()
+	}
+
+	p.next()
+
+	if p.depth++; p.depth > maxDepth {
+		return nil, fmt.Errorf("%w: nested deeper than %d", ErrInvalid, maxDepth)
+	}
+
+	e, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.next(); t.kind != tokenClose {
+		return nil, p.unexpected(t)
+	}
+
+	p.depth--
+
+	return e, nil
+}
+
+// restriction: field operator value
+func (p *parser) restriction() (Expr, error) {
+	field := p.next()
+	if field.kind != tokenText || p.keyword(field, "AND") || p.keyword(field, "OR") || p.keyword(field, "NOT") {
+		return nil, p.unexpected(field)
+	}
+
+	op := p.next()
+	if op.kind != tokenOperator {
+		return nil, fmt.Errorf("%w: expected an operator after %s", ErrInvalid, field.text)
+	}
+
+	value := p.next()
+	if value.kind != tokenText && value.kind != tokenString {
+		return nil, p.unexpected(value)
+	}
+
+	if p.restrictions++; p.restrictions > MaxRestrictions {
+		return nil, fmt.Errorf("%w: more than %d restrictions", ErrInvalid, MaxRestrictions)
+	}
+
+	return &Restriction{
+		Field:    field.text,
+		Operator: Operator(op.text),
+		Value:    value.text,
+	}, nil
+}
+
+func flatten(and And) Expr {
+	if len(and) == 1 {
+		return and[0]
+	}
+
+	return and
+}
+
+// Order sorts by Field, descending when Desc is set.
+type Order struct {
+	Field string
+	Desc  bool
+}
+
+// ParseOrderBy parses a comma separated list of fields, each optionally
+// followed by asc or desc, e.g. "last_login_at desc, name".
+func ParseOrderBy(orderBy string) ([]Order, error) {
+	if strings.TrimSpace(orderBy) == "" {
+		return nil, nil
+	}
+
+	res := []Order{}
+	seen := map[string]bool{}
+
+	for _, v := range strings.Split(orderBy, ",") {
+		parts := strings.Fields(v)
+		if len(parts) == 0 || len(parts) > 2 || (len(parts) == 2 && parts[1] != "asc" && parts[1] != "desc") {
+			return nil, fmt.Errorf("invalid order_by %q, expected a field followed by asc or desc", strings.TrimSpace(v))
+		}
+
+		if seen[parts[0]] {
+			return nil, fmt.Errorf("invalid order_by, %s is listed twice", parts[0])
+		}
+
+		seen[parts[0]] = true
+
+		res = append(res, Order{
+			Field: parts[0],
+			Desc:  len(parts) == 2 && parts[1] == "desc",
+		})
+	}
+
+	return res, nil
+}
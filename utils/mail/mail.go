@@ -0,0 +1,68 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+type Config struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Sender delivers plain text mail to a single recipient.
+type Sender interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// New returns a sender delivering through the SMTP server of c, or one
+// only logging the mail when no server is configured, for development.
+func New(c *Config) Sender {
+	if c.Host == "" {
+		return logSender{}
+	}
+
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+
+	return &smtpSender{
+		addr: net.JoinHostPort(c.Host, c.Port),
+		auth: auth,
+		from: c.From,
+	}
+}
+
+type smtpSender struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func (s *smtpSender) Send(ctx context.Context, to, subject, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+
+	msg := fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		s.from, to, subject, body,
+	)
+
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{to}, []byte(msg))
+}
+
+type logSender struct{}
+
+func (logSender) Send(ctx context.Context, to, subject, body string) error {
+	log.Printf("mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
@@ -0,0 +1,84 @@
+package pagetoken
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type state struct {
+	Query  string
+	Cursor []string
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := DeriveKey([]byte("secret"))
+	want := state{Query: "q", Cursor: []string{"a", "1"}}
+
+	token, err := Encode(key, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := state{}
+	if err := Decode(key, token, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Query != want.Query || strings.Join(got.Cursor, ",") != strings.Join(want.Cursor, ",") {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	key := DeriveKey([]byte("secret"))
+
+	token, err := Encode(key, state{Query: "q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, signature, _ := strings.Cut(token, ".")
+	forged, err := Encode(DeriveKey([]byte("other")), state{Query: "q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{
+		"",
+		"no-dot",
+		payload,
+		payload + ".",
+		payload + "." + signature + "x",
+		"eyJRdWVyeSI6InIifQ." + signature,
+		forged,
+	} {
+		if err := Decode(key, v, &state{}); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Decode(%q) = %v, want ErrInvalid", v, err)
+		}
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	secret := []byte("jwt secret")
+	key := DeriveKey(secret)
+
+	if bytes.Equal(key, secret) || len(key) != 32 {
+		t.Errorf("DeriveKey returned %x", key)
+	}
+
+	if !bytes.Equal(key, DeriveKey(secret)) {
+		t.Error("DeriveKey is not deterministic")
+	}
+
+	// signatures made with the secret itself are not page tokens
+	token, err := Encode(secret, state{Query: "q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Decode(key, token, &state{}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("token signed with the secret decoded: %v", err)
+	}
+}
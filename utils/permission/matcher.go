@@ -0,0 +1,115 @@
+package permission
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Permissions are colon separated segments ending with the action, e.g.
+// "user:list" or "org:42:user:update". A "*" segment matches any single
+// segment, and as the last segment it matches every remaining segment, so
+// "org:42:*" covers "org:42:user:update". Elsewhere it never spans
+// segments: "*:read" covers "user:read" but not "org:42:user:read", which
+// takes "org:*:*:read" or "*:*:*:read", so grants never reach deeper
+// resources than they name. A leading "!" turns a grant into an explicit
+// deny, which always wins over allows.
+
+const (
+	separator = ":"
+	wildcard  = "*"
+	denyMark  = "!"
+)
+
+var segmentPattern = regexp.MustCompile(`^(\*|[a-z0-9][a-z0-9_-]*)$`)
+
+// Valid reports whether name follows the permission grammar.
+func Valid(name string) bool {
+	segments := strings.Split(strings.TrimPrefix(name, denyMark), separator)
+	if len(segments) < 2 {
+		return false
+	}
+
+	for _, v := range segments {
+		if !segmentPattern.MatchString(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsDeny reports whether grant is an explicit deny entry.
+func IsDeny(grant string) bool {
+	return strings.HasPrefix(grant, denyMark)
+}
+
+// Match reports whether grant covers permission, ignoring the deny mark.
+func Match(grant, permission string) bool {
+	g := strings.Split(strings.TrimPrefix(grant, denyMark), separator)
+	p := strings.Split(permission, separator)
+
+	for i := 0; i < len(g); i++ {
+		if i >= len(p) {
+			return false
+		}
+
+		if g[i] == wildcard {
+			if i == len(g)-1 {
+				return true
+			}
+
+			continue
+		}
+
+		if g[i] != p[i] {
+			return false
+		}
+	}
+
+	return len(g) == len(p)
+}
+
+// Matcher evaluates requested permissions against a set of grants.
+type Matcher struct {
+	allow []string
+	deny  []string
+}
+
+func NewMatcher(grants []string) *Matcher {
+	m := &Matcher{}
+
+	for _, v := range grants {
+		if IsDeny(v) {
+			m.deny = append(m.deny, v)
+		} else {
+			m.allow = append(m.allow, v)
+		}
+	}
+
+	return m
+}
+
+// Allowed reports whether permission is covered by an allow grant and not
+// by any deny grant.
+func (m *Matcher) Allowed(permission string) bool {
+	_, ok := m.Check(permission)
+	return ok
+}
+
+// Check is like Allowed but also returns the deciding grant, which is the
+// deny grant when permission is denied and empty when nothing matches.
+func (m *Matcher) Check(permission string) (string, bool) {
+	for _, v := range m.deny {
+		if Match(v, permission) {
+			return v, false
+		}
+	}
+
+	for _, v := range m.allow {
+		if Match(v, permission) {
+			return v, true
+		}
+	}
+
+	return "", false
+}
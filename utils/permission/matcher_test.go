@@ -0,0 +1,111 @@
+package permission
+
+import "testing"
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "user:list", want: true},
+		{name: "org:42:user:update", want: true},
+		{name: "org:*:user:read", want: true},
+		{name: "*", want: false},
+		{name: "*:*", want: true},
+		{name: "!user:delete", want: true},
+		{name: "!org:42:*", want: true},
+		{name: "user-group:list_all", want: true},
+		{name: "", want: false},
+		{name: "user", want: false},
+		{name: "!user", want: false},
+		{name: "user:", want: false},
+		{name: ":list", want: false},
+		{name: "user::list", want: false},
+		{name: "User:list", want: false},
+		{name: "user:li*", want: false},
+		{name: "user:**", want: false},
+		{name: "-user:list", want: false},
+		{name: "user:!list", want: false},
+		{name: "!!user:list", want: false},
+		{name: "user list:read", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := Valid(tt.name); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		grant      string
+		permission string
+		want       bool
+	}{
+		{grant: "user:list", permission: "user:list", want: true},
+		{grant: "user:list", permission: "user:update", want: false},
+		{grant: "user:list", permission: "user:list:all", want: false},
+		{grant: "user:list:all", permission: "user:list", want: false},
+		{grant: "*:*", permission: "user:list", want: true},
+		{grant: "*:*", permission: "org:42:user:read", want: true},
+		{grant: "user:*", permission: "user:delete", want: true},
+		{grant: "user:*", permission: "user", want: false},
+		{grant: "user:*", permission: "group:delete", want: false},
+		{grant: "*:read", permission: "user:read", want: true},
+		{grant: "*:read", permission: "user:update", want: false},
+		{grant: "*:read", permission: "org:42:user:read", want: false},
+		{grant: "*:*:*:read", permission: "org:42:user:read", want: true},
+		{grant: "org:42:*", permission: "org:42:user:update", want: true},
+		{grant: "org:42:*", permission: "org:42:group:member:add", want: true},
+		{grant: "org:42:*", permission: "org:43:user:update", want: false},
+		{grant: "org:42:*", permission: "org:42", want: false},
+		{grant: "org:*:user:read", permission: "org:7:user:read", want: true},
+		{grant: "org:*:user:read", permission: "org:7:user:update", want: false},
+		{grant: "org:*:user:read", permission: "org:7:group:user:read", want: false},
+		{grant: "!user:delete", permission: "user:delete", want: true},
+		{grant: "!org:42:*", permission: "org:42:user:update", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.grant, tt.permission); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.grant, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestMatcherCheck(t *testing.T) {
+	tests := []struct {
+		grants     []string
+		permission string
+		wantGrant  string
+		want       bool
+	}{
+		{grants: nil, permission: "user:list", wantGrant: "", want: false},
+		{grants: []string{"user:list"}, permission: "user:list", wantGrant: "user:list", want: true},
+		{grants: []string{"user:list"}, permission: "user:delete", wantGrant: "", want: false},
+		{grants: []string{"*:*"}, permission: "user:delete", wantGrant: "*:*", want: true},
+		{grants: []string{"*:*", "!user:delete"}, permission: "user:delete", wantGrant: "!user:delete", want: false},
+		{grants: []string{"*:*", "!user:delete"}, permission: "user:list", wantGrant: "*:*", want: true},
+		// denies win whatever their order or how specific the allow is
+		{grants: []string{"!user:*", "user:delete"}, permission: "user:delete", wantGrant: "!user:*", want: false},
+		{grants: []string{"org:42:user:update", "!org:42:*"}, permission: "org:42:user:update", wantGrant: "!org:42:*", want: false},
+		{grants: []string{"org:*:user:read", "!org:13:*"}, permission: "org:42:user:read", wantGrant: "org:*:user:read", want: true},
+		{grants: []string{"org:*:user:read", "!org:13:*"}, permission: "org:13:user:read", wantGrant: "!org:13:*", want: false},
+		// a deny alone grants nothing
+		{grants: []string{"!user:delete"}, permission: "user:list", wantGrant: "", want: false},
+	}
+
+	for _, tt := range tests {
+		m := NewMatcher(tt.grants)
+
+		grant, ok := m.Check(tt.permission)
+		if grant != tt.wantGrant || ok != tt.want {
+			t.Errorf("%q Check(%q) = %q, %v, want %q, %v", tt.grants, tt.permission, grant, ok, tt.wantGrant, tt.want)
+		}
+
+		if allowed := m.Allowed(tt.permission); allowed != tt.want {
+			t.Errorf("%q Allowed(%q) = %v, want %v", tt.grants, tt.permission, allowed, tt.want)
+		}
+	}
+}
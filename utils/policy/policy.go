@@ -0,0 +1,103 @@
+package policy
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+)
+
+// Input is the data a policy expression is evaluated against. Caller holds
+// the calling user and its token claims, Target the user acted on and
+// Request the call metadata and time.
+type Input struct {
+	Caller  map[string]interface{}
+	Target  map[string]interface{}
+	Request map[string]interface{}
+}
+
+// Engine compiles and evaluates CEL policy expressions. Compiled programs
+// are cached by expression.
+type Engine struct {
+	env      *cel.Env
+	programs sync.Map
+}
+
+// NewEngine panics when the CEL environment cannot be built, which only
+// happens when its declarations are wrong.
+func NewEngine() *Engine {
+	env, err := cel.NewEnv(
+		cel.Variable("caller", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("target", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Engine{
+		env: env,
+	}
+}
+
+// Compile validates expr, which must evaluate to a bool.
+func (e *Engine) Compile(expr string) error {
+	_, err := e.program(expr)
+	return err
+}
+
+func (e *Engine) Eval(expr string, input Input) (bool, error) {
+	prg, err := e.program(expr)
+	if err != nil {
+		return false, err
+	}
+
+	out, _, err := prg.Eval(map[string]interface{}{
+		"caller":  nonNil(input.Caller),
+		"target":  nonNil(input.Target),
+		"request": nonNil(input.Request),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	v, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("policy result is not a bool")
+	}
+
+	return v, nil
+}
+
+func (e *Engine) program(expr string) (cel.Program, error) {
+	if v, ok := e.programs.Load(expr); ok {
+		return v.(cel.Program), nil
+	}
+
+	ast, issues := e.env.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+
+	// dyn results, e.g. a plain map lookup, are checked when evaluated
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("policy must evaluate to bool, got %s", ast.OutputType())
+	}
+
+	prg, err := e.env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	e.programs.Store(expr, prg)
+
+	return prg, nil
+}
+
+func nonNil(v map[string]interface{}) map[string]interface{} {
+	if v == nil {
+		return map[string]interface{}{}
+	}
+
+	return v
+}
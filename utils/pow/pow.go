@@ -0,0 +1,72 @@
+// Package pow verifies hashcash-like proofs of work. A proof for a
+// resource is a stamp "<unix time>:<nonce>" such that the SHA-256 of
+// "<resource>:<stamp>" starts with the required number of zero bits.
+package pow
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed = errors.New("malformed proof of work")
+	ErrExpired   = errors.New("proof of work is too old")
+	ErrTooWeak   = errors.New("proof of work is too weak")
+)
+
+// Verify checks that stamp proves difficulty zero bits of work for
+// resource and was made at most maxAge before now.
+func Verify(resource, stamp string, difficulty int, maxAge time.Duration, now time.Time) error {
+	ts, nonce, ok := strings.Cut(stamp, ":")
+	if !ok || nonce == "" {
+		return ErrMalformed
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	if age := now.Sub(time.Unix(unix, 0)); age > maxAge || age < -time.Minute {
+		return ErrExpired
+	}
+
+	if LeadingZeros(resource, stamp) < difficulty {
+		return ErrTooWeak
+	}
+
+	return nil
+}
+
+// Solve finds a stamp for resource with difficulty zero bits, made at now.
+func Solve(resource string, difficulty int, now time.Time) string {
+	prefix := strconv.FormatInt(now.Unix(), 10) + ":"
+
+	for nonce := uint64(0); ; nonce++ {
+		stamp := prefix + strconv.FormatUint(nonce, 36)
+		if LeadingZeros(resource, stamp) >= difficulty {
+			return stamp
+		}
+	}
+}
+
+// LeadingZeros counts the leading zero bits of the hash of stamp for
+// resource.
+func LeadingZeros(resource, stamp string) int {
+	sum := sha256.Sum256([]byte(resource + ":" + stamp))
+
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+
+		n += 8
+	}
+
+	return n
+}
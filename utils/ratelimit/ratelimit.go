@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type window struct {
+	count   int
+	resetAt time.Time
+}
+
+// Limiter allows up to limit events per key in fixed windows of the given
+// length. It is safe for concurrent use.
+type Limiter struct {
+	limit     int
+	length    time.Duration
+	mu        sync.Mutex
+	windows   map[string]*window
+	nextSweep time.Time
+}
+
+func New(limit int, length time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		length:  length,
+		windows: make(map[string]*window),
+	}
+}
+
+// Allow records an event for key and reports whether it is within the
+// limit.
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	// drop finished windows once per window length, so the map does not
+	// grow with keys that are never seen again
+	if now.After(l.nextSweep) {
+		for k, w := range l.windows {
+			if now.After(w.resetAt) {
+				delete(l.windows, k)
+			}
+		}
+
+		l.nextSweep = now.Add(l.length)
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.After(w.resetAt) {
+		w = &window{resetAt: now.Add(l.length)}
+		l.windows[key] = w
+	}
+
+	w.count++
+
+	return w.count <= l.limit
+}